@@ -0,0 +1,33 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// backpressure counts the 503 responses of the server, that the client got
+// while it connected, and the time it waited afterwards.
+type backpressure struct {
+	rejections int
+	backoff    time.Duration
+}
+
+// backOff counts a 503 response and waits before the client tries again. The
+// waiting ends early, if the context is done.
+func (c *WSClient) backOff(ctx context.Context, wait time.Duration) {
+	c.mu.Lock()
+	c.backpressure.rejections++
+	c.backpressure.backoff += wait
+	c.mu.Unlock()
+	sleep(ctx, wait)
+}
+
+// TakeBackpressure returns the number of 503 responses, the client got since
+// the last call, and the time it waited because of them.
+func (c *WSClient) TakeBackpressure() (rejections int, backoff time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b := c.backpressure
+	c.backpressure = backpressure{}
+	return b.rejections, b.backoff
+}
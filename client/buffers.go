@@ -0,0 +1,70 @@
+package client
+
+import (
+	"io"
+	"sync"
+)
+
+// The pools reuse the memory of the hot message path, so the garbage
+// collector of the load generator does not skew the measured latencies.
+var (
+	// messagePool has the buffers of received messages. A message is put
+	// back, when ExpectData or ExpectClose has read it from the queue or
+	// when it was dropped.
+	messagePool = sync.Pool{
+		New: func() interface{} {
+			b := make([]byte, 0, 4096)
+			return &b
+		},
+	}
+
+	// holderPool has the empty pointers of the messagePool. They are reused,
+	// so putting a buffer back does not allocate a new pointer.
+	holderPool = sync.Pool{
+		New: func() interface{} { return new([]byte) },
+	}
+
+	// canonicalizers are used by hashData. Each has its own buffers.
+	canonicalizers = sync.Pool{
+		New: func() interface{} { return new(canonicalizer) },
+	}
+
+	// writeBufferPool is shared by the websocket connections, that only write
+	// a few control messages.
+	writeBufferPool = new(sync.Pool)
+)
+
+// readMessage reads r until io.EOF into a buffer of the messagePool.
+func readMessage(r io.Reader) ([]byte, error) {
+	holder := messagePool.Get().(*[]byte)
+	data := (*holder)[:0]
+	*holder = nil
+	holderPool.Put(holder)
+	for {
+		if len(data) == cap(data) {
+			// Let append grow the buffer.
+			data = append(data, 0)[:len(data)]
+		}
+		n, err := r.Read(data[len(data):cap(data)])
+		data = data[:len(data)+n]
+		if err == io.EOF {
+			return data, nil
+		}
+		if err != nil {
+			releaseMessage(data)
+			return nil, err
+		}
+	}
+}
+
+// releaseMessage puts the buffer of a message back into the messagePool. The
+// message can not be used afterwards. Messages, that were not read by
+// readMessage, can also be released.
+func releaseMessage(data []byte) {
+	if cap(data) == 0 {
+		return
+	}
+	holder := holderPool.Get().(*[]byte)
+	*holder = data[:0]
+	messagePool.Put(holder)
+}
@@ -0,0 +1,407 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var (
+	errJSONSyntax = errors.New("invalid json")
+	errJSONDepth  = errors.New("json is nested too deep")
+	errJSONData   = errors.New("data after the json value")
+)
+
+// maxJSONDepth is the deepest nesting of arrays and objects, a canonicalizer
+// accepts.
+const maxJSONDepth = 1000
+
+var (
+	jsonTrue  = []byte("true")
+	jsonFalse = []byte("false")
+	jsonNull  = []byte("null")
+)
+
+// canonicalizer writes json with sorted keys, without whitespace, with
+// normalized numbers and with the same escapes for the same strings. It does
+// not decode the json into go values and keeps its buffers between calls, so
+// it does not allocate, once the buffers are big enough.
+//
+// Numbers with the same value have the same notation, for example 1, 1.0 and
+// 1e0 are all 1. Strings only escape the quote, the backslash and the control
+// characters.
+type canonicalizer struct {
+	out     []byte
+	scratch []byte
+	members memberSorter
+}
+
+// member is a member of an object in the output. The key is out[key:colon]
+// and the member ends before out[end].
+type member struct {
+	key, colon, end int
+}
+
+// memberSorter sorts the members of the object, that starts at members[lo],
+// by there keys.
+type memberSorter struct {
+	out     []byte
+	members []member
+	lo      int
+}
+
+func (s *memberSorter) Len() int {
+	return len(s.members) - s.lo
+}
+
+func (s *memberSorter) Less(i, j int) bool {
+	a, b := s.members[s.lo+i], s.members[s.lo+j]
+	return bytes.Compare(s.out[a.key:a.colon], s.out[b.key:b.colon]) < 0
+}
+
+func (s *memberSorter) Swap(i, j int) {
+	s.members[s.lo+i], s.members[s.lo+j] = s.members[s.lo+j], s.members[s.lo+i]
+}
+
+// canonical returns the canonical json of data. The returned slice is only
+// valid until the next call. Returns an error, if the data is not json.
+func (c *canonicalizer) canonical(data []byte) ([]byte, error) {
+	c.out = c.out[:0]
+	c.members.members = c.members.members[:0]
+	pos, err := c.value(data, skipSpace(data, 0), 0)
+	if err != nil {
+		return nil, err
+	}
+	if skipSpace(data, pos) != len(data) {
+		return nil, errJSONData
+	}
+	return c.out, nil
+}
+
+// value writes the json value at data[pos] and returns the position after it.
+func (c *canonicalizer) value(data []byte, pos int, depth int) (int, error) {
+	if pos >= len(data) {
+		return pos, errJSONSyntax
+	}
+	switch b := data[pos]; {
+	case b == '{':
+		return c.object(data, pos, depth+1)
+	case b == '[':
+		return c.array(data, pos, depth+1)
+	case b == '"':
+		return c.str(data, pos)
+	case b == '-' || (b >= '0' && b <= '9'):
+		return c.number(data, pos)
+	}
+	for _, literal := range [...][]byte{jsonTrue, jsonFalse, jsonNull} {
+		if bytes.HasPrefix(data[pos:], literal) {
+			c.out = append(c.out, literal...)
+			return pos + len(literal), nil
+		}
+	}
+	return pos, errJSONSyntax
+}
+
+// object writes the object at data[pos] with sorted keys.
+func (c *canonicalizer) object(data []byte, pos int, depth int) (int, error) {
+	if depth > maxJSONDepth {
+		return pos, errJSONDepth
+	}
+	start := len(c.out)
+	lo := len(c.members.members)
+	c.out = append(c.out, '{')
+	pos = skipSpace(data, pos+1)
+	if pos < len(data) && data[pos] == '}' {
+		c.out = append(c.out, '}')
+		return pos + 1, nil
+	}
+
+	for {
+		if pos >= len(data) || data[pos] != '"' {
+			return pos, errJSONSyntax
+		}
+		key := len(c.out)
+		var err error
+		pos, err = c.str(data, pos)
+		if err != nil {
+			return pos, err
+		}
+		colon := len(c.out)
+		pos = skipSpace(data, pos)
+		if pos >= len(data) || data[pos] != ':' {
+			return pos, errJSONSyntax
+		}
+		c.out = append(c.out, ':')
+		pos, err = c.value(data, skipSpace(data, pos+1), depth)
+		if err != nil {
+			return pos, err
+		}
+		c.members.members = append(c.members.members, member{key: key, colon: colon, end: len(c.out)})
+
+		pos = skipSpace(data, pos)
+		if pos >= len(data) {
+			return pos, errJSONSyntax
+		}
+		if data[pos] == '}' {
+			pos++
+			break
+		}
+		if data[pos] != ',' {
+			return pos, errJSONSyntax
+		}
+		c.out = append(c.out, ',')
+		pos = skipSpace(data, pos+1)
+	}
+
+	c.members.out = c.out
+	c.members.lo = lo
+	if !sort.IsSorted(&c.members) {
+		// Write the members again in the sorted order.
+		sort.Sort(&c.members)
+		c.scratch = append(c.scratch[:0], c.out[start:]...)
+		c.out = append(c.out[:start], '{')
+		for i, m := range c.members.members[lo:] {
+			if i > 0 {
+				c.out = append(c.out, ',')
+			}
+			c.out = append(c.out, c.scratch[m.key-start:m.end-start]...)
+		}
+	}
+	c.out = append(c.out, '}')
+	c.members.members = c.members.members[:lo]
+	return pos, nil
+}
+
+// array writes the array at data[pos].
+func (c *canonicalizer) array(data []byte, pos int, depth int) (int, error) {
+	if depth > maxJSONDepth {
+		return pos, errJSONDepth
+	}
+	c.out = append(c.out, '[')
+	pos = skipSpace(data, pos+1)
+	if pos < len(data) && data[pos] == ']' {
+		c.out = append(c.out, ']')
+		return pos + 1, nil
+	}
+
+	for {
+		var err error
+		pos, err = c.value(data, pos, depth)
+		if err != nil {
+			return pos, err
+		}
+		pos = skipSpace(data, pos)
+		if pos >= len(data) {
+			return pos, errJSONSyntax
+		}
+		if data[pos] == ']' {
+			c.out = append(c.out, ']')
+			return pos + 1, nil
+		}
+		if data[pos] != ',' {
+			return pos, errJSONSyntax
+		}
+		c.out = append(c.out, ',')
+		pos = skipSpace(data, pos+1)
+	}
+}
+
+// number writes the number at data[pos]. Integers, that fit in an int64, are
+// written without a fraction, all other numbers in the shortest notation of a
+// float64.
+func (c *canonicalizer) number(data []byte, pos int) (int, error) {
+	start := pos
+	if data[pos] == '-' {
+		pos++
+	}
+	digits := pos
+	for pos < len(data) && data[pos] >= '0' && data[pos] <= '9' {
+		pos++
+	}
+	if pos == digits || (data[digits] == '0' && pos-digits > 1) {
+		// No digits or a leading zero.
+		return pos, errJSONSyntax
+	}
+
+	isInt := true
+	if pos < len(data) && data[pos] == '.' {
+		isInt = false
+		pos++
+		fraction := pos
+		for pos < len(data) && data[pos] >= '0' && data[pos] <= '9' {
+			pos++
+		}
+		if pos == fraction {
+			return pos, errJSONSyntax
+		}
+	}
+	if pos < len(data) && (data[pos] == 'e' || data[pos] == 'E') {
+		isInt = false
+		pos++
+		if pos < len(data) && (data[pos] == '+' || data[pos] == '-') {
+			pos++
+		}
+		exponent := pos
+		for pos < len(data) && data[pos] >= '0' && data[pos] <= '9' {
+			pos++
+		}
+		if pos == exponent {
+			return pos, errJSONSyntax
+		}
+	}
+
+	number := data[start:pos]
+	if isInt {
+		if i, err := strconv.ParseInt(string(number), 10, 64); err == nil {
+			c.out = strconv.AppendInt(c.out, i, 10)
+			return pos, nil
+		}
+	}
+	if f, err := strconv.ParseFloat(string(number), 64); err == nil {
+		c.out = strconv.AppendFloat(c.out, f, 'g', -1, 64)
+		return pos, nil
+	}
+	// The number is too big for a float64. Keep it as it is.
+	c.out = append(c.out, number...)
+	return pos, nil
+}
+
+// str writes the string at data[pos]. Escapes, that are not needed, are
+// replaced by the characters.
+func (c *canonicalizer) str(data []byte, pos int) (int, error) {
+	c.out = append(c.out, '"')
+	pos++
+	for {
+		// Copy the characters, that need no escape, at once.
+		run := pos
+		for pos < len(data) && data[pos] != '"' && data[pos] != '\\' && data[pos] >= 0x20 {
+			pos++
+		}
+		c.out = append(c.out, data[run:pos]...)
+		if pos >= len(data) || data[pos] < 0x20 {
+			return pos, errJSONSyntax
+		}
+		if data[pos] == '"' {
+			c.out = append(c.out, '"')
+			return pos + 1, nil
+		}
+
+		// data[pos] is a backslash.
+		if pos+1 >= len(data) {
+			return pos, errJSONSyntax
+		}
+		switch data[pos+1] {
+		case '"', '\\':
+			c.out = append(c.out, '\\', data[pos+1])
+		case '/':
+			c.out = append(c.out, '/')
+		case 'b':
+			c.out = append(c.out, '\\', 'b')
+		case 'f':
+			c.out = append(c.out, '\\', 'f')
+		case 'n':
+			c.out = append(c.out, '\\', 'n')
+		case 'r':
+			c.out = append(c.out, '\\', 'r')
+		case 't':
+			c.out = append(c.out, '\\', 't')
+		case 'u':
+			r, size := decodeEscape(data[pos:])
+			if size == 0 {
+				return pos, errJSONSyntax
+			}
+			c.appendRune(r)
+			pos += size
+			continue
+		default:
+			return pos, errJSONSyntax
+		}
+		pos += 2
+	}
+}
+
+// appendRune writes a rune of a string like it would be written, if it was
+// not escaped.
+func (c *canonicalizer) appendRune(r rune) {
+	switch r {
+	case '"', '\\':
+		c.out = append(c.out, '\\', byte(r))
+	case '\b':
+		c.out = append(c.out, '\\', 'b')
+	case '\f':
+		c.out = append(c.out, '\\', 'f')
+	case '\n':
+		c.out = append(c.out, '\\', 'n')
+	case '\r':
+		c.out = append(c.out, '\\', 'r')
+	case '\t':
+		c.out = append(c.out, '\\', 't')
+	default:
+		if r < 0x20 {
+			const hex = "0123456789abcdef"
+			c.out = append(c.out, '\\', 'u', '0', '0', hex[r>>4], hex[r&0xf])
+			return
+		}
+		c.out = utf8.AppendRune(c.out, r)
+	}
+}
+
+// decodeEscape decodes the \uXXXX escape at the start of data and, if it is a
+// surrogate pair, the second escape. It returns the rune and the length of
+// the escapes, or a length of 0, if the escape is invalid.
+func decodeEscape(data []byte) (rune, int) {
+	r := decodeHex(data)
+	if r < 0 {
+		return 0, 0
+	}
+	if !utf16.IsSurrogate(r) {
+		return r, 6
+	}
+	if second := decodeHex(data[6:]); second >= 0 {
+		if combined := utf16.DecodeRune(r, second); combined != utf8.RuneError {
+			return combined, 12
+		}
+	}
+	// A single surrogate is not a valid character.
+	return utf8.RuneError, 6
+}
+
+// decodeHex decodes the four hex digits of a \uXXXX escape at the start of
+// data. Returns -1, if there is no valid escape.
+func decodeHex(data []byte) rune {
+	if len(data) < 6 || data[0] != '\\' || data[1] != 'u' {
+		return -1
+	}
+	var r rune
+	for _, b := range data[2:6] {
+		switch {
+		case b >= '0' && b <= '9':
+			b -= '0'
+		case b >= 'a' && b <= 'f':
+			b = b - 'a' + 10
+		case b >= 'A' && b <= 'F':
+			b = b - 'A' + 10
+		default:
+			return -1
+		}
+		r = r<<4 | rune(b)
+	}
+	return r
+}
+
+// skipSpace returns the position of the first byte at or after pos, that is
+// no whitespace.
+func skipSpace(data []byte, pos int) int {
+	for pos < len(data) {
+		switch data[pos] {
+		case ' ', '\t', '\n', '\r':
+			pos++
+		default:
+			return pos
+		}
+	}
+	return pos
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"bytes"
+	"testing"
+)
+
+// benchmarkMessage is an autoupdate message like the ones of the write tests.
+var benchmarkMessage = []byte(`[{"collection":"motions/motion","id":12,"action":"changed","data":{"id":12,"title":"foo1","text":"<p>bar</p>","reason":"","weight":1.5e3,"submitters_id":[1,2,3],"comments":null,"state_id":1}},{"collection":"agenda/item","id":7,"action":"changed","data":{"weight":1000,"title":"foo1","id":7,"closed":false,"content_object":{"collection":"motions/motion","id":12}}}]`)
+
+// readAndHash is the work, that is done for each received message of each
+// client: reading it, hashing its canonical json and putting its buffer back.
+func readAndHash(tb testing.TB, reader *bytes.Reader) {
+	reader.Reset(benchmarkMessage)
+	data, err := readMessage(reader)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	hashData(data)
+	releaseMessage(data)
+}
+
+// TestHotPathAllocs checks, that the hot message path does not allocate.
+func TestHotPathAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector allocates")
+	}
+	reader := bytes.NewReader(nil)
+	// Fill the buffer pool first.
+	readAndHash(t, reader)
+
+	if allocs := testing.AllocsPerRun(100, func() { readAndHash(t, reader) }); allocs != 0 {
+		t.Errorf("the hot path allocates %v times per message, expected 0", allocs)
+	}
+	if allocs := testing.AllocsPerRun(100, func() { hashData(benchmarkMessage) }); allocs != 0 {
+		t.Errorf("hashData allocates %v times per message, expected 0", allocs)
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+	reader := bytes.NewReader(nil)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkMessage)))
+	for i := 0; i < b.N; i++ {
+		reader.Reset(benchmarkMessage)
+		data, err := readMessage(reader)
+		if err != nil {
+			b.Fatal(err)
+		}
+		releaseMessage(data)
+	}
+}
+
+func BenchmarkHash(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkMessage)))
+	for i := 0; i < b.N; i++ {
+		hashData(benchmarkMessage)
+	}
+}
+
+func BenchmarkReadAndHash(b *testing.B) {
+	reader := bytes.NewReader(nil)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkMessage)))
+	for i := 0; i < b.N; i++ {
+		readAndHash(b, reader)
+	}
+}
@@ -0,0 +1,689 @@
+// Package client contains the clients, that connect to OpenSlides.
+//
+// A client can login, receive data via a websocket connection (or via
+// long-polling or server-sent events) and send write requests.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/ostcar/oswstest/config"
+	"github.com/ostcar/oswstest/fakedata"
+	"github.com/ostcar/oswstest/tracing"
+)
+
+// Client is a client, that can connect to the server and receive data.
+//
+// The context of the methods cancels the waiting and the requests of the
+// method. It does not end the connection, that is opened by Connect. Use Close
+// for that.
+type Client interface {
+	Connect(ctx context.Context) error
+	String() string
+
+	// Username returns the username of the client on the server. It is empty
+	// for anonymous clients. Unlike String, it does not name the transport.
+	Username() string
+
+	IsAuth() bool
+	IsAdmin() bool
+	IsConnected() bool
+
+	// Status returns the state of the login and the connection. WaitStatus
+	// blocks, until the client has one of the statuses.
+	Status() Status
+	WaitStatus(ctx context.Context, statuses ...Status) (Status, error)
+	ExpectData(ctx context.Context, sinceTime chan time.Duration, err chan error, count int, finish chan bool, expect uint64, since *time.Time, sinceSet chan bool)
+
+	// DataHash returns the hash of the last message, that was received by
+	// ExpectData, or 0.
+	DataHash() uint64
+
+	// SetInspector sets a function, that gets each message, that is received
+	// by ExpectData. It has to be called before the client connects.
+	SetInspector(inspect func(data []byte))
+
+	// Subscribe returns a subscription, that gets a copy of each received
+	// message, independent of ExpectData. Unsubscribe ends it.
+	Subscribe(size int) *Subscription
+	Unsubscribe(s *Subscription)
+
+	// CloseInfo returns, how the connection was closed, or nil, if it was not
+	// closed.
+	CloseInfo() *CloseInfo
+
+	// TakeQueueStats returns the number of dropped messages and the longest
+	// wait of a message in the queue since the last call.
+	TakeQueueStats() QueueStats
+
+	// SetHTTPObserver sets a function, that gets the status code of each http
+	// request. It has to be called before the client logs in.
+	SetHTTPObserver(observe HTTPObserver)
+
+	// TakeBackpressure returns the number of 503 responses, the client got
+	// since the last call, and the time it waited because of them.
+	TakeBackpressure() (rejections int, backoff time.Duration)
+
+	// Close closes the connection of the client, so the server sees a normal
+	// closure. It returns, when the read loop of the connection has ended, and
+	// drops the messages, that no test has read. If the connection is already
+	// closed, it only waits for the read loop and drops the messages.
+	Close() error
+
+	// State returns a snapshot of the client, like the number of received
+	// messages and, if ExpectData is still waiting.
+	State() State
+}
+
+// AuthClient is a client, that can login and logout.
+type AuthClient interface {
+	Client
+	Login(ctx context.Context) error
+	Logout(ctx context.Context) error
+	ExpectClose(ctx context.Context, timeout time.Duration, ready chan bool) (time.Duration, error)
+}
+
+// AdminClient is a client, that can send write requests.
+type AdminClient interface {
+	AuthClient
+	Send(ctx context.Context) error
+
+	// SendMarked sends the write request with the marker in the changed data,
+	// so the write can be found in the received messages.
+	SendMarked(ctx context.Context, marker string) error
+}
+
+// getSendRequest returns the request that is send by the admin clients. It
+// changes the agenda item WriteItemID. The comment starts with the marker, if
+// it is not empty, and has the length WritePayloadSize, if it is set. If fake
+// is not nil, the title and the comment are fake data.
+func getSendRequest(ctx context.Context, cfg *config.Config, marker string, fake *fakedata.Generator) (*http.Request, error) {
+	if fake != nil {
+		return getFakeSendRequest(ctx, cfg, marker, fake)
+	}
+	comment := "test"
+	if marker != "" {
+		comment = marker
+	}
+	if cfg.WritePayloadSize > 0 {
+		comment = marker
+		if len(comment) < cfg.WritePayloadSize {
+			comment += strings.Repeat("x", cfg.WritePayloadSize-len(comment))
+		}
+	}
+	return http.NewRequestWithContext(
+		ctx,
+		"PUT",
+		writeItemURL(cfg),
+		strings.NewReader(`
+			{"id":`+strconv.Itoa(cfg.WriteItemID)+`,"item_number":"","title":"foo1","list_view_title":"foo1",
+			"comment":"`+comment+`","closed":false,"type":1,"is_hidden":false,"duration":null,
+			"speaker_list_closed":false,"content_object":{"collection":"topics/topic",
+			"id":1},"weight":10000,"parent_id":null,"parentCount":0,"hover":true}`),
+	)
+}
+
+// WSClient represents one of many openslides users. It receives its data via
+// a websocket connection. The other transports embed it for login and
+// sending.
+type WSClient struct {
+	cfg *config.Config
+
+	username string
+	password string
+	isAuth   bool
+	isAdmin  bool
+
+	// queue holds the received messages, until a test reads them. It has
+	// ClientQueueSize places. When it is full, new messages are dropped and
+	// counted in dropped. queueWait is the longest time in nanoseconds, a
+	// message waited in the queue. See TakeQueueStats.
+	queue     chan queued
+	dropped   int64
+	queueWait int64
+
+	// received counts the messages since the client connected.
+	received int64
+
+	wsConnection *websocket.Conn
+	cookies      *cookiejar.Jar
+
+	// writeMu allows only one SendMessage at the same time.
+	writeMu sync.Mutex
+
+	// latencyMu protects lastDelivery.
+	latencyMu sync.Mutex
+
+	// lastDelivery is the time, the last received message is given to the
+	// tests with a simulated latency. See deliverAt.
+	lastDelivery time.Time
+
+	// tokens holds the authentication token, if AuthMode is "token", "os4" or
+	// "oidc".
+	tokens tokenManager
+
+	// oidcRefreshToken is the refresh token, if AuthMode is "oidc".
+	oidcRefreshToken string
+
+	// mu protects dataHash, closeInfo, closed, backpressure, expect, the
+	// status, connectedAt and csrfToken.
+	mu           sync.Mutex
+	dataHash     uint64
+	closeInfo    *CloseInfo
+	backpressure backpressure
+	expect       expectState
+
+	// status is the state of the client. statusChanged is closed and
+	// replaced on each change. See WaitStatus.
+	status        Status
+	statusChanged chan struct{}
+
+	// connectedAt is the time, the current connection was established.
+	connectedAt time.Time
+
+	// csrfToken is the csrf token, if CSRFMode is "endpoint". Clients are
+	// shared by paced tests, so it is read and written under mu.
+	csrfToken string
+
+	// closed is closed, when the connection is closed. There is a new channel
+	// for each connection.
+	closed chan struct{}
+
+	// readDone is closed, when the read loop of the connection has ended. It
+	// is nil for transports without an own read loop.
+	readDone chan struct{}
+
+	// inspect gets each received message, if it is not nil.
+	inspect func(data []byte)
+
+	// subMu protects subscribers. The read loop only takes the read lock.
+	subMu       sync.RWMutex
+	subscribers []*Subscription
+
+	// httpObserver gets the status of each http request, if it is not nil.
+	httpObserver HTTPObserver
+
+	// limiter limits the rate of the http requests of this client. It is nil
+	// without a ClientRequestRate.
+	limiter *tokenBucket
+
+	// fake generates the data of the write requests, if WritePayload is
+	// "fake" or "template". It is nil for the other clients.
+	fake *fakedata.Generator
+
+	// sent counts the write requests of the client for the payload template.
+	sent int64
+}
+
+// NewAnonymousClient creates an anonymous client.
+func NewAnonymousClient(cfg *config.Config) *WSClient {
+	// Without options, cookiejar.New does not return an error.
+	jar, _ := cookiejar.New(nil)
+	return &WSClient{
+		cfg:     cfg,
+		cookies: jar,
+		queue:   make(chan queued, cfg.ClientQueueSize),
+		limiter: newTokenBucket(cfg.ClientRequestRate, cfg.RequestBurst),
+	}
+}
+
+// NewUserClient creates an user client.
+func NewUserClient(cfg *config.Config, username, password string) *WSClient {
+	client := NewAnonymousClient(cfg)
+	client.username = username
+	client.password = password
+	client.isAuth = true
+	return client
+}
+
+// NewAdminClient creates an admin client.
+func NewAdminClient(cfg *config.Config, username, password string) *WSClient {
+	client := NewUserClient(cfg, username, password)
+	client.isAdmin = true
+	client.fake = newFakeGenerator(cfg, username)
+	return client
+}
+
+// IsAuth returns true, if the client logs in.
+func (c *WSClient) IsAuth() bool {
+	return c.isAuth
+}
+
+// IsAdmin returns true, if the client can send write requests.
+func (c *WSClient) IsAdmin() bool {
+	return c.isAdmin
+}
+
+// IsConnected returns true, if the connection of the client was established.
+// It is still true, when the connection was closed afterwards.
+func (c *WSClient) IsConnected() bool {
+	s := c.Status()
+	return s == StatusConnected || s == StatusClosed
+}
+
+// String returns the username of the client.
+func (c *WSClient) String() string {
+	if !c.isAuth {
+		return "anonymous"
+	}
+	return c.username
+}
+
+// Username returns the username of the client or an empty string for
+// anonymous clients.
+func (c *WSClient) Username() string {
+	if !c.isAuth {
+		return ""
+	}
+	return c.username
+}
+
+// Connect creates a websocket connection. It blocks until the connection is
+// established. The context only cancels the handshake.
+func (c *WSClient) Connect(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "connect", "client", c.String())
+	defer func() { span.End(err) }()
+
+	c.setStatus(StatusConnecting)
+	begin := time.Now()
+	loginErrorCount := 0
+	for loginErrorCount < c.cfg.MaxConnectionAttemts && ctx.Err() == nil {
+		dialer := websocket.Dialer{
+			Jar:             c.cookies,
+			WriteBufferPool: writeBufferPool,
+		}
+		header := make(http.Header)
+		if err = c.authorize(header); err != nil {
+			err = fmt.Errorf("%s: can not authorize the websocket dial: %w", c, err)
+			break
+		}
+		tracing.Inject(ctx, header)
+		var wsURL string
+		if wsURL, err = c.websocketURL(); err != nil {
+			err = fmt.Errorf("%s: can not build the websocket url: %w", c, err)
+			break
+		}
+		if err = c.sleepLatency(ctx); err != nil {
+			break
+		}
+		var r *http.Response
+		start := time.Now()
+		c.wsConnection, r, err = dialer.DialContext(ctx, wsURL, header)
+		c.observeHTTP(r, time.Since(start), err)
+		if err != nil {
+			if err == websocket.ErrBadHandshake && r.StatusCode == 503 {
+				// The channel was full. Try again later. This does not count as error.
+				c.backOff(ctx, 100*time.Millisecond)
+				continue
+			}
+			loginErrorCount++
+			err = c.opError(attempt("websocket dial", loginErrorCount, c.cfg.MaxConnectionAttemts), wsURL, begin, err)
+			continue
+		}
+		// if no error happend, then we can break the loop
+		break
+	}
+	if err != nil {
+		log.Printf("Could not connect, %s\n", err)
+		c.setStatus(StatusFailed)
+		return err
+	}
+
+	c.setConnected()
+
+	done := c.startReadLoop()
+	go func() {
+		// Write all incomming messages into the queue of the client.
+		defer done()
+		defer c.wsConnection.Close()
+		for {
+			_, r, err := c.wsConnection.NextReader()
+			var m []byte
+			if err == nil {
+				m, err = readMessage(r)
+			}
+			if err != nil {
+				// The error is not send to a channel, that nobody reads, so
+				// the loop always ends here.
+				c.setClosed(err)
+				break
+			}
+			c.push(m)
+		}
+	}()
+	return nil
+}
+
+// setConnected sets the connected time to now and the status to connected.
+func (c *WSClient) setConnected() {
+	atomic.StoreInt64(&c.received, 0)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connectedAt = time.Now()
+	c.closeInfo = nil
+	c.closed = make(chan struct{})
+	c.setStatusLocked(StatusConnected)
+}
+
+// push adds a received message to the queue and sends a copy to the
+// subscriptions. It does not block, so a slow test does not stall the read
+// loop. If the queue is full, the message is dropped and counted.
+func (c *WSClient) push(data []byte) {
+	atomic.AddInt64(&c.received, 1)
+	c.publish(data)
+	select {
+	case c.queue <- queued{data: data, at: c.deliverAt()}:
+	default:
+		releaseMessage(data)
+		atomic.AddInt64(&c.dropped, 1)
+	}
+}
+
+// ExpectData runs, until there are count websocket messages or one websocket error.
+// It sends the time since the the start of this function, but not before the websocket
+// connection was established. If since is nil, then the function waits until it
+// chances to something else. Therefore the sinceSet channel has to be closed.
+// If sinceChan != nil, then the time in since is used. In this case the function
+// blocks until sinceChan is closed. Make sure to set since before.
+// When count messages or one error was received, then it sends a signal
+// to the finish channel.
+// If the client does not get count messages within ReceiveTimeout, it sends an
+// error.
+// If expect it different then 0, then it checks, that the received message has the
+// same hash as expect and sends an error if not. The hash of the last message can
+// be read with DataHash.
+// If the context is done, it sends the error of the context.
+func (c *WSClient) ExpectData(ctx context.Context, sinceTime chan time.Duration, err chan error, count int, finish chan bool, expect uint64, since *time.Time, sinceSet chan bool) {
+	defer trackExpect()()
+	defer c.beginExpect(count)()
+	var start time.Time
+	defer func() { finish <- true }()
+
+	// Wait until the client is connected or the connection has failed
+	status, waitErr := c.WaitStatus(ctx, StatusConnected, StatusClosed, StatusFailed)
+	if waitErr != nil {
+		err <- waitErr
+		return
+	}
+	if status == StatusFailed {
+		// If the connection faild, then there is nothing to do here.
+		return
+	}
+	start = time.Now()
+
+	// The span of the receive-wait ends with the error, that is send.
+	_, span := tracing.Start(ctx, "receive-wait", "client", c.String(), "messages", strconv.Itoa(count))
+	defer span.End(nil)
+	fail := func(e error) {
+		span.End(e)
+		err <- e
+	}
+
+	// Messages, that were received before, are still in the queue.
+	readChan := c.queue
+	closed := c.closedChan()
+
+	// Without a ReceiveTimeout, timeout is nil and blocks forever. Else it
+	// starts again with each message, so a long paced test does not time out
+	// as long as the messages come.
+	var timer *time.Timer
+	var timeout <-chan time.Time
+	if c.cfg.ReceiveTimeout > 0 {
+		timer = time.NewTimer(c.cfg.ReceiveTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	timedOut := func(i int) error {
+		return fmt.Errorf("%s got %d of %d messages, no data within %s", c, i, count, c.cfg.ReceiveTimeout)
+	}
+
+	for i := 0; i < count; i++ {
+		select {
+		case <-timeout:
+			fail(timedOut(i))
+			return
+
+		case m := <-readChan:
+			// The simulated latency is also bounded by the timeout.
+			delivered, e := c.awaitDelivery(ctx, m, timeout)
+			if e == nil && !delivered {
+				e = timedOut(i)
+			}
+			if e != nil {
+				releaseMessage(m.data)
+				fail(e)
+				return
+			}
+			c.noteWait(m)
+			data := m.data
+			hash := hashData(data)
+			c.mu.Lock()
+			c.dataHash = hash
+			c.expect.got++
+			c.mu.Unlock()
+			if c.inspect != nil {
+				c.inspect(data)
+			}
+			releaseMessage(data)
+			if expect != 0 && expect != hash {
+				fail(fmt.Errorf("%s: received data has a different hash after %s. Expected: %d, Received: %d", c, time.Since(start).Round(time.Millisecond), expect, hash))
+				return
+			}
+			if timer != nil {
+				// The timer could have fired since the message was received.
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(c.cfg.ReceiveTimeout)
+			}
+
+		case <-closed:
+			fail(fmt.Errorf("%s: connection closed after %s with %d of %d messages: %w", c, time.Since(start).Round(time.Millisecond), i, count, c.CloseInfo().Err))
+			return
+
+		case <-ctx.Done():
+			fail(ctx.Err())
+			return
+		}
+	}
+	if sinceSet != nil {
+		// The since channel is set. Wait until the channel is closed and then
+		// (re-) set the start value
+		<-sinceSet
+		start = *since
+	}
+	sinceTime <- time.Since(start)
+}
+
+// DataHash returns the hash of the last message, that was received by
+// ExpectData, or 0. Json messages are canonicalized before they are hashed.
+func (c *WSClient) DataHash() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dataHash
+}
+
+// SetInspector sets a function, that gets each message, that is received by
+// ExpectData. The function must not keep the message, because its buffer is
+// reused.
+func (c *WSClient) SetInspector(inspect func(data []byte)) {
+	c.inspect = inspect
+}
+
+func (c *WSClient) getLoginData() (string, error) {
+	data, err := json.Marshal(map[string]string{"username": c.username, "password": c.password})
+	if err != nil {
+		return "", fmt.Errorf("can not encode login data: %s", err)
+	}
+	return string(data), nil
+}
+
+// Login logs the client in. Server errors are retried MaxLoginAttemts times.
+func (c *WSClient) Login(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "login", "client", c.String())
+	defer func() { span.End(err) }()
+
+	defer func() {
+		if err == nil {
+			c.setLoggedIn(true)
+		}
+	}()
+
+	if c.cfg.AuthMode == "oidc" {
+		return c.oidcLogin(ctx)
+	}
+
+	httpClient := c.httpClient()
+	loginURL := c.cfg.HTTPURL(c.cfg.LoginURLPath)
+	start := time.Now()
+	loginData, err := c.getLoginData()
+	if err != nil {
+		return c.opError("login", loginURL, start, err)
+	}
+	var resp *http.Response
+	loginErrorCount := 0
+	for loginErrorCount < c.cfg.MaxLoginAttemts {
+		op := attempt("login", loginErrorCount+1, c.cfg.MaxLoginAttemts)
+		var req *http.Request
+		req, err = http.NewRequestWithContext(
+			ctx,
+			"POST",
+			loginURL,
+			strings.NewReader(loginData),
+		)
+		if err != nil {
+			return c.opError(op, loginURL, start, err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		tracing.Inject(ctx, req.Header)
+		resp, err = httpClient.Do(req)
+		if err != nil {
+			return c.opError(op, loginURL, start, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 500 || resp.StatusCode >= 600 {
+			break
+		}
+		// If the error is on the server side, then retry
+		loginErrorCount++
+		if err := sleep(ctx, 100*time.Millisecond); err != nil {
+			return c.opError(op, loginURL, start, err)
+		}
+	}
+
+	if resp.StatusCode != 200 {
+		return c.opError("login", loginURL, start, statusError(resp.Status))
+	}
+	if c.cfg.AuthMode == "token" || c.cfg.AuthMode == "os4" {
+		return c.setTokenFromResponse(resp)
+	}
+	return nil
+}
+
+// Send sends the write request.
+func (c *WSClient) Send(ctx context.Context) (err error) {
+	return c.SendMarked(ctx, "")
+}
+
+// SendMarked sends the write request with the marker in the comment.
+func (c *WSClient) SendMarked(ctx context.Context, marker string) (err error) {
+	ctx, span := tracing.Start(ctx, "send", "client", c.String())
+	defer func() { span.End(err) }()
+
+	start := time.Now()
+	var req *http.Request
+	if c.cfg.WritePayload == "template" {
+		req, err = c.getTemplateSendRequest(ctx, marker)
+	} else {
+		req, err = getSendRequest(ctx, c.cfg, marker, c.fake)
+	}
+	if err != nil {
+		return c.opError("write request", writeItemURL(c.cfg), start, err)
+	}
+	req.Header.Set("Content-Type", "application/json;charset=UTF-8")
+	tracing.Inject(ctx, req.Header)
+	resp, err := c.doAuthRequest(req)
+	if err != nil {
+		return c.opError("write request", req.URL.String(), start, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBuffer, _ := ioutil.ReadAll(resp.Body)
+		log.Printf("Response of the failed write request: %s", bodyBuffer)
+		return c.opError("write request", req.URL.String(), start, statusError(resp.Status))
+	}
+	return nil
+}
+
+// Logout logs the client out. The token of the client is removed.
+func (c *WSClient) Logout(ctx context.Context) error {
+	start := time.Now()
+	logoutURL := c.cfg.HTTPURL(c.cfg.LogoutURLPath)
+	req, err := http.NewRequestWithContext(ctx, "POST", logoutURL, nil)
+	if err != nil {
+		return c.opError("logout", logoutURL, start, err)
+	}
+	resp, err := c.doAuthRequest(req)
+	if err != nil {
+		return c.opError("logout", logoutURL, start, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return c.opError("logout", logoutURL, start, statusError(resp.Status))
+	}
+	c.tokens.set("")
+	c.setLoggedIn(false)
+	return nil
+}
+
+// ExpectClose waits until the connection of the client is closed by the
+// server. It returns the time until the connection was closed or an error, if
+// it is still open after the timeout. All messages received in the meantime
+// are ignored.
+// The ready channel is closed, when the function listens to the connection.
+// The connection has to be established. If the context is done, it returns the
+// error of the context.
+func (c *WSClient) ExpectClose(ctx context.Context, timeout time.Duration, ready chan bool) (time.Duration, error) {
+	defer trackExpect()()
+	defer c.beginExpect(0)()
+	start := time.Now()
+	readChan := c.queue
+	closed := c.closedChan()
+	close(ready)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case m := <-readChan:
+			// Ignore data, that is send before the connection is closed.
+			releaseMessage(m.data)
+
+		case <-closed:
+			return time.Since(start), nil
+
+		case <-timer.C:
+			return 0, fmt.Errorf("connection of client %s is still open %s after logout", c, timeout)
+
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
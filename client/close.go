@@ -0,0 +1,209 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// errStreamClosed is the error of an event stream, that was closed by the
+// server without an error.
+var errStreamClosed = errors.New("event stream closed by the server")
+
+// errClosedByClient is the error of a connection, that was closed by Close.
+var errClosedByClient = errors.New("connection closed by the client")
+
+// closeWait is the time, Close waits for the end of the connection.
+const closeWait = time.Second
+
+// CloseInfo describes, how the connection of a client was closed.
+type CloseInfo struct {
+	// Reason is the close code of the websocket connection, like "1006
+	// abnormal closure", or the kind of the error, like "EOF" or "connection
+	// reset".
+	Reason string
+
+	// At is the time, the connection was closed.
+	At time.Time
+
+	// Open is the time, the connection was open.
+	Open time.Duration
+
+	// Err is the error, that ended the connection.
+	Err error
+}
+
+// closeCodes are the names of the websocket close codes.
+var closeCodes = map[int]string{
+	websocket.CloseNormalClosure:      "normal closure",
+	websocket.CloseGoingAway:          "going away",
+	websocket.CloseProtocolError:      "protocol error",
+	websocket.CloseUnsupportedData:    "unsupported data",
+	websocket.CloseAbnormalClosure:    "abnormal closure",
+	websocket.ClosePolicyViolation:    "policy violation",
+	websocket.CloseMessageTooBig:      "message too big",
+	websocket.CloseInternalServerErr:  "server error",
+	websocket.CloseServiceRestart:     "service restart",
+	websocket.CloseTryAgainLater:      "try again later",
+	websocket.CloseMandatoryExtension: "mandatory extension",
+}
+
+// closeReason returns the reason of a closed connection from the error of the
+// read loop.
+func closeReason(err error) string {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		if name, ok := closeCodes[closeErr.Code]; ok {
+			return fmt.Sprintf("%d %s", closeErr.Code, name)
+		}
+		return fmt.Sprintf("%d", closeErr.Code)
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, errStreamClosed):
+		return "EOF"
+	case errors.Is(err, errClosedByClient), errors.Is(err, context.Canceled):
+		return "closed by the client"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "connection reset"
+	case errors.Is(err, syscall.EPIPE):
+		return "broken pipe"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	}
+	return fmt.Sprintf("%T", err)
+}
+
+// setClosed saves, how the connection was closed, and closes the closed
+// channel, so ExpectData and ExpectClose see it. It is called by the read
+// loops of all transports and by Close. Only the first call for a connection
+// is saved.
+func (c *WSClient) setClosed(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closeInfo != nil {
+		return
+	}
+	c.closeInfo = &CloseInfo{
+		Reason: closeReason(err),
+		At:     time.Now(),
+		Open:   time.Since(c.connectedAt),
+		Err:    err,
+	}
+	close(c.closed)
+	c.setStatusLocked(StatusClosed)
+}
+
+// closedChan returns the channel, that is closed, when the current connection
+// is closed.
+func (c *WSClient) closedChan() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// CloseInfo returns, how the connection of the client was closed, or nil, if
+// it was not closed.
+func (c *WSClient) CloseInfo() *CloseInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeInfo
+}
+
+// isOpen returns true, if the client has a connection, that is not closed.
+func (c *WSClient) isOpen() bool {
+	return c.Status() == StatusConnected
+}
+
+// startReadLoop counts the read loop of a new connection. It has to be called
+// before the loop is started. The returned function has to be called, when the
+// loop ends.
+func (c *WSClient) startReadLoop() func() {
+	done := make(chan struct{})
+	c.mu.Lock()
+	c.readDone = done
+	c.mu.Unlock()
+	untrack := trackReadLoop()
+	return func() {
+		untrack()
+		close(done)
+	}
+}
+
+// stopReadLoop waits, until the read loop of the connection has ended, and
+// drops the messages in the queue, so they are not read after a reconnect.
+// The connection has to be closed before, else it blocks.
+func (c *WSClient) stopReadLoop() {
+	c.mu.Lock()
+	done := c.readDone
+	c.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+	for {
+		select {
+		case m := <-c.queue:
+			releaseMessage(m.data)
+		default:
+			return
+		}
+	}
+}
+
+// waitClosed waits up to closeWait, until the connection is closed.
+func (c *WSClient) waitClosed() {
+	timer := time.NewTimer(closeWait)
+	defer timer.Stop()
+	select {
+	case <-c.closedChan():
+	case <-timer.C:
+	}
+}
+
+// Close closes the websocket connection with a close message, so the server
+// sees a normal closure. It waits up to a second for the answer of the
+// server and then until the read loop has ended.
+func (c *WSClient) Close() error {
+	defer c.stopReadLoop()
+	if !c.isOpen() {
+		return nil
+	}
+	err := c.wsConnection.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(closeWait),
+	)
+	c.waitClosed()
+	c.wsConnection.Close()
+	return err
+}
+
+// Close closes the event stream and waits, until the read loop has ended.
+func (c *SSEClient) Close() error {
+	defer c.stopReadLoop()
+	if !c.isOpen() {
+		return nil
+	}
+	c.setClosed(errClosedByClient)
+	c.cancel()
+	return c.resp.Body.Close()
+}
+
+// Close stops the polling and waits, until the read loop has ended. A running
+// poll request is canceled.
+func (c *PollingClient) Close() error {
+	defer c.stopReadLoop()
+	if !c.isOpen() {
+		return nil
+	}
+	c.setClosed(errClosedByClient)
+	c.cancel()
+	return nil
+}
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// sleep waits for the duration d. It returns the error of the context, if the
+// context is done before.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// cancelOnDone calls cancel, if ctx is done before the returned function is
+// called. The transports use it, so that the context of Connect only cancels
+// the connecting and not the connection, that lives longer.
+func cancelOnDone(ctx context.Context, cancel context.CancelFunc) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
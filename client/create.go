@@ -0,0 +1,202 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/ostcar/oswstest/config"
+)
+
+// ClientFactory creates single clients. It is used by FromFactory to create
+// all clients of a configuration. Own implementations can return other
+// transports, instrumented clients or mocks.
+type ClientFactory interface {
+	AnonymousClient() Client
+	UserClient(username, password string) Client
+	AdminClient(username, password string) Client
+}
+
+// NewFactory returns the default ClientFactory. It creates websocket clients
+// and spreads the polling and sse clients over them, as configured.
+func NewFactory(cfg *config.Config) ClientFactory {
+	return &wsFactory{cfg: cfg, mix: transportMix{cfg: cfg}}
+}
+
+type wsFactory struct {
+	cfg *config.Config
+	mix transportMix
+}
+
+func (f *wsFactory) AnonymousClient() Client {
+	return f.mix.wrap(NewAnonymousClient(f.cfg))
+}
+
+func (f *wsFactory) UserClient(username, password string) Client {
+	return f.mix.wrap(NewUserClient(f.cfg, username, password))
+}
+
+func (f *wsFactory) AdminClient(username, password string) Client {
+	return f.mix.wrap(NewAdminClient(f.cfg, username, password))
+}
+
+// FromConfig creates all clients of a configuration with the default factory.
+func FromConfig(ctx context.Context, cfg *config.Config) ([]Client, error) {
+	return FromFactory(ctx, cfg, NewFactory(cfg))
+}
+
+// FromFactory creates all clients of a configuration with a factory. The
+// logged-in clients are read from the CredentialsFile, if one is given. Else
+// the admin and normal clients are generated. The admin clients are always
+// first. The anonymous clients are appended at the end.
+// With a ShardCount, only the clients of the shard are created.
+func FromFactory(ctx context.Context, cfg *config.Config, factory ClientFactory) ([]Client, error) {
+	credentials, err := configCredentials(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var clients []Client
+	for _, c := range credentials {
+		if c.Role == "admin" {
+			clients = append(clients, factory.AdminClient(c.Username, c.Password))
+			continue
+		}
+		clients = append(clients, factory.UserClient(c.Username, c.Password))
+	}
+
+	for i := 0; i < shardCount(cfg, cfg.AnonymousClients); i++ {
+		clients = append(clients, factory.AnonymousClient())
+	}
+	return clients, nil
+}
+
+// configCredentials returns the credentials of all logged-in clients. If
+// GeneratePasswords is true, each generated client gets its own password.
+//
+// The generated credentials are written to GeneratedCredentialsFile, before
+// the users are created and the passwords are set on the server. So the
+// passwords are never lost, even if one of the steps fails.
+func configCredentials(ctx context.Context, cfg *config.Config) ([]Credential, error) {
+	if cfg.GeneratePasswords && !cfg.SetGeneratedPasswords {
+		return nil, fmt.Errorf("the generated passwords have to be set on the server with SetGeneratedPasswords, else no client can login")
+	}
+	credentials, err := Credentials(cfg)
+	if err != nil {
+		return nil, err
+	}
+	credentials = shardCredentials(cfg, credentials)
+
+	// The passwords of a credentials file are never generated.
+	generate := cfg.GeneratePasswords && cfg.CredentialsFile == ""
+	if generate {
+		for i := range credentials {
+			password, err := GeneratePassword(cfg.GeneratedPasswordLength)
+			if err != nil {
+				return nil, err
+			}
+			credentials[i].Password = password
+		}
+		if err := WriteCredentials(cfg.GeneratedCredentialsFile, credentials); err != nil {
+			return nil, fmt.Errorf("can not write the generated credentials: %s", err)
+		}
+		log.Printf("Wrote the generated credentials to %s.", cfg.GeneratedCredentialsFile)
+	}
+	if err := createUsers(ctx, cfg, credentials); err != nil {
+		return nil, err
+	}
+	if !generate {
+		return credentials, nil
+	}
+
+	if err := SetPasswords(ctx, cfg, credentials); err != nil {
+		return nil, fmt.Errorf("can not set the generated passwords, the passwords of some users could already be the ones in %s: %s", cfg.GeneratedCredentialsFile, err)
+	}
+	log.Printf("Set the passwords of %d users.", len(credentials))
+	return credentials, nil
+}
+
+// Credentials returns the credentials of the logged-in clients of all shards.
+// They are read from the CredentialsFile, if one is given. Else the admin and
+// normal clients are generated with LoginPassword.
+func Credentials(cfg *config.Config) ([]Credential, error) {
+	if cfg.CredentialsFile != "" {
+		return LoadCredentials(cfg.CredentialsFile)
+	}
+	var credentials []Credential
+	for i := 0; i < cfg.AdminClients; i++ {
+		credentials = append(credentials, Credential{Username: fmt.Sprintf("admin%d", i), Password: cfg.LoginPassword, Role: "admin"})
+	}
+	for i := 0; i < cfg.NormalClients; i++ {
+		credentials = append(credentials, Credential{Username: fmt.Sprintf("user%d", i), Password: cfg.LoginPassword, Role: "user"})
+	}
+	return credentials, nil
+}
+
+// createUsers creates the users of the credentials, that do not exist, if
+// CreateUsers is true.
+func createUsers(ctx context.Context, cfg *config.Config, credentials []Credential) error {
+	if !cfg.CreateUsers {
+		return nil
+	}
+	created, err := CreateUsers(ctx, cfg, credentials)
+	if err != nil {
+		return err
+	}
+	log.Printf("Created %d of %d users.", created, len(credentials))
+	return nil
+}
+
+// shardCredentials returns the credentials of the shard of this process. If
+// ShardCount is greater then one, each process gets every ShardCount-th
+// credential.
+func shardCredentials(cfg *config.Config, credentials []Credential) []Credential {
+	if cfg.ShardCount <= 1 {
+		return credentials
+	}
+	var shard []Credential
+	for i := cfg.ShardIndex; i < len(credentials); i += cfg.ShardCount {
+		shard = append(shard, credentials[i])
+	}
+	return shard
+}
+
+// shardCount returns how many of count clients belong to the shard of this
+// process.
+func shardCount(cfg *config.Config, count int) int {
+	if cfg.ShardCount <= 1 {
+		return count
+	}
+	n := count / cfg.ShardCount
+	if cfg.ShardIndex < count%cfg.ShardCount {
+		n++
+	}
+	return n
+}
+
+// transportMix chooses the transport for each client, so that the configured
+// percentages of polling and sse clients are spread evenly over all clients.
+// The other clients use websocket, with EpollClients without an own read
+// goroutine.
+type transportMix struct {
+	cfg     *config.Config
+	count   int
+	polling int
+	sse     int
+}
+
+// wrap returns the client with the transport it should use.
+func (m *transportMix) wrap(c *WSClient) Client {
+	m.count++
+	switch {
+	case m.polling < m.count*m.cfg.PollingClientsPercent/100:
+		m.polling++
+		return NewPollingClient(c)
+	case m.sse < m.count*m.cfg.SSEClientsPercent/100:
+		m.sse++
+		return NewSSEClient(c)
+	case m.cfg.EpollClients:
+		return NewEpollClient(c)
+	}
+	return c
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Credential are the login data of one user.
+type Credential struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// Role is "admin" or "user". Admin clients are used to send write
+	// requests.
+	Role string `json:"role"`
+}
+
+// LoadCredentials reads the credentials from a json or csv file. The format is
+// chosen by the file extension.
+//
+// A json file has to contain a list of objects with the fields username,
+// password and role. A csv file has to contain the columns username, password
+// and role. An optional header line is skipped.
+//
+// The admins are returned first, so the first client is an admin client.
+func LoadCredentials(path string) ([]Credential, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var credentials []Credential
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.NewDecoder(f).Decode(&credentials); err != nil {
+			return nil, fmt.Errorf("can not decode credentials file %s: %s", path, err)
+		}
+	case ".csv":
+		credentials, err = readCSVCredentials(f)
+		if err != nil {
+			return nil, fmt.Errorf("can not read credentials file %s: %s", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown format of credentials file %s, use .json or .csv", path)
+	}
+
+	for i, c := range credentials {
+		if c.Username == "" {
+			return nil, fmt.Errorf("credential %d in %s has no username", i+1, path)
+		}
+		if c.Role != "admin" && c.Role != "user" {
+			return nil, fmt.Errorf("credential %s in %s has invalid role %q", c.Username, path, c.Role)
+		}
+	}
+
+	sort.SliceStable(credentials, func(i, j int) bool {
+		return credentials[i].Role == "admin" && credentials[j].Role != "admin"
+	})
+	return credentials, nil
+}
+
+func readCSVCredentials(r io.Reader) ([]Credential, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	var credentials []Credential
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(credentials) == 0 && record[0] == "username" {
+			// Skip the header
+			continue
+		}
+		credentials = append(credentials, Credential{
+			Username: record[0],
+			Password: record[1],
+			Role:     record[2],
+		})
+	}
+	return credentials, nil
+}
+
+// WriteCredentials writes credentials to a csv file, that can be read with
+// LoadCredentials. The file is only readable by the owner.
+func WriteCredentials(path string, credentials []Credential) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// An existing file keeps its permissions with OpenFile.
+	if err := f.Chmod(0600); err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(f)
+	writer.Write([]string{"username", "password", "role"})
+	for _, c := range credentials {
+		writer.Write([]string{c.Username, c.Password, c.Role})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	// The passwords are only safe, when they are on the disk.
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
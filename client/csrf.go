@@ -0,0 +1,136 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// doAuthRequest sends a request, that needs the authentication of the client.
+// Adds the token or the csrf token to the request. If the server rejects the
+// request with 403, the csrf token is refreshed and the request is send again
+// one time, because the server could have rotated the token.
+func (c *WSClient) doAuthRequest(req *http.Request) (*http.Response, error) {
+	httpClient := c.httpClient()
+	if err := c.setAuthHeaders(req); err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusForbidden || !c.usesCSRF() {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	// Refresh the csrf token and try again.
+	if err := c.refreshCSRFToken(req.Context()); err != nil {
+		return nil, err
+	}
+	if req.GetBody != nil {
+		if req.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.setAuthHeaders(req); err != nil {
+		return nil, err
+	}
+	return httpClient.Do(req)
+}
+
+// usesCSRF returns true, if the client has to send a csrf token.
+func (c *WSClient) usesCSRF() bool {
+	return c.cfg.AuthMode == "session" && c.cfg.CSRFMode != "none"
+}
+
+// setAuthHeaders adds the headers to a request, that are needed for a write
+// request of a logged-in client. This is the token or the csrf token.
+func (c *WSClient) setAuthHeaders(req *http.Request) error {
+	if !c.usesCSRF() {
+		return c.authorize(req.Header)
+	}
+
+	token, err := c.getCSRFToken(req)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(c.cfg.CSRFHeaderName, token)
+	return nil
+}
+
+// getCSRFToken returns the csrf token for a request. With CSRFMode "cookie",
+// the token is read from the cookie CSRFCookieName. With "endpoint", the token
+// is fetched from CSRFTokenURLPath. In both cases, the token is fetched from
+// the server, if the client does not have one yet.
+func (c *WSClient) getCSRFToken(req *http.Request) (string, error) {
+	if c.cfg.CSRFMode == "endpoint" {
+		c.mu.Lock()
+		token := c.csrfToken
+		c.mu.Unlock()
+		if token == "" {
+			if err := c.refreshCSRFToken(req.Context()); err != nil {
+				return "", err
+			}
+			c.mu.Lock()
+			token = c.csrfToken
+			c.mu.Unlock()
+		}
+		return token, nil
+	}
+
+	token := c.csrfCookie(req)
+	if token == "" {
+		if err := c.refreshCSRFToken(req.Context()); err != nil {
+			return "", err
+		}
+		token = c.csrfCookie(req)
+	}
+	if token == "" {
+		return "", fmt.Errorf("no csrf cookie %s for client %s", c.cfg.CSRFCookieName, c)
+	}
+	return token, nil
+}
+
+// csrfCookie returns the value of the csrf cookie or an empty string.
+func (c *WSClient) csrfCookie(req *http.Request) string {
+	for _, cookie := range c.cookies.Cookies(req.URL) {
+		if cookie.Name == c.cfg.CSRFCookieName {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// refreshCSRFToken requests CSRFTokenURLPath. With CSRFMode "cookie", the
+// server sets a new csrf cookie. With "endpoint", the token is read from the
+// field CSRFTokenJSONField of the response.
+func (c *WSClient) refreshCSRFToken(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.cfg.HTTPURL(c.cfg.CSRFTokenURLPath), nil)
+	if err != nil {
+		return err
+	}
+	httpClient := c.httpClient()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("can not fetch csrf token for client %s: %s", c, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("can not fetch csrf token for client %s: StatusCode: %d", c, resp.StatusCode)
+	}
+	if c.cfg.CSRFMode != "endpoint" {
+		return nil
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("can not decode csrf token response for client %s: %s", c, err)
+	}
+	token, ok := body[c.cfg.CSRFTokenJSONField].(string)
+	if !ok || token == "" {
+		return fmt.Errorf("csrf token response for client %s has no field %s", c, c.cfg.CSRFTokenJSONField)
+	}
+	c.mu.Lock()
+	c.csrfToken = token
+	c.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,368 @@
+//go:build linux
+// +build linux
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/gorilla/websocket"
+	"github.com/ostcar/oswstest/tracing"
+)
+
+// EpollClient is a websocket client without an own read goroutine. The
+// connections of all epoll clients are watched by a few pollers, that read
+// a message, when the server has send one. So a machine can hold many more
+// idle connections then with one goroutine per client.
+//
+// It only works with linux and without TLS. Everything else is the same as
+// for the websocket client.
+type EpollClient struct {
+	*WSClient
+	conn   net.Conn
+	fd     int
+	poller *poller
+
+	// pending is the data, that was read, but is not a complete message yet.
+	// It is only used by the poller of the client.
+	pending []byte
+}
+
+// NewEpollClient turns a client into an epoll client.
+func NewEpollClient(c *WSClient) Client {
+	return &EpollClient{WSClient: c}
+}
+
+func (c *EpollClient) String() string {
+	return c.WSClient.String() + " (epoll)"
+}
+
+// Connect opens the websocket connection and adds it to a poller. It blocks
+// until the connection is established. The context only cancels the handshake.
+func (c *EpollClient) Connect(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "connect", "client", c.String())
+	defer func() { span.End(err) }()
+
+	c.setStatus(StatusConnecting)
+	begin := time.Now()
+	errorCount := 0
+	for errorCount < c.cfg.MaxConnectionAttemts && ctx.Err() == nil {
+		var br *bufio.Reader
+		start := time.Now()
+		br, err = c.dial(ctx)
+		var status ws.StatusError
+		if errors.As(err, &status) {
+			c.observeHTTP(&http.Response{StatusCode: int(status)}, time.Since(start), nil)
+			if status == 503 {
+				// The channel was full. Try again later. This does not count as error.
+				c.backOff(ctx, 100*time.Millisecond)
+				continue
+			}
+		} else {
+			c.observeHTTP(&http.Response{StatusCode: http.StatusSwitchingProtocols}, time.Since(start), err)
+		}
+		if err != nil {
+			errorCount++
+			wsURL, _ := c.websocketURL()
+			err = c.opError(attempt("websocket dial", errorCount, c.cfg.MaxConnectionAttemts), wsURL, begin, err)
+			continue
+		}
+
+		c.setConnected()
+		if br != nil {
+			// The server has send data together with the handshake.
+			data, _ := br.Peek(br.Buffered())
+			c.pending = append(c.pending, data...)
+			ws.PutReader(br)
+			if !c.deliverPending() {
+				return nil
+			}
+		}
+		if err = c.poller.add(c); err != nil {
+			c.conn.Close()
+			c.setClosed(err)
+		}
+		return err
+	}
+	log.Printf("Could not connect, %s\n", err)
+	c.setStatus(StatusFailed)
+	return err
+}
+
+// Close closes the websocket connection with a close message like the
+// websocket client. If the server does not answer within a second, the
+// connection is closed without the answer. The unread messages are dropped.
+func (c *EpollClient) Close() error {
+	defer c.stopReadLoop()
+	if !c.isOpen() {
+		return nil
+	}
+	err := wsutil.WriteClientMessage(c.conn, ws.OpClose, ws.NewCloseFrameBody(ws.StatusNormalClosure, ""))
+	c.waitClosed()
+	if c.isOpen() {
+		c.poller.remove(c.fd)
+		c.conn.Close()
+		c.setClosed(errClosedByClient)
+	}
+	return err
+}
+
+// dial does the websocket handshake.
+func (c *EpollClient) dial(ctx context.Context) (*bufio.Reader, error) {
+	wsURL, err := c.websocketURL()
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(wsURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ws" {
+		return nil, fmt.Errorf("epoll clients only support ws urls, not %s", u.Scheme)
+	}
+
+	header := make(http.Header)
+	if err := c.authorize(header); err != nil {
+		return nil, err
+	}
+	tracing.Inject(ctx, header)
+	// The cookie jar uses http urls.
+	u.Scheme = "http"
+	for _, cookie := range c.cookies.Cookies(u) {
+		header.Add("Cookie", cookie.String())
+	}
+
+	dialer := ws.Dialer{Header: ws.HandshakeHeaderHTTP(header)}
+	conn, br, _, err := dialer.Dial(ctx, wsURL)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := connFD(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.conn = conn
+	c.fd = fd
+	if c.poller, err = nextPoller(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return br, nil
+}
+
+// readTimeout bounds each read of an epoll client. The poller only reads,
+// when epoll has reported data, so a read normally returns at once.
+const readTimeout = 10 * time.Millisecond
+
+// read reads the data, that the server has written, into the buffer of the
+// client and delivers the complete messages. The rest of a message is read
+// with the next EPOLLIN, so a slow server does not block the other
+// connections of the poller. buf is the read buffer of the poller. Returns
+// false, if the connection was closed.
+func (c *EpollClient) read(buf []byte) bool {
+	c.conn.SetReadDeadline(time.Now().Add(readTimeout))
+	n, err := c.conn.Read(buf)
+	c.pending = append(c.pending, buf[:n]...)
+	if !c.deliverPending() {
+		return false
+	}
+	var netErr net.Error
+	if err != nil && !(errors.As(err, &netErr) && netErr.Timeout()) {
+		return c.deliver(nil, err)
+	}
+	return true
+}
+
+// deliverPending writes the complete messages of the buffer into the queue
+// like the read loop of the websocket client does. Returns false, if the
+// connection was closed.
+func (c *EpollClient) deliverPending() bool {
+	var read int
+	defer func() {
+		// Idle connections do not keep a buffer.
+		c.pending = c.pending[:copy(c.pending, c.pending[read:])]
+		if len(c.pending) == 0 {
+			c.pending = nil
+		}
+	}()
+
+	for {
+		n := messageSize(c.pending[read:])
+		if n == 0 {
+			return true
+		}
+		data, _, err := wsutil.ReadServerData(struct {
+			io.Reader
+			io.Writer
+		}{bytes.NewReader(c.pending[read : read+n]), c.conn})
+		read += n
+		if !c.deliver(data, err) {
+			return false
+		}
+	}
+}
+
+// messageSize returns the size of the frames at the start of buf, that make
+// one message, or 0, if the message is not complete yet. Control frames
+// between the frames of the message are counted, because
+// wsutil.ReadServerData answers them. A close frame ends the message.
+func messageSize(buf []byte) int {
+	r := bytes.NewReader(buf)
+	for {
+		h, err := ws.ReadHeader(r)
+		if err != nil || h.Length > int64(r.Len()) {
+			return 0
+		}
+		r.Seek(h.Length, io.SeekCurrent)
+		if h.OpCode == ws.OpClose || (h.Fin && !h.OpCode.IsControl()) {
+			return len(buf) - r.Len()
+		}
+	}
+}
+
+// deliver writes a message into the queue or closes the client, if there was
+// an error. Returns false, if the connection was closed.
+func (c *EpollClient) deliver(data []byte, err error) bool {
+	if err != nil {
+		var closed wsutil.ClosedError
+		if errors.As(err, &closed) {
+			// Use the same error as the websocket client, so the close
+			// reason is the same.
+			err = &websocket.CloseError{Code: int(closed.Code), Text: closed.Reason}
+		}
+		// Remove the connection before it is closed, so a new connection
+		// with the same file descriptor is not removed.
+		c.poller.remove(c.fd)
+		c.conn.Close()
+		c.setClosed(err)
+		return false
+	}
+	c.push(data)
+	return true
+}
+
+// connFD returns the file descriptor of a connection.
+func connFD(conn net.Conn) (int, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return 0, fmt.Errorf("connection has no file descriptor")
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var fd int
+	if err := raw.Control(func(f uintptr) { fd = int(f) }); err != nil {
+		return 0, err
+	}
+	return fd, nil
+}
+
+// poller watches the connections of many epoll clients with one epoll
+// instance and one goroutine.
+type poller struct {
+	epfd int
+	buf  []byte
+
+	mu      sync.Mutex
+	clients map[int]*EpollClient
+}
+
+var (
+	pollersOnce sync.Once
+	pollers     []*poller
+	pollersErr  error
+	pollerNext  uint64
+)
+
+// nextPoller returns the pollers one after another. There is one poller for
+// each CPU. They are started with the first epoll client. If they can not be
+// created, all epoll clients get the error.
+func nextPoller() (*poller, error) {
+	pollersOnce.Do(func() {
+		for i := 0; i < runtime.NumCPU(); i++ {
+			p, err := newPoller()
+			if err != nil {
+				pollersErr = fmt.Errorf("can not create epoll instance: %s", err)
+				return
+			}
+			pollers = append(pollers, p)
+		}
+	})
+	if pollersErr != nil {
+		return nil, pollersErr
+	}
+	return pollers[atomic.AddUint64(&pollerNext, 1)%uint64(len(pollers))], nil
+}
+
+func newPoller() (*poller, error) {
+	epfd, err := syscall.EpollCreate1(0)
+	if err != nil {
+		return nil, err
+	}
+	p := &poller{epfd: epfd, buf: make([]byte, 64<<10), clients: make(map[int]*EpollClient)}
+	go p.run()
+	return p, nil
+}
+
+// add starts to watch the connection of a client.
+func (p *poller) add(c *EpollClient) error {
+	p.mu.Lock()
+	p.clients[c.fd] = c
+	p.mu.Unlock()
+	event := syscall.EpollEvent{Events: syscall.EPOLLIN | syscall.EPOLLRDHUP, Fd: int32(c.fd)}
+	if err := syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_ADD, c.fd, &event); err != nil {
+		p.remove(c.fd)
+		return fmt.Errorf("can not add connection to epoll: %s", err)
+	}
+	return nil
+}
+
+// remove stops to watch a connection.
+func (p *poller) remove(fd int) {
+	p.mu.Lock()
+	delete(p.clients, fd)
+	p.mu.Unlock()
+	// The file descriptor is removed from epoll, when it is closed.
+}
+
+// run reads a message of each connection, that the server has written to.
+func (p *poller) run() {
+	events := make([]syscall.EpollEvent, 128)
+	for {
+		n, err := syscall.EpollWait(p.epfd, events, -1)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			log.Printf("Epoll wait failed, %s", err)
+			return
+		}
+		for _, event := range events[:n] {
+			p.mu.Lock()
+			c := p.clients[int(event.Fd)]
+			p.mu.Unlock()
+			if c == nil {
+				continue
+			}
+			c.read(p.buf)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package client
+
+import (
+	"log"
+	"sync"
+)
+
+// epollWarning logs the warning only once.
+var epollWarning sync.Once
+
+// NewEpollClient returns the websocket client, because epoll only exists on
+// linux.
+func NewEpollClient(c *WSClient) Client {
+	epollWarning.Do(func() { log.Println("Epoll clients only work on linux, use websocket clients") })
+	return c
+}
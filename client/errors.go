@@ -0,0 +1,25 @@
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// opError wraps the error of an operation of the client with the name of the
+// client, the operation, the url and the time since start, like
+// "user42: websocket dial attempt 3/3 to ws://... failed after 5s: connection
+// refused". The original error can be unwrapped.
+func (c *WSClient) opError(op, url string, start time.Time, err error) error {
+	return fmt.Errorf("%s: %s to %s failed after %s: %w", c, op, url, time.Since(start).Round(time.Millisecond), err)
+}
+
+// attempt returns the operation with the number of the attempt, like "login
+// attempt 2/3".
+func attempt(op string, n, max int) string {
+	return fmt.Sprintf("%s attempt %d/%d", op, n, max)
+}
+
+// statusError returns an error for an unexpected status of a response.
+func statusError(status string) error {
+	return fmt.Errorf("status %s", status)
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ostcar/oswstest/config"
+)
+
+// Element identifies an element of a collection, like "agenda/item" 1.
+type Element struct {
+	Collection string
+	ID         string
+}
+
+func (e Element) String() string {
+	return e.Collection + ":" + e.ID
+}
+
+// FetchElements fetches the data of elements from the REST API. It uses a new
+// client of the user ProvisionUsername, so the data is not influenced by the
+// tested clients. Elements, that do not exist on the server, are missing in
+// the returned map.
+func FetchElements(ctx context.Context, cfg *config.Config, elements []Element) (map[Element]interface{}, error) {
+	admin, err := provisionClient(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make(map[Element]interface{}, len(elements))
+	for _, element := range elements {
+		v, found, err := admin.fetchElement(ctx, element)
+		if err != nil {
+			return nil, fmt.Errorf("can not fetch %s: %s", element, err)
+		}
+		if found {
+			data[element] = v
+		}
+	}
+	return data, nil
+}
+
+// fetchElement fetches the data of one element. found is false, if the server
+// responds with 404.
+func (c *WSClient) fetchElement(ctx context.Context, element Element) (v interface{}, found bool, err error) {
+	path := fmt.Sprintf("%s%s/%s/", c.cfg.RESTURLPath, element.Collection, element.ID)
+	req, err := http.NewRequestWithContext(ctx, "GET", c.cfg.HTTPURL(path), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := c.doAuthRequest(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, false, nil
+	case resp.StatusCode != 200:
+		return nil, false, fmt.Errorf("status: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return nil, false, fmt.Errorf("can not decode data: %s", err)
+	}
+	return v, true, nil
+}
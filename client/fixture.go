@@ -0,0 +1,172 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strconv"
+
+	"github.com/ostcar/oswstest/config"
+)
+
+// Fixture is a snapshot of the data of some collections on the server, so
+// destructive tests can start with the same data each time.
+type Fixture struct {
+	// Collections are the elements of each collection, like "agenda/item".
+	Collections map[string][]map[string]interface{} `json:"collections"`
+}
+
+// dependentCollections are the collections, which elements are created and
+// deleted with other elements. An agenda item belongs to its topic or motion,
+// so it is only updated.
+var dependentCollections = map[string]bool{"agenda/item": true}
+
+// ExportFixture fetches all elements of the collections FixtureCollections
+// with the user ProvisionUsername.
+func ExportFixture(ctx context.Context, cfg *config.Config) (*Fixture, error) {
+	admin, err := provisionClient(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Fixture{Collections: make(map[string][]map[string]interface{})}
+	for _, collection := range cfg.FixtureCollections {
+		elements, err := admin.listElements(ctx, collection)
+		if err != nil {
+			return nil, fmt.Errorf("can not export %s: %s", collection, err)
+		}
+		f.Collections[collection] = elements
+	}
+	return f, nil
+}
+
+// ImportFixture sets the collections FixtureCollections on the server back to
+// the fixture. The collections are changed in this order. Elements, that are
+// not in the fixture, are deleted, the other elements are updated. Elements,
+// that were deleted on the server, are created again, but get a new id.
+// Collections, that are not in the fixture, and the user ProvisionUsername are
+// not changed.
+func ImportFixture(ctx context.Context, cfg *config.Config, f *Fixture) error {
+	admin, err := provisionClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, collection := range cfg.FixtureCollections {
+		elements, ok := f.Collections[collection]
+		if !ok {
+			continue
+		}
+		if err := admin.importCollection(ctx, collection, elements); err != nil {
+			return fmt.Errorf("can not import %s: %s", collection, err)
+		}
+	}
+	return nil
+}
+
+// importCollection sets one collection back to the elements.
+func (c *WSClient) importCollection(ctx context.Context, collection string, elements []map[string]interface{}) error {
+	current, err := c.listElements(ctx, collection)
+	if err != nil {
+		return err
+	}
+	onServer := make(map[string]bool, len(current))
+	for _, element := range current {
+		onServer[elementID(element)] = true
+	}
+	inFixture := make(map[string]bool, len(elements))
+	for _, element := range elements {
+		inFixture[elementID(element)] = true
+	}
+
+	url := c.cfg.HTTPURL(c.cfg.RESTURLPath + collection + "/")
+	if !dependentCollections[collection] {
+		for _, element := range current {
+			id := elementID(element)
+			if inFixture[id] || c.isProvisionUser(collection, element) {
+				continue
+			}
+			if err := c.restRequest(ctx, "DELETE", url+id+"/", nil, nil); err != nil {
+				return fmt.Errorf("can not delete %s: %s", id, err)
+			}
+		}
+	}
+
+	var created int
+	for _, element := range elements {
+		id := elementID(element)
+		if c.isProvisionUser(collection, element) {
+			continue
+		}
+		if onServer[id] {
+			if err := c.restRequest(ctx, "PUT", url+id+"/", element, nil); err != nil {
+				return fmt.Errorf("can not update %s: %s", id, err)
+			}
+			continue
+		}
+		if dependentCollections[collection] {
+			continue
+		}
+		data := make(map[string]interface{}, len(element))
+		for k, v := range element {
+			if k != "id" {
+				data[k] = v
+			}
+		}
+		if err := c.restRequest(ctx, "POST", url, data, nil); err != nil {
+			return fmt.Errorf("can not create %s: %s", id, err)
+		}
+		created++
+	}
+	if created > 0 {
+		log.Printf("Created %d elements of %s again with new ids.", created, collection)
+	}
+	return nil
+}
+
+// isProvisionUser returns true, if the element is the user ProvisionUsername.
+func (c *WSClient) isProvisionUser(collection string, element map[string]interface{}) bool {
+	return collection == "users/user" && element["username"] == c.cfg.ProvisionUsername
+}
+
+// listElements returns all elements of a collection.
+func (c *WSClient) listElements(ctx context.Context, collection string) ([]map[string]interface{}, error) {
+	var elements []map[string]interface{}
+	if err := c.restRequest(ctx, "GET", c.cfg.HTTPURL(c.cfg.RESTURLPath+collection+"/"), nil, &elements); err != nil {
+		return nil, err
+	}
+	return elements, nil
+}
+
+// elementID returns the id of an element as string.
+func elementID(element map[string]interface{}) string {
+	if id, ok := element["id"].(float64); ok {
+		// Without this, big ids would be formatted like 1e+06.
+		return strconv.FormatFloat(id, 'f', -1, 64)
+	}
+	return fmt.Sprint(element["id"])
+}
+
+// LoadFixture reads a fixture from a json file.
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f Fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("can not decode fixture %s: %s", path, err)
+	}
+	return &f, nil
+}
+
+// WriteFixture writes a fixture to a json file.
+func WriteFixture(path string, f *Fixture) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"net/http"
+	"time"
+)
+
+// HTTPObserver gets the status code and the duration of each http request of
+// a client. If the request failed without a response, status is 0 and err is
+// set.
+type HTTPObserver func(status int, duration time.Duration, err error)
+
+// observingTransport gives each request to the http observer of the client.
+// Before, it waits for the rate limits of all clients and of the client and
+// for the simulated latency.
+type observingTransport struct {
+	c *WSClient
+}
+
+func (t observingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := globalBucket(t.c.cfg).wait(req.Context()); err != nil {
+		return nil, err
+	}
+	if err := t.c.limiter.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	if err := t.c.sleepLatency(req.Context()); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	t.c.observeHTTP(resp, time.Since(start), err)
+	return resp, err
+}
+
+// httpClient returns a http client with the cookies of the client. Each
+// request is observed, also the ones, that are retried.
+func (c *WSClient) httpClient() *http.Client {
+	return &http.Client{
+		Jar:       c.cookies,
+		Transport: observingTransport{c: c},
+	}
+}
+
+// observeHTTP gives a response to the http observer, if there is one.
+func (c *WSClient) observeHTTP(resp *http.Response, duration time.Duration, err error) {
+	if c.httpObserver == nil {
+		return
+	}
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+		err = nil
+	}
+	c.httpObserver(status, duration, err)
+}
+
+// SetHTTPObserver sets a function, that gets the status code of each http
+// request, including the websocket handshake.
+func (c *WSClient) SetHTTPObserver(observe HTTPObserver) {
+	c.httpObserver = observe
+}
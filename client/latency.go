@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// latency returns the simulated network latency of one operation: Latency and
+// a random time up to LatencyJitter.
+func (c *WSClient) latency() time.Duration {
+	d := c.cfg.Latency
+	if c.cfg.LatencyJitter > 0 {
+		d += time.Duration(rand.Int63n(int64(c.cfg.LatencyJitter)))
+	}
+	return d
+}
+
+// sleepLatency waits the simulated latency before a request or a websocket
+// message is send. It returns the error of ctx, if ctx is done before.
+func (c *WSClient) sleepLatency(ctx context.Context) error {
+	d := c.latency()
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// deliverAt returns the time, a message, that is received now, is given to
+// the tests. With a simulated latency, this is later, but never before a
+// message, that was received before. The read loop does not wait, so the
+// epoll clients, that share a read loop, do not slow down each other.
+func (c *WSClient) deliverAt() time.Time {
+	now := time.Now()
+	d := c.latency()
+	if d <= 0 {
+		return now
+	}
+
+	c.latencyMu.Lock()
+	defer c.latencyMu.Unlock()
+	at := now.Add(d)
+	if at.Before(c.lastDelivery) {
+		at = c.lastDelivery
+	}
+	c.lastDelivery = at
+	return at
+}
+
+// awaitDelivery waits, until a message from the queue may be given to the
+// tests. It returns false, if timeout fires before, and the error of ctx, if
+// ctx is done before. A nil timeout never fires.
+func (c *WSClient) awaitDelivery(ctx context.Context, m queued, timeout <-chan time.Time) (bool, error) {
+	d := time.Until(m.at)
+	if d <= 0 {
+		return true, nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true, nil
+	case <-timeout:
+		return false, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
@@ -0,0 +1,31 @@
+package client
+
+import "sync/atomic"
+
+// Counters of the running goroutines of all clients. They are used to find
+// goroutines, that do not end.
+var (
+	readLoops int64
+	expects   int64
+)
+
+// trackReadLoop counts a running read loop. The returned function has to be
+// called, when the loop ends.
+func trackReadLoop() func() {
+	atomic.AddInt64(&readLoops, 1)
+	return func() { atomic.AddInt64(&readLoops, -1) }
+}
+
+// trackExpect counts a running call of ExpectData or ExpectClose. The returned
+// function has to be called, when the call returns.
+func trackExpect() func() {
+	atomic.AddInt64(&expects, 1)
+	return func() { atomic.AddInt64(&expects, -1) }
+}
+
+// Running returns the number of read loops and of calls of ExpectData and
+// ExpectClose of all clients, that are running. Each connected client has one
+// read loop. Between the tests, there should be no running calls.
+func Running() (readLoopCount, expectCount int) {
+	return int(atomic.LoadInt64(&readLoops)), int(atomic.LoadInt64(&expects))
+}
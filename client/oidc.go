@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// oidcTokenResponse is the response of the token endpoint of an OIDC provider.
+type oidcTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	Error        string `json:"error"`
+	Description  string `json:"error_description"`
+}
+
+// oidcToken sends a request to the token endpoint of the OIDC provider and
+// returns the access token and its expiration time. The refresh token of the
+// client is updated.
+func (c *WSClient) oidcToken(ctx context.Context, form url.Values) (string, time.Time, error) {
+	form.Set("client_id", c.cfg.OIDCClientID)
+	if c.cfg.OIDCClientSecret != "" {
+		form.Set("client_secret", c.cfg.OIDCClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.cfg.OIDCTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpClient := c.httpClient()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	var body oidcTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", time.Time{}, fmt.Errorf("can not decode token response for client %s: %s", c, err)
+	}
+	if resp.StatusCode != 200 || body.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("token request for client %s failed: StatusCode: %d, %s %s", c, resp.StatusCode, body.Error, body.Description)
+	}
+
+	if body.RefreshToken != "" {
+		c.oidcRefreshToken = body.RefreshToken
+	}
+	var expires time.Time
+	if body.ExpiresIn > 0 {
+		expires = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+	return body.AccessToken, expires, nil
+}
+
+// oidcLogin logs the client in at the OIDC provider with the resource owner
+// password credentials grant.
+func (c *WSClient) oidcLogin(ctx context.Context) error {
+	token, expires, err := c.oidcToken(ctx, url.Values{
+		"grant_type": {"password"},
+		"username":   {c.username},
+		"password":   {c.password},
+		"scope":      {c.cfg.OIDCScope},
+	})
+	if err != nil {
+		return err
+	}
+	c.tokens.setWithExpiry(token, expires)
+	return c.setTokenCookie(token)
+}
+
+// oidcRefresh gets a new access token with the refresh token of the client.
+func (c *WSClient) oidcRefresh() (string, time.Time, error) {
+	if c.oidcRefreshToken == "" {
+		return "", time.Time{}, fmt.Errorf("client %s has no refresh token", c)
+	}
+	token, expires, err := c.oidcToken(context.Background(), url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {c.oidcRefreshToken},
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expires, c.setTokenCookie(token)
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ostcar/oswstest/config"
+	"github.com/ostcar/oswstest/fakedata"
+)
+
+// newFakeGenerator returns the generator of the fake data of an admin client
+// or nil, if WritePayload is not "fake" or "template". With a FakeSeed, each
+// client gets the same data in each run.
+func newFakeGenerator(cfg *config.Config, username string) *fakedata.Generator {
+	if cfg.WritePayload != "fake" && cfg.WritePayload != "template" {
+		return nil
+	}
+	seed := time.Now().UnixNano()
+	if cfg.FakeSeed != 0 {
+		seed = cfg.FakeSeed
+	}
+	h := fnv.New64a()
+	h.Write([]byte(username))
+	return fakedata.New(seed^int64(h.Sum64()), cfg.FakeVocabulary)
+}
+
+// getFakeSendRequest returns the write request with a fake title and a fake
+// text as comment. The comment starts with the marker.
+func getFakeSendRequest(ctx context.Context, cfg *config.Config, marker string, fake *fakedata.Generator) (*http.Request, error) {
+	length := cfg.FakeTextLength
+	if cfg.WritePayloadSize > 0 {
+		length = cfg.WritePayloadSize
+	}
+	comment := marker
+	if len(comment) < length {
+		if comment != "" {
+			comment += " "
+		}
+		comment += fake.Text(length - len(comment))
+	}
+
+	title := fake.Title()
+	body, err := json.Marshal(map[string]interface{}{
+		"id":                  cfg.WriteItemID,
+		"item_number":         "",
+		"title":               title,
+		"list_view_title":     title + " (" + fake.Name() + ")",
+		"comment":             comment,
+		"closed":              false,
+		"type":                1,
+		"is_hidden":           false,
+		"duration":            nil,
+		"speaker_list_closed": false,
+		"content_object":      map[string]interface{}{"collection": "topics/topic", "id": 1},
+		"weight":              10000,
+		"parent_id":           nil,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return http.NewRequestWithContext(ctx, "PUT", writeItemURL(cfg), strings.NewReader(string(body)))
+}
@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ostcar/oswstest/tracing"
+)
+
+// PollingClient is a client that receives its data by HTTP long-polling
+// instead of a websocket connection. Everything else (login, sending,
+// ExpectData) is the same as for the websocket client.
+type PollingClient struct {
+	*WSClient
+	httpClient *http.Client
+
+	// ctx is canceled by Close. There is a new context for each Connect.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewPollingClient turns a client into a polling client.
+func NewPollingClient(c *WSClient) *PollingClient {
+	return &PollingClient{
+		WSClient: c,
+		httpClient: &http.Client{
+			Jar:       c.cookies,
+			Transport: observingTransport{c: c},
+			Timeout:   c.cfg.PollTimeout,
+		},
+	}
+}
+
+func (c *PollingClient) String() string {
+	return c.WSClient.String() + " (polling)"
+}
+
+// errServerFull is returned by poll, if the server answered with 503.
+var errServerFull = errors.New("server is full")
+
+// poll does one poll request. It returns the body of the response or nil, if
+// the server had no data for the client. If the server is full, it returns
+// errServerFull.
+func (c *PollingClient) poll() ([]byte, error) {
+	req, err := http.NewRequestWithContext(c.ctx, "GET", c.cfg.HTTPURL(c.cfg.PollURLPath), nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.authorize(req.Header); err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		// The poll request timed out on the server side without new data.
+		return nil, nil
+	case resp.StatusCode == 503:
+		return nil, errServerFull
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return nil, statusError(resp.Status)
+	}
+
+	body, err := readMessage(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) == 0 {
+		releaseMessage(body)
+		return nil, nil
+	}
+	return body, nil
+}
+
+// Connect does the first poll request, which returns the initial data. It
+// blocks until this first request is answered. Afterwards it polls in the
+// background. The context only cancels the first request.
+func (c *PollingClient) Connect(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "connect", "client", c.String())
+	defer func() { span.End(err) }()
+
+	c.setStatus(StatusConnecting)
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	defer cancelOnDone(ctx, c.cancel)()
+
+	var data []byte
+	pollURL := c.cfg.HTTPURL(c.cfg.PollURLPath)
+	start := time.Now()
+	errorCount := 0
+	for errorCount < c.cfg.MaxConnectionAttemts && ctx.Err() == nil {
+		data, err = c.poll()
+		if err == errServerFull {
+			// The server is full. Try again later. This does not count as error.
+			c.backOff(ctx, 100*time.Millisecond)
+			continue
+		}
+		if err != nil {
+			errorCount++
+			err = c.opError(attempt("poll", errorCount, c.cfg.MaxConnectionAttemts), pollURL, start, err)
+			continue
+		}
+		break
+	}
+	if err != nil {
+		c.cancel()
+		log.Printf("Could not connect, %s\n", err)
+		c.setStatus(StatusFailed)
+		return err
+	}
+
+	c.setConnected()
+
+	done := c.startReadLoop()
+	go func() {
+		// Write all incomming data into the queue like the websocket client does.
+		defer done()
+		if data != nil {
+			c.push(data)
+		}
+		for {
+			select {
+			case <-time.After(c.cfg.PollInterval):
+			case <-c.ctx.Done():
+				return
+			}
+			data, err := c.poll()
+			if err == errServerFull {
+				c.backOff(c.ctx, 100*time.Millisecond)
+				continue
+			}
+			if err != nil {
+				c.setClosed(err)
+				break
+			}
+			if data != nil {
+				c.push(data)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/ostcar/oswstest/config"
+	"github.com/ostcar/oswstest/pool"
+)
+
+// passwordChars are the characters used for generated passwords.
+const passwordChars = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789!#%+-_"
+
+// GeneratePassword returns a random password with the given length.
+func GeneratePassword(length int) (string, error) {
+	password := make([]byte, length)
+	max := big.NewInt(int64(len(passwordChars)))
+	for i := range password {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("can not generate password: %s", err)
+		}
+		password[i] = passwordChars[n.Int64()]
+	}
+	return string(password), nil
+}
+
+// provisionClient returns a logged-in client of the user ProvisionUsername.
+func provisionClient(ctx context.Context, cfg *config.Config) (*WSClient, error) {
+	admin := NewAdminClient(cfg, cfg.ProvisionUsername, cfg.ProvisionPassword)
+	if err := admin.Login(ctx); err != nil {
+		return nil, fmt.Errorf("can not login provision user: %s", err)
+	}
+	return admin, nil
+}
+
+// userIDs returns the ids of all users on the server by there username.
+func (c *WSClient) userIDs(ctx context.Context) (map[string]int, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.cfg.HTTPURL(c.cfg.UserURLPath), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.doAuthRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("can not get users, status: %s", resp.Status)
+	}
+
+	var users []struct {
+		ID       int    `json:"id"`
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+		return nil, fmt.Errorf("can not decode users: %s", err)
+	}
+	ids := make(map[string]int, len(users))
+	for _, user := range users {
+		ids[user.Username] = user.ID
+	}
+	return ids, nil
+}
+
+// setPassword sets the password of the user with the given id.
+func (c *WSClient) setPassword(ctx context.Context, id int, password string) error {
+	data, err := json.Marshal(map[string]string{"password": password})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"POST",
+		fmt.Sprintf("%s%d/reset_password/", c.cfg.HTTPURL(c.cfg.UserURLPath), id),
+		strings.NewReader(string(data)),
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json;charset=UTF-8")
+	resp, err := c.doAuthRequest(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("can not set password of user %d, status: %s", id, resp.Status)
+	}
+	return nil
+}
+
+// SetPasswords sets the passwords of all credentials on the server. The users
+// have to exist.
+func SetPasswords(ctx context.Context, cfg *config.Config, credentials []Credential) error {
+	admin, err := provisionClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	ids, err := admin.userIDs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, c := range credentials {
+		id, ok := ids[c.Username]
+		if !ok {
+			return fmt.Errorf("user %s does not exist on the server", c.Username)
+		}
+		if err := admin.setPassword(ctx, id, c.Password); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateUsers creates the users of the credentials, that do not exist on the
+// server, with there password. Admins get the groups AdminGroupIDs, the other
+// users UserGroupIDs. Existing users are not changed, so it can be called
+// before each run. The users are created with ParallelLogins requests at the
+// same time. Returns the number of created users.
+func CreateUsers(ctx context.Context, cfg *config.Config, credentials []Credential) (int, error) {
+	admin, err := provisionClient(ctx, cfg)
+	if err != nil {
+		return 0, err
+	}
+	ids, err := admin.userIDs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var missing []Credential
+	for _, c := range credentials {
+		if _, ok := ids[c.Username]; !ok {
+			missing = append(missing, c)
+		}
+	}
+
+	p := &pool.Pool{Size: cfg.ParallelLogins, StopOnError: true}
+	err = p.Run(ctx, len(missing), func(ctx context.Context, i int) error {
+		groups := cfg.UserGroupIDs
+		if missing[i].Role == "admin" {
+			groups = cfg.AdminGroupIDs
+		}
+		return admin.createUser(ctx, missing[i], groups)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(missing), nil
+}
+
+// CleanupUsers deletes the users with the usernames or sets them inactive,
+// depending on CleanupUsers. Users, that do not exist, and the user
+// ProvisionUsername are skipped. Returns the number of changed users.
+func CleanupUsers(ctx context.Context, cfg *config.Config, usernames []string) (int, error) {
+	if cfg.CleanupUsers != "delete" && cfg.CleanupUsers != "deactivate" {
+		return 0, fmt.Errorf("unknown cleanup of users: %s", cfg.CleanupUsers)
+	}
+	admin, err := provisionClient(ctx, cfg)
+	if err != nil {
+		return 0, err
+	}
+	ids, err := admin.userIDs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var found []int
+	for _, username := range usernames {
+		if id, ok := ids[username]; ok && username != cfg.ProvisionUsername {
+			found = append(found, id)
+		}
+	}
+
+	p := &pool.Pool{Size: cfg.ParallelLogins, StopOnError: true}
+	err = p.Run(ctx, len(found), func(ctx context.Context, i int) error {
+		url := fmt.Sprintf("%s%d/", cfg.HTTPURL(cfg.UserURLPath), found[i])
+		if cfg.CleanupUsers == "delete" {
+			if err := admin.restRequest(ctx, "DELETE", url, nil, nil); err != nil {
+				return fmt.Errorf("can not delete user %d: %s", found[i], err)
+			}
+			return nil
+		}
+		if err := admin.restRequest(ctx, "PATCH", url, map[string]bool{"is_active": false}, nil); err != nil {
+			return fmt.Errorf("can not deactivate user %d: %s", found[i], err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(found), nil
+}
+
+// createUser creates a user with a password and groups.
+func (c *WSClient) createUser(ctx context.Context, credential Credential, groups []int) error {
+	if groups == nil {
+		groups = []int{}
+	}
+	body := map[string]interface{}{
+		"username":         credential.Username,
+		"first_name":       credential.Username,
+		"default_password": credential.Password,
+		"groups_id":        groups,
+	}
+	if err := c.restRequest(ctx, "POST", c.cfg.HTTPURL(c.cfg.UserURLPath), body, nil); err != nil {
+		return fmt.Errorf("can not create user %s: %s", credential.Username, err)
+	}
+	return nil
+}
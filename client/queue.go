@@ -0,0 +1,46 @@
+package client
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// queued is a received message in the queue of a client with the time, it was
+// received. With a simulated latency, at is the time, it may be read.
+type queued struct {
+	data []byte
+	at   time.Time
+}
+
+// QueueStats show, how far a test was behind the messages of a client. If a
+// test reads slower then the messages come in, the messages wait longer in the
+// queue, until it is full and messages are dropped.
+type QueueStats struct {
+	// Dropped is the number of messages, that were dropped, because the queue
+	// was full.
+	Dropped int
+
+	// MaxWait is the longest time, a message waited in the queue, until a
+	// test read it.
+	MaxWait time.Duration
+}
+
+// noteWait remembers the time, a message waited in the queue, if it is longer
+// then before.
+func (c *WSClient) noteWait(m queued) {
+	wait := int64(time.Since(m.at))
+	for {
+		max := atomic.LoadInt64(&c.queueWait)
+		if wait <= max || atomic.CompareAndSwapInt64(&c.queueWait, max, wait) {
+			return
+		}
+	}
+}
+
+// TakeQueueStats returns the statistics of the queue since the last call.
+func (c *WSClient) TakeQueueStats() QueueStats {
+	return QueueStats{
+		Dropped: int(atomic.SwapInt64(&c.dropped, 0)),
+		MaxWait: time.Duration(atomic.SwapInt64(&c.queueWait, 0)),
+	}
+}
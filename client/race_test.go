@@ -0,0 +1,8 @@
+//go:build race
+// +build race
+
+package client
+
+// raceEnabled is true, if the tests run with the race detector. It makes
+// sync.Pool drop items at random, so the buffers are allocated again.
+const raceEnabled = true
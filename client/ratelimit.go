@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ostcar/oswstest/config"
+)
+
+// tokenBucket limits the rate of http requests. It can be used from many
+// goroutines. A nil tokenBucket does not limit.
+//
+// Requests, that come faster then the rate, take tokens in advance and wait
+// until there turn. So the requests keep the exact rate also when many
+// clients wait at the same time.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full bucket for rate requests per second. Up to
+// burst requests can be done at once. Returns nil, if rate is not positive.
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// wait blocks until a request can be done. It returns the error of ctx, if
+// ctx is done before.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var (
+	globalBucketsMu sync.Mutex
+	globalBuckets   = make(map[*config.Config]*tokenBucket)
+)
+
+// globalBucket returns the bucket, that all clients of a configuration share.
+func globalBucket(cfg *config.Config) *tokenBucket {
+	globalBucketsMu.Lock()
+	defer globalBucketsMu.Unlock()
+	b, ok := globalBuckets[cfg]
+	if !ok {
+		b = newTokenBucket(cfg.RequestRate, cfg.RequestBurst)
+		globalBuckets[cfg] = b
+	}
+	return b
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/ostcar/oswstest/tracing"
+)
+
+// ReplayClient is a client, that can send any request or websocket message,
+// like the recorded actions of a browser.
+type ReplayClient interface {
+	Client
+
+	// Request sends a request to the path with the session of the client.
+	// The body is send as json, if it is not empty.
+	Request(ctx context.Context, method, path string, body []byte) error
+
+	// SendMessage sends a message over the websocket connection. It fails for
+	// the other transports. The context cancels the simulated latency.
+	SendMessage(ctx context.Context, data []byte) error
+}
+
+// Request sends a request to the path with the session of the client. The
+// path has no leading slash. A response with an other status then 2xx is an
+// error.
+func (c *WSClient) Request(ctx context.Context, method, path string, body []byte) (err error) {
+	ctx, span := tracing.Start(ctx, "request", "client", c.String())
+	defer func() { span.End(err) }()
+
+	start := time.Now()
+	url := c.cfg.HTTPURL(path)
+	var r io.Reader
+	if len(body) > 0 {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
+	if err != nil {
+		return c.opError("request", url, start, err)
+	}
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", "application/json;charset=UTF-8")
+	}
+	tracing.Inject(ctx, req.Header)
+	resp, err := c.doAuthRequest(req)
+	if err != nil {
+		return c.opError("request", url, start, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return c.opError("request", url, start, statusError(resp.Status))
+	}
+	return nil
+}
+
+// SendMessage sends a text message over the websocket connection.
+func (c *WSClient) SendMessage(ctx context.Context, data []byte) error {
+	if c.Status() != StatusConnected {
+		return errors.New("the client is not connected")
+	}
+	if c.wsConnection == nil {
+		return errors.New("the client has no websocket connection")
+	}
+
+	if err := c.sleepLatency(ctx); err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.wsConnection.WriteMessage(websocket.TextMessage, data)
+}
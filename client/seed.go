@@ -0,0 +1,243 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ostcar/oswstest/config"
+	"github.com/ostcar/oswstest/fakedata"
+	"github.com/ostcar/oswstest/pool"
+)
+
+// writeItemURL returns the url of the agenda item, that the write requests
+// change.
+func writeItemURL(cfg *config.Config) string {
+	return cfg.HTTPURL(fmt.Sprintf("%sagenda/item/%d/", cfg.RESTURLPath, cfg.WriteItemID))
+}
+
+// ServerState is the agenda item of the write requests before the run and the
+// topics, that were created for it and by DataVolume. Restore sets it back
+// after the run.
+type ServerState struct {
+	cfg *config.Config
+
+	// item is the data of the agenda item before the run. It is nil, if the
+	// item was created.
+	item interface{}
+
+	// topic is the id of the created topic or 0.
+	topic int
+
+	// inflated are the ids of the topics, that were created for DataVolume.
+	inflated []int
+}
+
+// Prepare creates the agenda item WriteItemID, if it does not exist and Seed
+// is true, so the write requests do not get 404 on a fresh OpenSlides. The
+// item is created with a topic by the user ProvisionUsername. If the new item
+// gets an other id, WriteItemID is changed to it.
+//
+// If DataVolume is set, topics are created, until the server has DataVolume
+// topics.
+//
+// If RestoreState is true, the data of the item is remembered, so it can be
+// restored after the run. Returns nil, if neither Seed nor RestoreState nor
+// DataVolume is set.
+func Prepare(ctx context.Context, cfg *config.Config) (*ServerState, error) {
+	if !cfg.Seed && !cfg.RestoreState && cfg.DataVolume == 0 {
+		return nil, nil
+	}
+	admin, err := provisionClient(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &ServerState{cfg: cfg}
+	if state.inflated, err = admin.inflate(ctx); err != nil {
+		// The run does not start, so the topics, that were already created,
+		// are deleted at once. ctx can be canceled by an interrupt.
+		deleteCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if dErr := admin.deleteTopics(deleteCtx, state.inflated); dErr != nil {
+			log.Printf("Can not delete the created topics, %s", dErr)
+		}
+		return nil, err
+	}
+	item := Element{Collection: "agenda/item", ID: strconv.Itoa(cfg.WriteItemID)}
+	data, found, err := admin.fetchElement(ctx, item)
+	if err != nil {
+		return nil, fmt.Errorf("can not fetch %s: %s", item, err)
+	}
+	if found {
+		state.item = data
+		return state, nil
+	}
+	if !cfg.Seed {
+		return state, nil
+	}
+
+	topic, id, err := admin.createTopic(ctx, "oswstest", "")
+	if err != nil {
+		return nil, err
+	}
+	state.topic = topic
+	if id != cfg.WriteItemID {
+		log.Printf("Agenda item %d does not exist, the write requests change the new agenda item %d.", cfg.WriteItemID, id)
+		cfg.WriteItemID = id
+	} else {
+		log.Printf("Created agenda item %d.", id)
+	}
+	return state, nil
+}
+
+// Restore sets the agenda item back to its data before the run and deletes
+// the topic, that Prepare created. It uses a new login of the user
+// ProvisionUsername, because the run can take longer then the session.
+// Does nothing, if s is nil or RestoreState is false.
+func (s *ServerState) Restore(ctx context.Context) error {
+	if s == nil || !s.cfg.RestoreState || (s.item == nil && s.topic == 0 && len(s.inflated) == 0) {
+		return nil
+	}
+	admin, err := provisionClient(ctx, s.cfg)
+	if err != nil {
+		return err
+	}
+
+	if len(s.inflated) > 0 {
+		if err := admin.deleteTopics(ctx, s.inflated); err != nil {
+			return err
+		}
+		log.Printf("Deleted the %d topics of the data volume.", len(s.inflated))
+	}
+
+	if s.topic != 0 {
+		url := fmt.Sprintf("%s%d/", s.cfg.HTTPURL(s.cfg.TopicURLPath), s.topic)
+		if err := admin.restRequest(ctx, "DELETE", url, nil, nil); err != nil {
+			return fmt.Errorf("can not delete topic %d: %s", s.topic, err)
+		}
+		log.Printf("Deleted topic %d.", s.topic)
+		return nil
+	}
+
+	if err := admin.restRequest(ctx, "PUT", writeItemURL(s.cfg), s.item, nil); err != nil {
+		return fmt.Errorf("can not restore agenda item %d: %s", s.cfg.WriteItemID, err)
+	}
+	log.Printf("Restored agenda item %d.", s.cfg.WriteItemID)
+	return nil
+}
+
+// inflate creates topics with a fake title and a fake text of
+// DataVolumeTextSize bytes, until the server has DataVolume topics. Returns
+// the ids of the created topics. If it fails, it returns the ids of the topics,
+// that were created before, with the error.
+func (c *WSClient) inflate(ctx context.Context) ([]int, error) {
+	if c.cfg.DataVolume == 0 {
+		return nil, nil
+	}
+	var topics []struct {
+		ID int `json:"id"`
+	}
+	if err := c.restRequest(ctx, "GET", c.cfg.HTTPURL(c.cfg.TopicURLPath), nil, &topics); err != nil {
+		return nil, fmt.Errorf("can not get topics: %s", err)
+	}
+	missing := c.cfg.DataVolume - len(topics)
+	if missing <= 0 {
+		return nil, nil
+	}
+
+	seed := time.Now().UnixNano()
+	if c.cfg.FakeSeed != 0 {
+		seed = c.cfg.FakeSeed
+	}
+	fake := fakedata.New(seed, c.cfg.FakeVocabulary)
+	ids := make([]int, missing)
+	p := &pool.Pool{Size: c.cfg.ParallelLogins, StopOnError: true}
+	err := p.Run(ctx, missing, func(ctx context.Context, i int) error {
+		id, _, err := c.createTopic(ctx, fake.Title(), fake.Text(c.cfg.DataVolumeTextSize))
+		ids[i] = id
+		return err
+	})
+
+	var created []int
+	for _, id := range ids {
+		if id != 0 {
+			created = append(created, id)
+		}
+	}
+	if err != nil {
+		return created, err
+	}
+	log.Printf("Created %d topics, the server has %d topics now.", missing, c.cfg.DataVolume)
+	return created, nil
+}
+
+// deleteTopics deletes the topics with the ids.
+func (c *WSClient) deleteTopics(ctx context.Context, ids []int) error {
+	p := &pool.Pool{Size: c.cfg.ParallelLogins, StopOnError: true}
+	return p.Run(ctx, len(ids), func(ctx context.Context, i int) error {
+		url := fmt.Sprintf("%s%d/", c.cfg.HTTPURL(c.cfg.TopicURLPath), ids[i])
+		if err := c.restRequest(ctx, "DELETE", url, nil, nil); err != nil {
+			return fmt.Errorf("can not delete topic %d: %s", ids[i], err)
+		}
+		return nil
+	})
+}
+
+// createTopic creates a topic and returns its id and the id of its agenda
+// item.
+func (c *WSClient) createTopic(ctx context.Context, title, text string) (topic, item int, err error) {
+	var created struct {
+		ID           int `json:"id"`
+		AgendaItemID int `json:"agenda_item_id"`
+	}
+	body := map[string]interface{}{"title": title, "text": text, "agenda_type": 1}
+	if err := c.restRequest(ctx, "POST", c.cfg.HTTPURL(c.cfg.TopicURLPath), body, &created); err != nil {
+		return 0, 0, fmt.Errorf("can not create topic: %s", err)
+	}
+	if created.AgendaItemID == 0 {
+		return created.ID, 0, fmt.Errorf("the new topic has no agenda item")
+	}
+	return created.ID, created.AgendaItemID, nil
+}
+
+// restRequest sends body as json to the REST API and decodes the response into
+// response, if it is not nil.
+func (c *WSClient) restRequest(ctx context.Context, method, url string, body, response interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json;charset=UTF-8")
+	}
+	resp, err := c.doAuthRequest(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status: %s", resp.Status)
+	}
+	if response == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("can not decode response: %s", err)
+	}
+	return nil
+}
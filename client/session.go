@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/ostcar/oswstest/config"
+	"github.com/ostcar/oswstest/pool"
+)
+
+// session is the saved authentication of one client.
+type session struct {
+	Cookies []*http.Cookie `json:"cookies"`
+	Token   string         `json:"token,omitempty"`
+}
+
+// sessionClient is a client, that can save and restore its session.
+type sessionClient interface {
+	Client
+	session() (username string, s session, err error)
+	restoreSession(ctx context.Context, sessions map[string]session) error
+}
+
+// rootURL returns the url, the session cookies are saved for.
+func (c *WSClient) rootURL() (*url.URL, error) {
+	u, err := url.Parse(c.cfg.HTTPURL(c.cfg.LoginURLPath))
+	if err != nil {
+		return nil, fmt.Errorf("can not parse login url: %s", err)
+	}
+	u.Path = "/"
+	return u, nil
+}
+
+// session returns the username and the current session of the client.
+func (c *WSClient) session() (string, session, error) {
+	root, err := c.rootURL()
+	if err != nil {
+		return "", session{}, err
+	}
+	var cookies []*http.Cookie
+	for _, cookie := range c.cookies.Cookies(root) {
+		cookies = append(cookies, &http.Cookie{Name: cookie.Name, Value: cookie.Value, Path: "/"})
+	}
+	token, _ := c.token()
+	return c.username, session{Cookies: cookies, Token: token}, nil
+}
+
+// restoreSession sets the cookies and the token of the saved session of the
+// client and checks that the server still accepts them. Returns an error, if
+// there is no session for the client or if it is not valid anymore.
+func (c *WSClient) restoreSession(ctx context.Context, sessions map[string]session) error {
+	s, ok := sessions[c.username]
+	if !ok || !c.isAuth {
+		return fmt.Errorf("no session for client %s", c)
+	}
+	root, err := c.rootURL()
+	if err != nil {
+		return err
+	}
+	c.cookies.SetCookies(root, s.Cookies)
+	if s.Token != "" {
+		c.tokens.set(s.Token)
+	}
+
+	httpClient := c.httpClient()
+	req, err := http.NewRequestWithContext(ctx, "GET", c.cfg.HTTPURL(c.cfg.SessionCheckURLPath), nil)
+	if err != nil {
+		return err
+	}
+	if err := c.authorize(req.Header); err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("session check failed: StatusCode: %d", resp.StatusCode)
+	}
+
+	// OpenSlides answers with user_id null, if the session is not valid.
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("can not decode session check response: %s", err)
+	}
+	if userID, ok := body["user_id"]; ok && userID == nil {
+		return fmt.Errorf("session is not valid anymore")
+	}
+	c.setLoggedIn(true)
+	return nil
+}
+
+// loadSessions reads the sessions from the SessionCacheFile. A missing file
+// is not an error.
+func loadSessions(cfg *config.Config) (map[string]session, error) {
+	sessions := make(map[string]session)
+	f, err := os.Open(cfg.SessionCacheFile)
+	if os.IsNotExist(err) {
+		return sessions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(&sessions); err != nil {
+		return nil, fmt.Errorf("can not decode session cache %s: %s", cfg.SessionCacheFile, err)
+	}
+	return sessions, nil
+}
+
+// SaveSessions writes the sessions of all logged-in clients to the
+// SessionCacheFile.
+func SaveSessions(cfg *config.Config, clients []Client) error {
+	sessions := make(map[string]session)
+	for _, client := range clients {
+		sc, ok := client.(sessionClient)
+		if !ok || !sc.IsAuth() {
+			continue
+		}
+		username, s, err := sc.session()
+		if err != nil {
+			return err
+		}
+		sessions[username] = s
+	}
+
+	f, err := os.OpenFile(cfg.SessionCacheFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(sessions)
+}
+
+// ReuseSessions restores the cached sessions for a slice of clients. It
+// returns the clients, that have no valid session and have to login. The
+// sessions are checked with ParallelLogins requests at the same time.
+func ReuseSessions(ctx context.Context, cfg *config.Config, clients []Client) (needLogin []Client) {
+	sessions, err := loadSessions(cfg)
+	if err != nil {
+		log.Printf("Can not load sessions, %s", err)
+		return clients
+	}
+
+	// Each worker only writes the index of its client.
+	restored := make([]bool, len(clients))
+	pool.New(cfg.ParallelLogins).Run(ctx, len(clients), func(ctx context.Context, i int) error {
+		sc, ok := clients[i].(sessionClient)
+		restored[i] = ok && sc.restoreSession(ctx, sessions) == nil
+		return nil
+	})
+	for i, client := range clients {
+		if !restored[i] {
+			needLogin = append(needLogin, client)
+		}
+	}
+	return needLogin
+}
@@ -0,0 +1,132 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ostcar/oswstest/tracing"
+)
+
+// SSEClient is a client that receives its data from a server-sent events
+// stream instead of a websocket connection. Everything else (login, sending,
+// ExpectData) is the same as for the websocket client.
+type SSEClient struct {
+	*WSClient
+	resp *http.Response
+
+	// cancel ends the event stream. There is a new one for each Connect.
+	cancel context.CancelFunc
+}
+
+// NewSSEClient turns a client into a server-sent events client.
+func NewSSEClient(c *WSClient) *SSEClient {
+	return &SSEClient{WSClient: c}
+}
+
+func (c *SSEClient) String() string {
+	return c.WSClient.String() + " (sse)"
+}
+
+// Connect opens the event stream. It blocks until the server has accepted the
+// stream. The events are read in the background. The context only cancels the
+// connecting.
+func (c *SSEClient) Connect(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "connect", "client", c.String())
+	defer func() { span.End(err) }()
+
+	c.setStatus(StatusConnecting)
+	var streamCtx context.Context
+	streamCtx, c.cancel = context.WithCancel(context.Background())
+	defer cancelOnDone(ctx, c.cancel)()
+
+	httpClient := c.httpClient()
+	sseURL := c.cfg.HTTPURL(c.cfg.SSEURLPath)
+	start := time.Now()
+	errorCount := 0
+	for errorCount < c.cfg.MaxConnectionAttemts && ctx.Err() == nil {
+		var req *http.Request
+		req, err = http.NewRequestWithContext(streamCtx, "GET", sseURL, nil)
+		if err != nil {
+			err = c.opError("event stream", sseURL, start, err)
+			break
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		tracing.Inject(ctx, req.Header)
+		if err = c.authorize(req.Header); err != nil {
+			err = c.opError("event stream", sseURL, start, err)
+			break
+		}
+		c.resp, err = httpClient.Do(req)
+		if err != nil {
+			errorCount++
+			err = c.opError(attempt("event stream", errorCount, c.cfg.MaxConnectionAttemts), sseURL, start, err)
+			continue
+		}
+		if c.resp.StatusCode == 503 {
+			// The server is full. Try again later. This does not count as error.
+			c.resp.Body.Close()
+			c.backOff(ctx, 100*time.Millisecond)
+			continue
+		}
+		if c.resp.StatusCode != 200 {
+			c.resp.Body.Close()
+			errorCount++
+			err = c.opError(attempt("event stream", errorCount, c.cfg.MaxConnectionAttemts), sseURL, start, statusError(c.resp.Status))
+			continue
+		}
+		// if no error happend, then we can break the loop
+		break
+	}
+	if err != nil {
+		c.cancel()
+		log.Printf("Could not connect, %s\n", err)
+		c.setStatus(StatusFailed)
+		return err
+	}
+
+	c.setConnected()
+
+	done := c.startReadLoop()
+	go func() {
+		// Write the data of all incomming events into the queue like the
+		// websocket client does.
+		defer done()
+		defer c.resp.Body.Close()
+		scanner := bufio.NewScanner(c.resp.Body)
+		scanner.Buffer(nil, c.cfg.SSEMaxEventSize)
+		// hasData is set by the first data line of an event. A bare "data:"
+		// line has no value, so len(data) can not be used for this.
+		var data []byte
+		var hasData bool
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			switch {
+			case len(line) == 0:
+				// An empty line ends the event.
+				if hasData {
+					c.push(data)
+					data = nil
+					hasData = false
+				}
+			case bytes.HasPrefix(line, []byte("data:")):
+				value := bytes.TrimPrefix(bytes.TrimPrefix(line, []byte("data:")), []byte(" "))
+				if hasData {
+					data = append(data, '\n')
+				}
+				data = append(data, value...)
+				hasData = true
+			}
+			// Other fields (event, id, retry) and comments are ignored.
+		}
+		err := scanner.Err()
+		if err == nil {
+			err = errStreamClosed
+		}
+		c.setClosed(err)
+	}()
+	return nil
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// State is a snapshot of a client. It shows, why a client did not finish a
+// test.
+type State struct {
+	Status    Status
+	Connected bool
+
+	// CloseInfo is set, if the connection was closed.
+	CloseInfo *CloseInfo
+
+	// Received is the number of messages, the client got since it connected.
+	// Queued are the messages of them, that were not read by a test yet.
+	Received int
+	Queued   int
+
+	// Expecting is true, while ExpectData or ExpectClose runs. Got and Want
+	// are the messages of the running ExpectData.
+	Expecting bool
+	Got       int
+	Want      int
+}
+
+func (s State) String() string {
+	var parts []string
+	if s.Status == StatusClosed && s.CloseInfo != nil {
+		parts = append(parts, "closed: "+s.CloseInfo.Reason)
+	} else {
+		parts = append(parts, s.Status.String())
+	}
+	parts = append(parts, fmt.Sprintf("received %d messages, %d queued", s.Received, s.Queued))
+	if s.Expecting {
+		if s.Want > 0 {
+			parts = append(parts, fmt.Sprintf("waits for data, got %d of %d", s.Got, s.Want))
+		} else {
+			parts = append(parts, "waits for the close")
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// expectState is the state of a running ExpectData or ExpectClose.
+type expectState struct {
+	running bool
+	got     int
+	want    int
+}
+
+// beginExpect marks, that ExpectData with want messages or ExpectClose (with
+// want 0) runs. The returned function marks the end.
+func (c *WSClient) beginExpect(want int) func() {
+	c.mu.Lock()
+	c.expect = expectState{running: true, want: want}
+	c.mu.Unlock()
+	return func() {
+		c.mu.Lock()
+		c.expect = expectState{}
+		c.mu.Unlock()
+	}
+}
+
+// State returns a snapshot of the client.
+func (c *WSClient) State() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return State{
+		Status:    c.status,
+		Connected: c.status == StatusConnected || c.status == StatusClosed,
+		CloseInfo: c.closeInfo,
+		Received:  int(atomic.LoadInt64(&c.received)),
+		Queued:    len(c.queue),
+		Expecting: c.expect.running,
+		Got:       c.expect.got,
+		Want:      c.expect.want,
+	}
+}
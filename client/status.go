@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"fmt"
+)
+
+// Status is the state of the login and the connection of a client. The
+// changes are:
+//
+//	created    -> logged in   by Login or a restored session
+//	logged in  -> created     by Logout
+//	any        -> connecting  by Connect
+//	connecting -> connected   when the connection is established
+//	connecting -> failed      when all attempts of Connect failed
+//	connected  -> closed      when the connection is closed by the server or by Close
+//
+// A client, that is connecting, connected or closed, stays in its status on
+// Login and Logout.
+type Status int
+
+// The statuses of a client.
+const (
+	StatusCreated Status = iota
+	StatusLoggedIn
+	StatusConnecting
+	StatusConnected
+	StatusClosed
+	StatusFailed
+)
+
+var statusNames = [...]string{"created", "logged in", "connecting", "connected", "closed", "failed"}
+
+func (s Status) String() string {
+	if s < 0 || int(s) >= len(statusNames) {
+		return fmt.Sprintf("status %d", int(s))
+	}
+	return statusNames[s]
+}
+
+// setStatusLocked changes the status and wakes up all calls of WaitStatus.
+// c.mu has to be locked.
+func (c *WSClient) setStatusLocked(s Status) {
+	c.status = s
+	if c.statusChanged != nil {
+		close(c.statusChanged)
+	}
+	c.statusChanged = make(chan struct{})
+}
+
+// setStatus changes the status.
+func (c *WSClient) setStatus(s Status) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setStatusLocked(s)
+}
+
+// setLoggedIn changes the status between created and logged in. Other
+// statuses are not changed.
+func (c *WSClient) setLoggedIn(loggedIn bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case loggedIn && c.status == StatusCreated:
+		c.setStatusLocked(StatusLoggedIn)
+	case !loggedIn && c.status == StatusLoggedIn:
+		c.setStatusLocked(StatusCreated)
+	}
+}
+
+// Status returns the current status of the client.
+func (c *WSClient) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// WaitStatus blocks, until the client has one of the statuses, and returns it.
+// If the context is done before, it returns the current status and the error
+// of the context.
+func (c *WSClient) WaitStatus(ctx context.Context, statuses ...Status) (Status, error) {
+	for {
+		c.mu.Lock()
+		current, changed := c.status, c.statusChanged
+		if changed == nil {
+			changed = make(chan struct{})
+			c.statusChanged = changed
+		}
+		c.mu.Unlock()
+
+		for _, s := range statuses {
+			if current == s {
+				return current, nil
+			}
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return current, ctx.Err()
+		}
+	}
+}
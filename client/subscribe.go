@@ -0,0 +1,65 @@
+package client
+
+import (
+	"sync/atomic"
+)
+
+// Subscription gets a copy of each message, that a client receives. Unlike
+// ExpectData, a subscription does not take the messages from the queue of the
+// client, so there can be many subscriptions at the same time and they do not
+// change the results of the tests.
+type Subscription struct {
+	// C gets the messages. It is closed by Unsubscribe.
+	C <-chan []byte
+
+	c       chan []byte
+	dropped int64
+}
+
+// Dropped returns the number of messages, that were dropped, because C was
+// full.
+func (s *Subscription) Dropped() int {
+	return int(atomic.LoadInt64(&s.dropped))
+}
+
+// Subscribe returns a subscription with size places for the received messages.
+// When it is full, new messages are dropped for this subscription only, so a
+// slow subscriber does not stall the client. The subscription stays, when the
+// client reconnects. It has to be ended with Unsubscribe.
+func (c *WSClient) Subscribe(size int) *Subscription {
+	ch := make(chan []byte, size)
+	s := &Subscription{C: ch, c: ch}
+	c.subMu.Lock()
+	c.subscribers = append(c.subscribers, s)
+	c.subMu.Unlock()
+	return s
+}
+
+// Unsubscribe ends a subscription and closes its channel. It does nothing, if
+// the subscription is already ended.
+func (c *WSClient) Unsubscribe(s *Subscription) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	for i, other := range c.subscribers {
+		if other == s {
+			c.subscribers = append(c.subscribers[:i], c.subscribers[i+1:]...)
+			close(s.c)
+			return
+		}
+	}
+}
+
+// publish sends a copy of a received message to all subscriptions. The copy is
+// needed, because the buffer of the message is reused after ExpectData has
+// read it.
+func (c *WSClient) publish(data []byte) {
+	c.subMu.RLock()
+	defer c.subMu.RUnlock()
+	for _, s := range c.subscribers {
+		select {
+		case s.c <- append([]byte(nil), data...):
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/ostcar/oswstest/config"
+)
+
+// PayloadData are the variables of the payload template.
+type PayloadData struct {
+	// ClientID is the username of the client.
+	ClientID string
+
+	// Iteration is the number of the write request of the client, starting
+	// with 1.
+	Iteration int64
+
+	// Timestamp is the time, the request is created.
+	Timestamp time.Time
+
+	// Marker is the marker of the request or empty. The propagation check
+	// finds a request only, if the marker is in the payload.
+	Marker string
+
+	// ItemID is WriteItemID.
+	ItemID int
+}
+
+// letters are the characters of randString.
+const letters = "abcdefghijklmnopqrstuvwxyz"
+
+// templates are the parsed payload templates by there file.
+var (
+	templatesMu sync.Mutex
+	templates   = make(map[string]*template.Template)
+)
+
+// payloadTemplate returns the parsed template WritePayloadTemplate. It is
+// parsed only once.
+func payloadTemplate(cfg *config.Config) (*template.Template, error) {
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+	if t, ok := templates[cfg.WritePayloadTemplate]; ok {
+		return t, nil
+	}
+	if cfg.WritePayloadTemplate == "" {
+		return nil, fmt.Errorf("the write payload is a template, but there is no template file")
+	}
+
+	// The fake functions are replaced by the generator of each client.
+	t, err := template.New(filepath.Base(cfg.WritePayloadTemplate)).
+		Funcs(templateFuncs(nil)).
+		ParseFiles(cfg.WritePayloadTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("can not parse payload template: %s", err)
+	}
+	templates[cfg.WritePayloadTemplate] = t
+	return t, nil
+}
+
+// CheckPayloadTemplate parses the template WritePayloadTemplate, if
+// WritePayload is "template", so an invalid template is found before the run.
+func CheckPayloadTemplate(cfg *config.Config) error {
+	if cfg.WritePayload != "template" {
+		return nil
+	}
+	_, err := payloadTemplate(cfg)
+	return err
+}
+
+// templateFuncs are the functions of the payload templates:
+//
+//	json v            v as json, like a quoted and escaped string
+//	randInt min max   a random number from min to max-1
+//	randString n      a random string of n letters
+//	fakeName          a random name of a person
+//	fakeTitle         a random title of a motion or an amendment
+//	fakeText n        a random text of n bytes
+func templateFuncs(c *WSClient) template.FuncMap {
+	return template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"randInt": func(min, max int) int {
+			if max <= min {
+				return min
+			}
+			return min + rand.Intn(max-min)
+		},
+		"randString": func(n int) string {
+			b := make([]byte, n)
+			for i := range b {
+				b[i] = letters[rand.Intn(len(letters))]
+			}
+			return string(b)
+		},
+		"fakeName": func() string {
+			return c.fake.Name()
+		},
+		"fakeTitle": func() string {
+			return c.fake.Title()
+		},
+		"fakeText": func(n int) string {
+			return c.fake.Text(n)
+		},
+	}
+}
+
+// getTemplateSendRequest returns the write request with the payload template
+// as body.
+func (c *WSClient) getTemplateSendRequest(ctx context.Context, marker string) (*http.Request, error) {
+	t, err := payloadTemplate(c.cfg)
+	if err != nil {
+		return nil, err
+	}
+	t, err = t.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	data := PayloadData{
+		ClientID:  c.String(),
+		Iteration: atomic.AddInt64(&c.sent, 1),
+		Timestamp: time.Now(),
+		Marker:    marker,
+		ItemID:    c.cfg.WriteItemID,
+	}
+	var body bytes.Buffer
+	if err := t.Funcs(templateFuncs(c)).Execute(&body, data); err != nil {
+		return nil, fmt.Errorf("can not execute payload template: %s", err)
+	}
+	return http.NewRequestWithContext(ctx, "PUT", writeItemURL(c.cfg), &body)
+}
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenManager holds the authentication token of one client. It is shared by
+// the http requests and the websocket connection of the client and refreshes
+// the token shortly before it expires.
+type tokenManager struct {
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// set saves a new token. If the token is a JWT with an exp claim, the
+// expiration time is read from it. Other tokens never expire.
+func (m *tokenManager) set(token string) {
+	m.setWithExpiry(token, time.Time{})
+}
+
+// setWithExpiry saves a new token, that expires at the given time. If expires
+// is the zero time, it is read from the token like in set.
+func (m *tokenManager) setWithExpiry(token string, expires time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.token = token
+	m.expires = expires
+	if expires.IsZero() {
+		m.expires = jwtExpires(token)
+	}
+}
+
+// get returns the current token. If the token expires in less then margin,
+// refresh is called with the old token to get a new one and its expiration
+// time. Returns an empty string, if there is no token.
+func (m *tokenManager) get(margin time.Duration, refresh func(old string) (string, time.Time, error)) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.token == "" || m.expires.IsZero() || time.Until(m.expires) > margin {
+		return m.token, nil
+	}
+
+	token, expires, err := refresh(m.token)
+	if err != nil {
+		return "", err
+	}
+	m.token = token
+	m.expires = expires
+	if expires.IsZero() {
+		m.expires = jwtExpires(token)
+	}
+	return token, nil
+}
+
+// jwtExpires returns the time from the exp claim of a JWT. Returns the zero
+// time, if the token is no JWT or has no exp claim.
+func jwtExpires(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+// token returns the current token of the client and refreshes it if needed.
+func (c *WSClient) token() (string, error) {
+	return c.tokens.get(c.cfg.TokenRefreshMargin, c.refreshToken)
+}
+
+// websocketURL returns the url for the websocket connection of the client. If
+// TokenQueryParam is set, the token is added to the query.
+func (c *WSClient) websocketURL() (string, error) {
+	token, err := c.token()
+	if err != nil {
+		return "", err
+	}
+	if token == "" || c.cfg.TokenQueryParam == "" {
+		return c.cfg.WSURL(c.cfg.WSURLPath), nil
+	}
+	return c.cfg.WSURL(c.cfg.WSURLPath) + "?" + url.Values{c.cfg.TokenQueryParam: {token}}.Encode(), nil
+}
+
+// authorize adds the authentication token to the header of a request. Does
+// nothing, if the client has no token.
+func (c *WSClient) authorize(header http.Header) error {
+	token, err := c.token()
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		header.Set(c.cfg.TokenHeader, c.cfg.TokenPrefix+token)
+	}
+	return nil
+}
+
+// setTokenFromResponse reads the token from the response of a login or
+// refresh request. With AuthMode "token" the token is in the json body, with
+// "os4" it is in the TokenHeader of the response.
+func (c *WSClient) setTokenFromResponse(resp *http.Response) error {
+	token, err := c.readToken(resp)
+	if err != nil {
+		return err
+	}
+	c.tokens.set(token)
+	return c.setTokenCookie(token)
+}
+
+func (c *WSClient) readToken(resp *http.Response) (string, error) {
+	if c.cfg.AuthMode == "os4" {
+		token := resp.Header.Get(c.cfg.TokenHeader)
+		if len(token) >= len(c.cfg.TokenPrefix) && strings.EqualFold(token[:len(c.cfg.TokenPrefix)], c.cfg.TokenPrefix) {
+			token = token[len(c.cfg.TokenPrefix):]
+		}
+		if token == "" {
+			return "", fmt.Errorf("response for client %s has no token in header %s", c, c.cfg.TokenHeader)
+		}
+		return token, nil
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("can not decode login response for client %s: %s", c, err)
+	}
+	token, ok := body[c.cfg.TokenJSONField].(string)
+	if !ok || token == "" {
+		return "", fmt.Errorf("login response for client %s has no token in field %s", c, c.cfg.TokenJSONField)
+	}
+	return token, nil
+}
+
+// setTokenCookie saves the token as cookie, so it is send with the websocket
+// handshake. Does nothing, if TokenCookieName is empty.
+func (c *WSClient) setTokenCookie(token string) error {
+	if c.cfg.TokenCookieName == "" {
+		return nil
+	}
+	u, err := url.Parse(c.cfg.HTTPURL(c.cfg.LoginURLPath))
+	if err != nil {
+		return err
+	}
+	u.Path = "/"
+	c.cookies.SetCookies(u, []*http.Cookie{{Name: c.cfg.TokenCookieName, Value: token, Path: "/"}})
+	return nil
+}
+
+// refreshToken gets a new access token from the auth service. The auth service
+// identifies the client by its refresh cookie, that was set at the login. With
+// AuthMode "oidc" the refresh token is send to the OIDC provider.
+func (c *WSClient) refreshToken(old string) (string, time.Time, error) {
+	if c.cfg.AuthMode == "oidc" {
+		return c.oidcRefresh()
+	}
+
+	httpClient := c.httpClient()
+	req, err := http.NewRequest("POST", c.cfg.HTTPURL(c.cfg.TokenRefreshURLPath), nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set(c.cfg.TokenHeader, c.cfg.TokenPrefix+old)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("can not refresh token for client %s: %s", c, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", time.Time{}, fmt.Errorf("token refresh for client %s failed: StatusCode: %d", c, resp.StatusCode)
+	}
+
+	token, err := c.readToken(resp)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, time.Time{}, c.setTokenCookie(token)
+}
@@ -0,0 +1,17 @@
+package client
+
+import (
+	"github.com/OneOfOne/xxhash"
+)
+
+// hashData returns the hash of the data. If the data is json, it is
+// canonicalized before, so the same json with a different key order, other
+// whitespace or an other notation of a number has the same hash.
+func hashData(data []byte) uint64 {
+	c := canonicalizers.Get().(*canonicalizer)
+	defer canonicalizers.Put(c)
+	if canonical, err := c.canonical(data); err == nil {
+		data = canonical
+	}
+	return xxhash.Checksum64(data)
+}
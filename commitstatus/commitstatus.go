@@ -0,0 +1,246 @@
+// Package commitstatus posts the verdict of a run as commit status or check
+// run to GitHub or GitLab, so the performance gates are shown on the pull
+// request or merge request.
+//
+// The repository, the commit, the token and the url of the api are taken from
+// the environment of GitHub Actions or GitLab CI, if they are not given. See
+// Parse.
+package commitstatus
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ostcar/oswstest/compare"
+	"github.com/ostcar/oswstest/result"
+	"github.com/ostcar/oswstest/slo"
+)
+
+// Reporter posts the state of a run for a commit.
+type Reporter interface {
+	// Start marks the commit as pending.
+	Start() error
+
+	// Finish posts the verdict. The title is one line with the key metrics,
+	// the text is the summary of all tests in markdown.
+	Finish(success bool, title, text string) error
+}
+
+// Options are the values of a reporter. Empty values are taken from the
+// environment.
+type Options struct {
+	// Repo is owner/repository for GitHub or the id or path of the project
+	// for GitLab.
+	Repo string
+
+	// SHA is the commit.
+	SHA string
+
+	// Name is the name of the status or the check run, like "oswstest".
+	Name string
+}
+
+// Parse returns the reporter of a kind. The kinds are:
+//
+//	github        a commit status on GitHub
+//	github-check  a check run on GitHub with the summary of all tests
+//	gitlab        a commit status on GitLab
+//
+// On GitHub, the defaults are GITHUB_REPOSITORY, GITHUB_SHA, GITHUB_API_URL
+// and the token GITHUB_TOKEN. On GitLab, they are CI_PROJECT_ID,
+// CI_COMMIT_SHA, CI_API_V4_URL and the token GITLAB_TOKEN. The token is only
+// read from the environment, so it is not shown in the process list.
+func Parse(kind string, opts Options) (Reporter, error) {
+	if opts.Name == "" {
+		opts.Name = "oswstest"
+	}
+	switch kind {
+	case "github", "github-check":
+		gh := &GitHub{
+			API:   envOr("GITHUB_API_URL", "https://api.github.com"),
+			Repo:  valueOr(opts.Repo, os.Getenv("GITHUB_REPOSITORY")),
+			SHA:   valueOr(opts.SHA, os.Getenv("GITHUB_SHA")),
+			Token: os.Getenv("GITHUB_TOKEN"),
+			Name:  opts.Name,
+			Check: kind == "github-check",
+		}
+		if server, run := os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_RUN_ID"); server != "" && run != "" {
+			gh.TargetURL = fmt.Sprintf("%s/%s/actions/runs/%s", server, gh.Repo, run)
+		}
+		return gh, check(kind, gh.Repo, gh.SHA, gh.Token, "GITHUB_REPOSITORY", "GITHUB_SHA", "GITHUB_TOKEN")
+	case "gitlab":
+		gl := &GitLab{
+			API:       envOr("CI_API_V4_URL", "https://gitlab.com/api/v4"),
+			Project:   valueOr(opts.Repo, os.Getenv("CI_PROJECT_ID")),
+			SHA:       valueOr(opts.SHA, os.Getenv("CI_COMMIT_SHA")),
+			Token:     os.Getenv("GITLAB_TOKEN"),
+			Name:      opts.Name,
+			TargetURL: os.Getenv("CI_JOB_URL"),
+		}
+		return gl, check(kind, gl.Project, gl.SHA, gl.Token, "CI_PROJECT_ID", "CI_COMMIT_SHA", "GITLAB_TOKEN")
+	default:
+		return nil, fmt.Errorf("unknown commit status %q, it has to be github, github-check or gitlab", kind)
+	}
+}
+
+// check returns an error, if the repository, the commit or the token is
+// missing.
+func check(kind, repo, sha, token, repoEnv, shaEnv, tokenEnv string) error {
+	switch {
+	case repo == "":
+		return fmt.Errorf("%s needs the repository, set -commit-repo or %s", kind, repoEnv)
+	case sha == "":
+		return fmt.Errorf("%s needs the commit, set -commit-sha or %s", kind, shaEnv)
+	case token == "":
+		return fmt.Errorf("%s needs a token in %s", kind, tokenEnv)
+	}
+	return nil
+}
+
+func envOr(name, value string) string {
+	return valueOr(os.Getenv(name), value)
+}
+
+func valueOr(value, fallback string) string {
+	if value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Sink is a result.Sink, that marks the commit as pending, when it is
+// created, and posts the verdict, when it is closed. The run fails, if a SLO
+// is not met or a result is worse then the baseline, like the exit code.
+//
+// It has to be after the slo.Checker and the compare.Gate in the list of
+// sinks, so they have seen all results.
+type Sink struct {
+	reporter Reporter
+	checker  *slo.Checker
+	gate     *compare.Gate
+
+	lines   bytes.Buffer
+	summary *result.SummarySink
+	tests   int
+	samples int
+	errors  int
+
+	// slowest is the result with the highest 95th percentile.
+	slowest     string
+	slowestP95  time.Duration
+	slowestTest string
+}
+
+// NewSink creates a Sink and marks the commit as pending. If that fails, it
+// is only logged. The checker and the gate can be nil.
+func NewSink(reporter Reporter, checker *slo.Checker, gate *compare.Gate) *Sink {
+	s := &Sink{reporter: reporter, checker: checker, gate: gate}
+	s.summary = result.NewSummarySink(&s.lines)
+	if err := reporter.Start(); err != nil {
+		log.Printf("Can not set the commit status to pending, %s", err)
+	}
+	return s
+}
+
+// Publish adds the results of a test to the summary.
+func (s *Sink) Publish(test string, results []*result.TestResult) error {
+	s.tests++
+	for _, r := range results {
+		s.samples += r.Count()
+		s.errors += r.ErrCount()
+		if p95 := r.Percentile(95); r.Count() > 0 && p95 > s.slowestP95 {
+			s.slowest, s.slowestP95, s.slowestTest = r.Description(), p95, test
+		}
+	}
+	return s.summary.Publish(test, results)
+}
+
+// Close posts the verdict.
+func (s *Sink) Close() error {
+	var violations []slo.Violation
+	if s.checker != nil {
+		violations = s.checker.Violations()
+	}
+	regressions := s.gate.Regressions()
+
+	var title string
+	switch {
+	case len(violations) > 0 && len(regressions) > 0:
+		title = fmt.Sprintf("%d SLOs not met, %d results worse then the baseline", len(violations), len(regressions))
+	case len(violations) > 0:
+		title = fmt.Sprintf("%d SLOs not met: %s", len(violations), violations[0])
+	case len(regressions) > 0:
+		title = fmt.Sprintf("%d results worse then the baseline: %s", len(regressions), regressions[0])
+	default:
+		title = fmt.Sprintf("%d tests, %d samples, %d errors", s.tests, s.samples, s.errors)
+		if s.slowest != "" {
+			title += fmt.Sprintf(", slowest p95 %s (%s %s)", s.slowestP95.Round(time.Millisecond), s.slowestTest, s.slowest)
+		}
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "```\n%s```\n", s.lines.String())
+	if len(violations) > 0 {
+		text.WriteString("\n**SLOs not met**\n\n")
+		for _, v := range violations {
+			fmt.Fprintf(&text, "* %s\n", v)
+		}
+	}
+	if len(regressions) > 0 {
+		text.WriteString("\n**Worse then the baseline**\n\n")
+		for _, r := range regressions {
+			fmt.Fprintf(&text, "* %s\n", r)
+		}
+	}
+
+	success := len(violations) == 0 && len(regressions) == 0
+	if err := s.reporter.Finish(success, title, text.String()); err != nil {
+		return fmt.Errorf("can not post the commit status: %s", err)
+	}
+	return nil
+}
+
+// post sends a json request to an api and decodes the response into
+// response, if it is not nil.
+func post(method, url string, header http.Header, body, response interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s returned %s", method, url, resp.Status)
+	}
+	if response == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// truncate shortens s to max characters, because the description of a
+// commit status has a maximum length.
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-3]) + "..."
+}
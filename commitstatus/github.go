@@ -0,0 +1,110 @@
+package commitstatus
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// GitHub posts a commit status or, with Check, a check run to GitHub.
+type GitHub struct {
+	API       string
+	Repo      string
+	SHA       string
+	Token     string
+	Name      string
+	TargetURL string
+
+	// If Check is true, a check run with the summary of all tests is created
+	// instead of a commit status. The token needs the permission checks:write.
+	Check bool
+
+	// checkRun is the id of the check run, that was created by Start.
+	checkRun int64
+}
+
+// Start sets the status to pending or creates a check run in progress.
+func (g *GitHub) Start() error {
+	if !g.Check {
+		return g.status("pending", "The tests are running")
+	}
+
+	var response struct {
+		ID int64 `json:"id"`
+	}
+	body := map[string]interface{}{
+		"name":       g.Name,
+		"head_sha":   g.SHA,
+		"status":     "in_progress",
+		"started_at": time.Now().UTC().Format(time.RFC3339),
+	}
+	if g.TargetURL != "" {
+		body["details_url"] = g.TargetURL
+	}
+	err := post("POST", g.url("check-runs"), g.header(), body, &response)
+	if err != nil {
+		return err
+	}
+	g.checkRun = response.ID
+	return nil
+}
+
+// Finish sets the status to success or failure or completes the check run.
+// If Start could not create the check run, a completed one is created.
+func (g *GitHub) Finish(success bool, title, text string) error {
+	if !g.Check {
+		state := "failure"
+		if success {
+			state = "success"
+		}
+		return g.status(state, title)
+	}
+
+	conclusion := "failure"
+	if success {
+		conclusion = "success"
+	}
+	body := map[string]interface{}{
+		"name":         g.Name,
+		"status":       "completed",
+		"conclusion":   conclusion,
+		"completed_at": time.Now().UTC().Format(time.RFC3339),
+		"output": map[string]string{
+			"title":   truncate(title, 255),
+			"summary": truncate(text, 65535),
+		},
+	}
+	if g.TargetURL != "" {
+		body["details_url"] = g.TargetURL
+	}
+	if g.checkRun == 0 {
+		body["head_sha"] = g.SHA
+		return post("POST", g.url("check-runs"), g.header(), body, nil)
+	}
+	return post("PATCH", g.url(fmt.Sprintf("check-runs/%d", g.checkRun)), g.header(), body, nil)
+}
+
+// status posts a commit status. The description of GitHub can have 140
+// characters.
+func (g *GitHub) status(state, description string) error {
+	body := map[string]string{
+		"state":       state,
+		"context":     g.Name,
+		"description": truncate(description, 140),
+	}
+	if g.TargetURL != "" {
+		body["target_url"] = g.TargetURL
+	}
+	return post("POST", g.url("statuses/"+g.SHA), g.header(), body, nil)
+}
+
+func (g *GitHub) url(path string) string {
+	return fmt.Sprintf("%s/repos/%s/%s", g.API, g.Repo, path)
+}
+
+func (g *GitHub) header() http.Header {
+	h := make(http.Header)
+	h.Set("Authorization", "Bearer "+g.Token)
+	h.Set("Accept", "application/vnd.github+json")
+	return h
+}
@@ -0,0 +1,49 @@
+package commitstatus
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// GitLab posts a commit status to GitLab.
+type GitLab struct {
+	API       string
+	Project   string
+	SHA       string
+	Token     string
+	Name      string
+	TargetURL string
+}
+
+// Start sets the status to running.
+func (g *GitLab) Start() error {
+	return g.status("running", "The tests are running")
+}
+
+// Finish sets the status to success or failed. GitLab has no place for the
+// summary of the tests, only the title is shown.
+func (g *GitLab) Finish(success bool, title, text string) error {
+	state := "failed"
+	if success {
+		state = "success"
+	}
+	return g.status(state, title)
+}
+
+// status posts a commit status. The description of GitLab can have 255
+// characters.
+func (g *GitLab) status(state, description string) error {
+	h := make(http.Header)
+	h.Set("PRIVATE-TOKEN", g.Token)
+	u := fmt.Sprintf("%s/projects/%s/statuses/%s", g.API, url.PathEscape(g.Project), g.SHA)
+	body := map[string]string{
+		"state":       state,
+		"name":        g.Name,
+		"description": truncate(description, 255),
+	}
+	if g.TargetURL != "" {
+		body["target_url"] = g.TargetURL
+	}
+	return post("POST", u, h, body, nil)
+}
@@ -0,0 +1,420 @@
+// Package compare shows the differences between the results of two runs. A
+// run is read from a json file of the json result sink or from a database of
+// the package store.
+package compare
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ostcar/oswstest/result"
+	"github.com/ostcar/oswstest/store"
+)
+
+// ANSI codes of the highlighted rows.
+const (
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorReset = "\x1b[0m"
+)
+
+// Stats are the compared values of one result.
+type Stats struct {
+	Count  int
+	Errors int
+	Ave    time.Duration
+	P50    time.Duration
+	P95    time.Duration
+	P99    time.Duration
+	Max    time.Duration
+}
+
+// ErrorRate returns the part of the samples, that are errors.
+func (s Stats) ErrorRate() float64 {
+	if s.Count+s.Errors == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Count+s.Errors)
+}
+
+// statsOf returns the stats of a result.
+func statsOf(r *result.TestResult) Stats {
+	return Stats{
+		Count:  r.Count(),
+		Errors: r.ErrCount(),
+		Ave:    r.Ave(),
+		P50:    r.Percentile(50),
+		P95:    r.Percentile(95),
+		P99:    r.Percentile(99),
+		Max:    r.Max(),
+	}
+}
+
+// Entry is one result of a run.
+type Entry struct {
+	Test   string
+	Result string
+	Stats  Stats
+}
+
+// Run are the results of one run.
+type Run struct {
+	Name    string
+	Entries []Entry
+}
+
+// FromResults returns a run of results, like a result.Sink gets them.
+func FromResults(name string, tests []string, results [][]*result.TestResult) *Run {
+	run := &Run{Name: name}
+	for i, test := range tests {
+		for _, r := range results[i] {
+			run.Entries = append(run.Entries, Entry{Test: test, Result: r.Description(), Stats: statsOf(r)})
+		}
+	}
+	return run
+}
+
+// Load reads a run. The spec is the path of a json file of the json result
+// sink or a database with the id of a run, like sqlite:results.db#12 or
+// postgres:postgres://host/db#12. Without an id, the last run of the
+// database is read.
+func Load(spec string) (*Run, error) {
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, dsn := spec[:i], spec[i+1:]
+		if kind == "sqlite" || kind == "postgres" {
+			return loadStore(spec, kind, dsn)
+		}
+	}
+	return loadJSON(spec)
+}
+
+// loadStore reads a run from a database.
+func loadStore(spec, kind, dsn string) (*Run, error) {
+	var id int64
+	if i := strings.LastIndex(dsn, "#"); i >= 0 {
+		n, err := strconv.ParseInt(dsn[i+1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid run id in %s: %s", spec, err)
+		}
+		dsn, id = dsn[:i], n
+	}
+	id, results, err := store.LoadRun(kind, dsn, id)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &Run{Name: fmt.Sprintf("run %d", id)}
+	for _, r := range results {
+		run.Entries = append(run.Entries, Entry{
+			Test:   r.Test,
+			Result: r.Result,
+			Stats: Stats{
+				Count:  r.Count,
+				Errors: r.Errors,
+				Ave:    r.Ave,
+				P50:    r.P50,
+				P95:    r.P95,
+				P99:    r.P99,
+				Max:    r.Max,
+			},
+		})
+	}
+	return run, nil
+}
+
+// loadJSON reads a run from a file of the json result sink. The results are
+// build again from the samples or, for streaming results, from the
+// histogram.
+func loadJSON(path string) (*Run, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var report struct {
+		Tests []struct {
+			Name    string `json:"name"`
+			Results []struct {
+				Description string    `json:"description"`
+				Count       int       `json:"count"`
+				MinMS       float64   `json:"min_ms"`
+				MaxMS       float64   `json:"max_ms"`
+				AveMS       float64   `json:"ave_ms"`
+				Errors      []string  `json:"errors"`
+				SamplesMS   []float64 `json:"samples_ms"`
+				StdDevMS    float64   `json:"stddev_ms"`
+				Histogram   []struct {
+					LeMS  *float64 `json:"le_ms"`
+					Count int      `json:"count"`
+				} `json:"histogram"`
+			} `json:"results"`
+		} `json:"tests"`
+	}
+	if err := json.NewDecoder(f).Decode(&report); err != nil {
+		return nil, fmt.Errorf("can not read %s: %s", path, err)
+	}
+
+	run := &Run{Name: path}
+	for _, t := range report.Tests {
+		for _, jr := range t.Results {
+			var r *result.TestResult
+			if len(jr.SamplesMS) == jr.Count {
+				r = result.New(jr.Description)
+				for _, v := range jr.SamplesMS {
+					r.Add(fromMS(v))
+				}
+			} else {
+				stats := result.Stats{
+					Count: jr.Count,
+					Min:   fromMS(jr.MinMS),
+					Max:   fromMS(jr.MaxMS),
+					Mean:  float64(fromMS(jr.AveMS)),
+					M2:    math.Pow(float64(fromMS(jr.StdDevMS)), 2) * float64(jr.Count-1),
+				}
+				for _, b := range jr.Histogram {
+					stats.Buckets[bucketOf(b.LeMS)] += b.Count
+				}
+				r = result.NewStreaming(jr.Description)
+				r.AddStats(stats)
+			}
+			for _, e := range jr.Errors {
+				r.AddError(fmt.Errorf("%s", e))
+			}
+			run.Entries = append(run.Entries, Entry{Test: t.Name, Result: jr.Description, Stats: statsOf(r)})
+		}
+	}
+	return run, nil
+}
+
+// bucketOf returns the index of the histogram bucket with the upper bound le.
+// Without a bound, it is the last bucket.
+func bucketOf(le *float64) int {
+	if le != nil {
+		for i, bound := range result.HistogramBounds {
+			if bound == fromMS(*le) {
+				return i
+			}
+		}
+	}
+	return len(result.HistogramBounds)
+}
+
+// Delta is the difference of one result between two runs. Old or New is nil,
+// if the result is only in one run.
+type Delta struct {
+	Test   string
+	Result string
+	Old    *Stats
+	New    *Stats
+}
+
+// Diff returns the deltas of all results. The order is the order of the new
+// run, followed by the results, that are only in the old run.
+func Diff(old, new *Run) []Delta {
+	type key struct{ test, result string }
+	oldStats := make(map[key]*Stats)
+	for i := range old.Entries {
+		e := &old.Entries[i]
+		oldStats[key{e.Test, e.Result}] = &e.Stats
+	}
+
+	var deltas []Delta
+	seen := make(map[key]bool)
+	for i := range new.Entries {
+		e := &new.Entries[i]
+		k := key{e.Test, e.Result}
+		seen[k] = true
+		deltas = append(deltas, Delta{Test: e.Test, Result: e.Result, Old: oldStats[k], New: &e.Stats})
+	}
+	for _, e := range old.Entries {
+		if k := (key{e.Test, e.Result}); !seen[k] {
+			deltas = append(deltas, Delta{Test: e.Test, Result: e.Result, Old: oldStats[k]})
+		}
+	}
+	return deltas
+}
+
+// metric is a compared value of Stats.
+type metric struct {
+	name  string
+	value func(s Stats) float64
+	show  func(v float64) string
+}
+
+var metrics = []metric{
+	{"P50", func(s Stats) float64 { return float64(s.P50) }, showDuration},
+	{"P95", func(s Stats) float64 { return float64(s.P95) }, showDuration},
+	{"P99", func(s Stats) float64 { return float64(s.P99) }, showDuration},
+	{"ERRORS", func(s Stats) float64 { return s.ErrorRate() }, showRate},
+}
+
+func showDuration(v float64) string { return fmt.Sprintf("%dms", time.Duration(v)/time.Millisecond) }
+func showRate(v float64) string     { return fmt.Sprintf("%.2f%%", v*100) }
+
+// change returns the change from old to new in percent. It is +Inf, if old
+// is 0 and new is not.
+func change(old, new float64) float64 {
+	if old == 0 {
+		if new == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return (new - old) / old * 100
+}
+
+// Regressions returns the names of the metrics, that are more then percent
+// higher in the new run.
+func (d Delta) Regressions(percent float64) []string {
+	tolerances := make(map[string]float64)
+	for _, m := range metrics {
+		tolerances[strings.ToLower(m.name)] = percent
+	}
+	return d.Exceeds(tolerances)
+}
+
+// Exceeds returns the names of the metrics, that are more percent higher in
+// the new run then there tolerance. The keys of tolerances are the metrics
+// in lower case, like "p95" or "errors". Metrics without a tolerance are not
+// checked.
+func (d Delta) Exceeds(tolerances map[string]float64) []string {
+	if d.Old == nil || d.New == nil {
+		return nil
+	}
+	var names []string
+	for _, m := range metrics {
+		tolerance, ok := tolerances[strings.ToLower(m.name)]
+		if !ok {
+			continue
+		}
+		if change(m.value(*d.Old), m.value(*d.New)) > tolerance {
+			names = append(names, m.name)
+		}
+	}
+	return names
+}
+
+// Show returns the value of a metric in the old and the new run with the
+// change, like "95ms -> 200ms (+110.5%)".
+func (d Delta) Show(name string) string {
+	for _, m := range metrics {
+		if m.name != name || d.Old == nil || d.New == nil {
+			continue
+		}
+		o, n := m.value(*d.Old), m.value(*d.New)
+		return fmt.Sprintf("%s -> %s (%s)", m.show(o), m.show(n), showChange(change(o, n)))
+	}
+	return ""
+}
+
+// Improved returns true, if no metric is higher and one metric is more then
+// percent lower in the new run.
+func (d Delta) Improved(percent float64) bool {
+	if d.Old == nil || d.New == nil {
+		return false
+	}
+	var better bool
+	for _, m := range metrics {
+		c := change(m.value(*d.Old), m.value(*d.New))
+		if c > 0 {
+			return false
+		}
+		if c < -percent {
+			better = true
+		}
+	}
+	return better
+}
+
+// Write writes the deltas as table. Each metric is shown as "old -> new
+// (change)". Rows with a regression of more then percent are marked with
+// "!" and, if color is true, red. Improvements are green.
+func Write(w io.Writer, old, new *Run, deltas []Delta, percent float64, color bool) error {
+	header := []string{"", "TEST", "RESULT"}
+	for _, m := range metrics {
+		header = append(header, m.name)
+	}
+
+	rows := [][]string{header}
+	colors := []string{""}
+	var regressions int
+	for _, d := range deltas {
+		row := []string{"", d.Test, d.Result}
+		rowColor := ""
+		switch {
+		case d.Old == nil:
+			row[0] = "+"
+			for range metrics {
+				row = append(row, "new")
+			}
+		case d.New == nil:
+			row[0] = "-"
+			for range metrics {
+				row = append(row, "removed")
+			}
+		default:
+			for _, m := range metrics {
+				row = append(row, d.Show(m.name))
+			}
+			if len(d.Regressions(percent)) > 0 {
+				row[0] = "!"
+				rowColor = colorRed
+				regressions++
+			} else if d.Improved(percent) {
+				rowColor = colorGreen
+			}
+		}
+		rows = append(rows, row)
+		colors = append(colors, rowColor)
+	}
+
+	widths := make([]int, len(header))
+	for _, row := range rows {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Compare %s with %s\n\n", new.Name, old.Name)
+	for i, row := range rows {
+		parts := make([]string, len(row))
+		for j, cell := range row {
+			if j < 3 {
+				parts[j] = fmt.Sprintf("%-*s", widths[j], cell)
+				continue
+			}
+			parts[j] = fmt.Sprintf("%*s", widths[j], cell)
+		}
+		line := strings.TrimRight(strings.Join(parts, "  "), " ")
+		if color && colors[i] != "" {
+			line = colors[i] + line + colorReset
+		}
+		b.WriteString(line + "\n")
+	}
+	fmt.Fprintf(&b, "\n%d of %d results regressed by more then %g%%\n", regressions, len(deltas), percent)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// showChange formats a change in percent.
+func showChange(c float64) string {
+	if math.IsInf(c, 1) {
+		return "from 0"
+	}
+	return fmt.Sprintf("%+.1f%%", c)
+}
+
+// fromMS returns the duration of milliseconds.
+func fromMS(v float64) time.Duration {
+	return time.Duration(v * float64(time.Millisecond))
+}
@@ -0,0 +1,107 @@
+package compare
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ostcar/oswstest/result"
+	"github.com/ostcar/oswstest/store"
+)
+
+// LoadBaseline reads the baseline run. The spec is like in Load, but for a
+// database without the id of a run, the run is used, that was marked as
+// baseline.
+func LoadBaseline(spec string) (*Run, error) {
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, dsn := spec[:i], spec[i+1:]
+		if (kind == "sqlite" || kind == "postgres") && !strings.Contains(dsn, "#") {
+			id, err := store.Baseline(kind, dsn)
+			if err != nil {
+				return nil, err
+			}
+			return loadStore(spec, kind, dsn+"#"+strconv.FormatInt(id, 10))
+		}
+	}
+	return Load(spec)
+}
+
+// Regression is a result, that is worse then the baseline.
+type Regression struct {
+	Delta
+
+	// Metrics are the metrics, that are worse then there tolerance. It is
+	// empty, if the result is missing in the run.
+	Metrics []string
+}
+
+func (r Regression) String() string {
+	if r.New == nil {
+		return fmt.Sprintf("%s: %q is missing, it is in the baseline", r.Test, r.Result)
+	}
+	parts := make([]string, len(r.Metrics))
+	for i, m := range r.Metrics {
+		parts[i] = strings.ToLower(m) + " " + r.Show(m)
+	}
+	return fmt.Sprintf("%s: %q: %s", r.Test, r.Result, strings.Join(parts, ", "))
+}
+
+// Gate is a result.Sink, that compares the results with a baseline. Only the
+// tests, that have run, are compared. Closing it does nothing.
+type Gate struct {
+	baseline   *Run
+	tolerances map[string]float64
+	tests      []string
+	results    [][]*result.TestResult
+}
+
+// NewGate creates a gate for a baseline. The keys of tolerances are the
+// metrics in lower case, like "p95". Only these metrics are checked.
+func NewGate(baseline *Run, tolerances map[string]float64) *Gate {
+	return &Gate{baseline: baseline, tolerances: tolerances}
+}
+
+// Publish saves the results of one test.
+func (g *Gate) Publish(test string, results []*result.TestResult) error {
+	g.tests = append(g.tests, test)
+	g.results = append(g.results, results)
+	return nil
+}
+
+// Close does nothing.
+func (g *Gate) Close() error {
+	return nil
+}
+
+// Regressions returns the results, that are worse then the baseline, and the
+// results of the baseline, that are missing. It returns nil for a nil gate.
+func (g *Gate) Regressions() []Regression {
+	if g == nil {
+		return nil
+	}
+	ran := make(map[string]bool)
+	for _, test := range g.tests {
+		ran[test] = true
+	}
+	baseline := &Run{Name: g.baseline.Name}
+	for _, e := range g.baseline.Entries {
+		if ran[e.Test] {
+			baseline.Entries = append(baseline.Entries, e)
+		}
+	}
+
+	var regressions []Regression
+	for _, d := range Diff(baseline, FromResults("", g.tests, g.results)) {
+		if d.Old == nil {
+			continue
+		}
+		if d.New == nil {
+			regressions = append(regressions, Regression{Delta: d})
+			continue
+		}
+		if metrics := d.Exceeds(g.tolerances); len(metrics) > 0 {
+			regressions = append(regressions, Regression{Delta: d, Metrics: metrics})
+		}
+	}
+	return regressions
+}
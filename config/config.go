@@ -0,0 +1,1002 @@
+// Package config contains the configuration of oswstest.
+//
+// Use Default to get a configuration with the default values and change the
+// fields as needed.
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExternalTest is a test, that is run by an external executable.
+type ExternalTest struct {
+	// Name is the name of the test, that can be used in Config.Tests.
+	Name string
+
+	// Command is the executable with its arguments.
+	Command string
+	Args    []string
+}
+
+// Matrix runs a test for each combination of its parameters. An empty list
+// means, that the parameter is not changed.
+type Matrix struct {
+	// Name is the name of the matrix, that can be used in Config.Tests.
+	Name string
+
+	// Test is the name of the test, that is run.
+	Test string
+
+	// Clients are the numbers of clients. The test is run with the first
+	// clients.
+	Clients []int
+
+	// WriteRates are values for Config.WriteRate.
+	WriteRates []float64
+
+	// PayloadSizes are values for Config.WritePayloadSize.
+	PayloadSizes []int
+}
+
+// ParseMatrix parses a matrix like
+// "manywrite:clients=10,100:write_rate=1,5:payload_size=100,10000". The name of
+// the matrix is the name of the test with the suffix "-matrix".
+func ParseMatrix(s string) (Matrix, error) {
+	parts := strings.Split(s, ":")
+	m := Matrix{Name: parts[0] + "-matrix", Test: parts[0]}
+	if m.Test == "" {
+		return m, fmt.Errorf("matrix %q has no test", s)
+	}
+
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return m, fmt.Errorf("invalid matrix parameter %q", part)
+		}
+		for _, value := range strings.Split(kv[1], ",") {
+			var err error
+			switch kv[0] {
+			case "clients":
+				var v int
+				v, err = strconv.Atoi(value)
+				m.Clients = append(m.Clients, v)
+			case "write_rate":
+				var v float64
+				v, err = strconv.ParseFloat(value, 64)
+				m.WriteRates = append(m.WriteRates, v)
+			case "payload_size":
+				var v int
+				v, err = strconv.Atoi(value)
+				m.PayloadSizes = append(m.PayloadSizes, v)
+			default:
+				return m, fmt.Errorf("unknown matrix parameter %s", kv[0])
+			}
+			if err != nil {
+				return m, fmt.Errorf("invalid value for %s: %s", kv[0], err)
+			}
+		}
+	}
+	return m, nil
+}
+
+// Assertion is a check of the received messages. A message passes, if one of
+// the values, that the path selects, is the expected value.
+type Assertion struct {
+	// Path is a JSONPath like "$[*].data.title".
+	Path string
+
+	// Value is the expected value as json, like "\"foo1\"".
+	Value string
+
+	// Tests are the names of the tests, whose messages are checked. If it is
+	// empty, the messages of "onewrite" and "manywrite" are checked.
+	Tests []string
+}
+
+// ParseAssertion parses an assertion like `$[*].data.title == "foo1"`.
+func ParseAssertion(s string) (Assertion, error) {
+	parts := strings.SplitN(s, "==", 2)
+	if len(parts) != 2 {
+		return Assertion{}, fmt.Errorf("assertion %q has no ==", s)
+	}
+	a := Assertion{Path: strings.TrimSpace(parts[0]), Value: strings.TrimSpace(parts[1])}
+	if a.Path == "" || a.Value == "" {
+		return Assertion{}, fmt.Errorf("assertion %q needs a path and a value", s)
+	}
+	return a, nil
+}
+
+// SLO is a service level objective for the results of a test. It is met, if
+// the statistic of each matching result is below the limit.
+type SLO struct {
+	// Test is the name of the test.
+	Test string
+
+	// Result is the description of the result. If it is empty, all results
+	// of the test are checked.
+	Result string
+
+	// Stat is "min", "ave", "max", a percentile like "p95" or "errors" for
+	// the part of the samples, that are errors.
+	Stat string
+
+	// Below is the limit for the durations. MaxErrorRate is the limit for
+	// "errors", like 0.01 for 1%.
+	Below        time.Duration
+	MaxErrorRate float64
+}
+
+// String returns the SLO in the form, that ParseSLO reads.
+func (s SLO) String() string {
+	limit := s.Below.String()
+	if s.Stat == "errors" {
+		limit = strconv.FormatFloat(s.MaxErrorRate*100, 'f', -1, 64) + "%"
+	}
+	if s.Result == "" {
+		return fmt.Sprintf("%s:%s<%s", s.Test, s.Stat, limit)
+	}
+	return fmt.Sprintf("%s:%s:%s<%s", s.Test, s.Result, s.Stat, limit)
+}
+
+// ParseSLO parses a SLO like "onewrite:p95<2s", "manywrite:errors<1%" or
+// "connect:Time to established connection:max<5s".
+func ParseSLO(s string) (SLO, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return SLO{}, fmt.Errorf("slo %q is not like test:stat<limit or test:result:stat<limit", s)
+	}
+	slo := SLO{Test: parts[0]}
+	if len(parts) == 3 {
+		slo.Result = parts[1]
+	}
+
+	condition := strings.SplitN(parts[len(parts)-1], "<", 2)
+	if len(condition) != 2 {
+		return SLO{}, fmt.Errorf("slo %q has no <", s)
+	}
+	slo.Stat = strings.TrimSpace(condition[0])
+	limit := strings.TrimSpace(condition[1])
+
+	switch {
+	case slo.Stat == "errors":
+		percent := strings.HasSuffix(limit, "%")
+		rate, err := strconv.ParseFloat(strings.TrimSuffix(limit, "%"), 64)
+		if err != nil {
+			return SLO{}, fmt.Errorf("invalid error rate in slo %q: %s", s, err)
+		}
+		if percent {
+			rate /= 100
+		}
+		slo.MaxErrorRate = rate
+
+	case slo.Stat == "min" || slo.Stat == "ave" || slo.Stat == "max" || isPercentile(slo.Stat):
+		d, err := time.ParseDuration(limit)
+		if err != nil {
+			return SLO{}, fmt.Errorf("invalid duration in slo %q: %s", s, err)
+		}
+		slo.Below = d
+
+	default:
+		return SLO{}, fmt.Errorf("unknown statistic %q in slo %q", slo.Stat, s)
+	}
+	return slo, nil
+}
+
+// BaselineMetrics are the metrics, that can be compared with a baseline.
+var BaselineMetrics = []string{"p50", "p95", "p99", "errors"}
+
+// ParseTolerance parses a tolerance of a baseline metric like "p95=10%". It
+// returns the metric and the percent, the metric can be higher then in the
+// baseline.
+func ParseTolerance(s string) (string, float64, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 {
+		return "", 0, fmt.Errorf("tolerance %q is not like metric=percent", s)
+	}
+	metric := strings.TrimSpace(parts[0])
+	var known bool
+	for _, m := range BaselineMetrics {
+		if m == metric {
+			known = true
+		}
+	}
+	if !known {
+		return "", 0, fmt.Errorf("unknown metric %q in tolerance %q, use one of %s", metric, s, strings.Join(BaselineMetrics, ", "))
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(parts[1]), "%"), 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid percent in tolerance %q: %s", s, err)
+	}
+	return metric, percent, nil
+}
+
+// isPercentile returns true for a percentile like "p95" or "p99.9".
+func isPercentile(stat string) bool {
+	if !strings.HasPrefix(stat, "p") {
+		return false
+	}
+	p, err := strconv.ParseFloat(stat[1:], 64)
+	return err == nil && p > 0 && p <= 100
+}
+
+// Config is the configuration of the clients and the tests.
+type Config struct {
+	// NormalClients and AdminClients are all clients, that are logged in. For the
+	// ConnectionTest there is no difference between the to clients. The AdminClient
+	// is needed to write data.
+	NormalClients int
+	AdminClients  int
+
+	// AnonymousClients are clients, that do not login. They connect and receive
+	// data like the other clients. This needs the anonymous access to be enabled
+	// in OpenSlides.
+	AnonymousClients int
+
+	// ShardIndex and ShardCount split the clients between processes. With a
+	// ShardCount greater then one, this process only creates every
+	// ShardCount-th client, beginning with ShardIndex. They are set by the
+	// coordinator for its agents.
+	ShardIndex int
+	ShardCount int
+
+	// AgentListen is the address, an agent listens on for the coordinator, for
+	// example ":9000". If it is set, oswstest runs as agent.
+	AgentListen string
+
+	// Agents are the addresses of the agents, for example
+	// "loadgen1.example.com:9000". An address "srv:<name>" is replaced by the
+	// targets of the DNS SRV record. If there are agents, oswstest runs as
+	// coordinator. It splits the clients between the agents, that are
+	// available at the start, starts the tests on all agents at the same time
+	// and merges there results.
+	Agents []string
+
+	// LiveListen is the address, on which the per-second aggregates of the
+	// running tests are streamed, for example ":8080". The path /live sends
+	// server sent events or, with a websocket upgrade, websocket messages. The
+	// grpc coordinator streams the aggregates of all agents. Empty means no
+	// live stream.
+	LiveListen string
+
+	// ControlToken protects the endpoints /pools and /stop of LiveListen, that
+	// change the running tests. They need the header "Authorization: Bearer
+	// <token>". Without a ControlToken, they are not served.
+	ControlToken string
+
+	// TraceEndpoint is the OTLP http endpoint, the spans of the logins,
+	// connects, write requests and receive-waits of the clients are exported
+	// to, for example "http://localhost:4318". Each run is one trace. Empty
+	// means no tracing.
+	TraceEndpoint string
+
+	// If TracePropagate is true, the http requests and websocket handshakes
+	// of the clients have the header traceparent of there span, so they can
+	// be found in the traces of the server.
+	TracePropagate bool
+
+	// PprofListen is the address, on which the pprof endpoints of the go
+	// runtime are served under /debug/pprof/, for example ":6060". Empty means
+	// no endpoints.
+	PprofListen string
+
+	// ProfileDir is a directory, where a cpu profile and a heap profile of each
+	// test are written as "<test>-cpu.pprof" and "<test>-heap.pprof". Empty
+	// means no profiles.
+	ProfileDir string
+
+	// JoinToken is a secret shared by the coordinator and the agents. If it is
+	// set, agents only accept a coordinator with the same token and the grpc
+	// coordinator only accepts agents with the same token.
+	JoinToken string
+
+	// RecordListen is the address of the proxy of the command record. A
+	// browser, that opens it, uses OpenSlides through the proxy and its
+	// session is recorded.
+	RecordListen string
+
+	// RecordClients is the number of clients, that replay each step of a
+	// recorded scenario or each action of a replay. Zero means all clients.
+	RecordClients int
+
+	// GRPCListen is the address, the coordinator listens on for agents with
+	// grpc, for example ":9001". Other then with Agents, the agents connect to
+	// the coordinator and stream there samples while the tests run.
+	GRPCListen string
+
+	// MinAgents is the number of agents, the grpc coordinator waits for before
+	// it starts the tests.
+	MinAgents int
+
+	// AgentWait is the minimum time, the grpc coordinator waits for agents to
+	// register. All agents, that registered until then, get a share of the
+	// clients.
+	AgentWait time.Duration
+
+	// Coordinator is the grpc address of the coordinator, for example
+	// "coordinator.example.com:9001" or a DNS SRV record "srv:<name>". If it is set, oswstest runs as agent of
+	// this coordinator.
+	Coordinator string
+
+	// BaseURL is the URL to the server. It is used for websocket and http. The
+	// Placeholders are filled in by the code.
+	BaseURL string
+
+	// LoginURLPath is the path to build the url for login. It has no leading slash.
+	LoginURLPath string
+
+	// LogoutURLPath is the path to build the url for logout. It has no leading slash.
+	LogoutURLPath string
+
+	// WSURLPath is the path to build the websocket url. It has no leading slash.
+	WSURLPath string
+
+	// AuthMode is the way the clients authenticate after the login. Use
+	// "session" for the session cookie of OpenSlides or "token" to read a token
+	// from the login response and send it with each request. Use "os4" for the
+	// auth service of OpenSlides 4. In this case the token is read from the
+	// TokenHeader of the login response and refreshed when it expires. For
+	// OpenSlides 4 set LoginURLPath to "system/auth/login/", TokenHeader to
+	// "Authentication" and TokenPrefix to "bearer ".
+	// Use "oidc" to get the token from an OIDC provider like Keycloak with the
+	// resource owner password credentials grant. The token is send like with
+	// "token" and refreshed with the refresh token when it expires.
+	AuthMode string
+
+	// OIDCTokenURL is the full url of the token endpoint of the OIDC provider.
+	// Only used if AuthMode is "oidc".
+	OIDCTokenURL string
+
+	// OIDCClientID and OIDCClientSecret identify oswstest at the OIDC provider.
+	// The client has to allow the password grant. The secret can be empty for
+	// public clients.
+	OIDCClientID     string
+	OIDCClientSecret string
+
+	// OIDCScope is the scope requested from the OIDC provider.
+	OIDCScope string
+
+	// TokenJSONField is the field in the json body of the login response that
+	// contains the token. Only used if AuthMode is "token".
+	TokenJSONField string
+
+	// TokenHeader and TokenPrefix build the http header, that is used to send
+	// the token with each request and with the websocket handshake.
+	TokenHeader string
+	TokenPrefix string
+
+	// TokenRefreshURLPath is the path to build the url to refresh an expired
+	// token. It has no leading slash. Only used if AuthMode is "os4".
+	TokenRefreshURLPath string
+
+	// TokenRefreshMargin is the time before the expiration of a token, when it
+	// is refreshed.
+	TokenRefreshMargin time.Duration
+
+	// TokenQueryParam is the name of the query parameter to send the token with
+	// the websocket url. If it is empty, the token is not added to the url.
+	TokenQueryParam string
+
+	// TokenCookieName is the name of a cookie to send the token with. If it is
+	// empty, no cookie is set.
+	TokenCookieName string
+
+	// SessionCacheFile is the file, where the sessions of all clients are saved
+	// after the login. If ReuseSessions is true, they are used again.
+	SessionCacheFile string
+
+	// ReuseSessions defines, if the login is skipped for clients with a valid
+	// session in the SessionCacheFile.
+	ReuseSessions bool
+
+	// SessionCheckURLPath is the path to build the url, that is used to check if
+	// a cached session is still valid. It has no leading slash.
+	SessionCheckURLPath string
+
+	// LoginPassword is the password to login the normal clients and also the admin clients.
+	LoginPassword string
+
+	// CredentialsFile is a json or csv file with username, password and role
+	// ("admin" or "user") of each client. If it is set, the clients are created
+	// from this file and NormalClients, AdminClients and LoginPassword are not
+	// used.
+	CredentialsFile string
+
+	// GeneratePasswords defines, if each generated admin and normal client gets
+	// its own random password instead of LoginPassword. The credentials are
+	// written to GeneratedCredentialsFile, so they can be used with
+	// CredentialsFile in later runs. It needs SetGeneratedPasswords.
+	GeneratePasswords bool
+
+	// GeneratedCredentialsFile is the csv file, the generated credentials are
+	// written to.
+	GeneratedCredentialsFile string
+
+	// GeneratedPasswordLength is the length of the generated passwords.
+	GeneratedPasswordLength int
+
+	// SetGeneratedPasswords defines, if the generated passwords are set on the
+	// server before the run. This is done by the user ProvisionUsername via the
+	// REST API. The users have to exist.
+	SetGeneratedPasswords bool
+
+	// CreateUsers defines, if the users of the logged-in clients are created
+	// before the login, if they do not exist. This is done by the user
+	// ProvisionUsername via the REST API. Existing users are not changed.
+	CreateUsers bool
+
+	// AdminGroupIDs and UserGroupIDs are the groups of the created admin and
+	// normal users. In OpenSlides, group 2 is "Admin". Without groups, the
+	// users are in the default group.
+	AdminGroupIDs []int
+	UserGroupIDs  []int
+
+	// CleanupUsers defines, what happens with the users of the logged-in
+	// clients after the run, so a shared instance is not left with the test
+	// accounts. Use "delete" to delete them or "deactivate" to set them
+	// inactive. Empty keeps them. The user ProvisionUsername is never changed.
+	CleanupUsers string
+
+	// ProvisionUsername and ProvisionPassword are the credentials of the admin
+	// user, that creates the users and sets the generated passwords.
+	ProvisionUsername string
+	ProvisionPassword string
+
+	// RESTURLPath is the path to build the url of an element in the REST API,
+	// like rest/agenda/item/1/. It has no leading slash.
+	RESTURLPath string
+
+	// UserURLPath is the path to build the url of the user collection in the
+	// REST API. It has no leading slash.
+	UserURLPath string
+
+	// TopicURLPath is the path of the topic collection in the REST API. It
+	// has no leading slash.
+	TopicURLPath string
+
+	// Seed defines, if the agenda item WriteItemID is created before the run,
+	// if it does not exist, like on a fresh OpenSlides. It is created as topic
+	// by the user ProvisionUsername. If the new item gets an other id,
+	// WriteItemID is changed to it.
+	Seed bool
+
+	// RestoreState defines, if the agenda item WriteItemID is set back to its
+	// data before the run and the topic, that was created by Seed, is deleted
+	// after the run, so repeated runs against a shared instance do not leave
+	// changes behind.
+	RestoreState bool
+
+	// DataVolume is the number of topics, the server has before the run. The
+	// missing topics are created by the user ProvisionUsername with a fake
+	// text of DataVolumeTextSize bytes. So the size of the data, that each
+	// client gets after the connect, can be changed. With RestoreState, the
+	// created topics are deleted after the run. Zero creates no topics.
+	DataVolume         int
+	DataVolumeTextSize int
+
+	// FixtureFile is a fixture, that was written by the command
+	// fixture-export. If it is set, the server is set back to the fixture
+	// before each run, so destructive tests start with the same data. The
+	// fixture is imported by the user ProvisionUsername via the REST API.
+	FixtureFile string
+
+	// FixtureCollections are the collections of the REST API, that are
+	// exported into a fixture and imported from it, in this order. The import
+	// deletes all elements, that are not in the fixture. So "users/user" is
+	// not in the default, else all users, that were created after the export,
+	// would be deleted.
+	FixtureCollections []string
+
+	// MaxLoginAttemts is the number of tries for each client to login. If one
+	// client fails more then this number, then the login error is recorded as
+	// a failed result of the setup and the tests are not run.
+	MaxLoginAttemts int
+
+	// MaxConnectionAttemts is th enumber of tries for each client, to connect via
+	// websocket. If a client fails, is program is not quit, but the error is shoun
+	// in the end.
+	MaxConnectionAttemts int
+
+	// CSRFMode is the way the csrf token is send with write requests, if
+	// AuthMode is "session". Use "cookie" to send the value of the csrf cookie
+	// (double submit), "endpoint" to fetch the token from CSRFTokenURLPath or
+	// "none" to send no csrf token.
+	CSRFMode string
+
+	// CSRFCookieName is the name of the CSRF cookie of OpenSlides. Make sure, that
+	// this is the same as in the OpenSlides config.
+	CSRFCookieName string
+
+	// CSRFHeaderName is the name of the http header to send the csrf token.
+	CSRFHeaderName string
+
+	// CSRFTokenURLPath is the path to build the url, that sets a new csrf cookie
+	// or returns the csrf token. It is requested if the client has no token or
+	// if the server rejects the token. It has no leading slash.
+	CSRFTokenURLPath string
+
+	// CSRFTokenJSONField is the field in the json response of CSRFTokenURLPath,
+	// that contains the csrf token. Only used if CSRFMode is "endpoint".
+	CSRFTokenJSONField string
+
+	// ParallelConnections defines the number of connections, that are done in
+	// parallel. The number should be similar as the number of openslides workers.
+	// Zero means, that it is derived from the cpus and the clients. See
+	// DeriveWorkers.
+	ParallelConnections int
+
+	// ConnectRate is the maximum number of new connections per second in the
+	// connect tests, independent of ParallelConnections. Each connection waits
+	// an additional random time up to ConnectJitter. Zero means no limit and no
+	// jitter.
+	ConnectRate   float64
+	ConnectJitter time.Duration
+
+	// Same for logins
+	ParallelLogins int
+
+	// Same for sends in the ManySendTest
+	ParallelSends int
+
+	// WriteRate is the number of write requests per second in the ManySendTest
+	// and in the write steps of scenarios without a rate. Zero means, that the
+	// requests are send as fast as possible.
+	WriteRate float64
+
+	// RequestRate is the maximum number of http requests per second of all
+	// clients together, like logins, write requests and reads.
+	// ClientRequestRate is the maximum for each client. Up to RequestBurst
+	// requests can be done at once. Zero means no limit. The requests, that
+	// have to wait, keep the rate exactly.
+	RequestRate       float64
+	ClientRequestRate float64
+	RequestBurst      int
+
+	// Latency simulates a slow network, like attendees on a mobile network.
+	// Each http request, websocket dial and websocket message of a client is
+	// send this time later and each received message is given to the tests
+	// this time later. LatencyJitter adds a random time up to it to each of
+	// them. The order of the received messages is kept.
+	Latency       time.Duration
+	LatencyJitter time.Duration
+
+	// WritePayloadSize is the length of the comment in the write requests. Zero
+	// means a short default comment.
+	WritePayloadSize int
+
+	// WritePayload is the data of the write requests. Use "fixed" for the
+	// same agenda item each time or "fake" for a random title and a random
+	// text as comment, like motions and amendments. The fake text has the
+	// length WritePayloadSize or FakeTextLength, if WritePayloadSize is zero.
+	// Use "template" for the Go template WritePayloadTemplate.
+	WritePayload string
+
+	// WritePayloadTemplate is a file with a Go template of the body of the
+	// write requests. See client.PayloadData for the variables.
+	WritePayloadTemplate string
+
+	// FakeTextLength is the length of the fake comment without a
+	// WritePayloadSize.
+	FakeTextLength int
+
+	// FakeVocabulary is the number of different words in the fake texts. Less
+	// words mean less entropy, so the messages compress better.
+	FakeVocabulary int
+
+	// FakeSeed makes the fake data of each run the same. Zero means a random
+	// seed for each run.
+	FakeSeed int64
+
+	// WriteItemID is the id of the agenda item, that the write requests
+	// change.
+	WriteItemID int
+
+	// ReceiveTimeout is the time a client waits for the next expected message
+	// in a test. It starts, when the client starts to wait, and again with
+	// each message, so tests, that send there write requests slowly, do not
+	// time out. A client, that does not get a message in time, is reported
+	// with the error "no data within ..." and the test goes on without it.
+	// Zero means, that the clients wait forever.
+	ReceiveTimeout time.Duration
+
+	// ErrorBudget is the part of errors, a result of a test may have, like 0.2
+	// for 20%. When more of the expected samples of a result are errors, for
+	// example more then 20% of the clients can not connect, the test is
+	// aborted and fails. Zero means, that tests are never aborted because of
+	// errors.
+	ErrorBudget float64
+
+	// TestTimeout is the time, a test may run. A test, that takes longer, is
+	// aborted and fails. The state of its unfinished clients is logged and the
+	// next test is run. Zero means, that a test can run forever.
+	TestTimeout time.Duration
+
+	// LogoutCloseTimeout is the time the LogoutTest waits for the server to
+	// close the connection of a client after its logout.
+	LogoutCloseTimeout time.Duration
+
+	// LogoutTestRelogin defines, if the clients login again in the LogoutTest
+	// after their connection was closed.
+	LogoutTestRelogin bool
+
+	// PollingClientsPercent is the percentage of clients, that use HTTP
+	// long-polling instead of a websocket connection. The polling clients are
+	// spread evenly over admin and normal clients. Together with
+	// SSEClientsPercent it should not be more then 100.
+	PollingClientsPercent int
+
+	// PollURLPath is the path to build the url for long-polling. It has no
+	// leading slash.
+	PollURLPath string
+
+	// PollInterval is the time a polling client waits after a response before
+	// it sends the next poll request. Use 0 for real long-polling.
+	PollInterval time.Duration
+
+	// PollTimeout is the maximum time a poll request may take. It has to be
+	// longer then the time the server holds a long-polling request.
+	PollTimeout time.Duration
+
+	// ClientQueueSize is the number of received messages, that each client
+	// holds until a test reads them. When the queue is full, new messages are
+	// dropped and reported.
+	ClientQueueSize int
+
+	// If EpollClients is true, the websocket clients have no own read
+	// goroutine. Instead, a few pollers watch all connections with epoll, so
+	// one machine can hold 100k idle connections. It only works on linux and
+	// with ws urls (without TLS).
+	EpollClients bool
+
+	// SSEClientsPercent is the percentage of clients, that receive their data
+	// from a server-sent events stream instead of a websocket connection.
+	SSEClientsPercent int
+
+	// SSEURLPath is the path to build the url of the event stream. It has no
+	// leading slash.
+	SSEURLPath string
+
+	// SSEMaxEventSize is the maximum size of one line in the event stream.
+	SSEMaxEventSize int
+
+	// Tests are the names of the tests to performe. The tests are run in the
+	// given order.
+	//
+	// "connect" connects all clients. Measures the time until all clients are
+	// connected and until they all got there first data.
+	//
+	// "onewrite" expects the first client to be an admin client and all clients
+	// to be connected. Therefore the test requires, that "connect" is run
+	// before. This test sends one write request with the first client and
+	// measures the time until all clients get the changed data.
+	//
+	// "manywrite" expects at least one client to be an admin client and all
+	// clients to be connected. Therefore the test requires, that "connect" is
+	// run before. This test sends one write request for each admin client and
+	// measures the time until all write requests are send and until all data is
+	// received.
+	//
+	// "logout" expects all clients to be connected. All logged-in clients
+	// logout at the same time. It measures the time of the logout requests and
+	// the time until the server closes the connections. If LogoutTestRelogin is
+	// true, the clients login again. The clients are not connected afterwards,
+	// so it has to be the last test. It also invalidates the cached sessions.
+	//
+	// "oswstest -list-tests" shows all registered tests with there
+	// requirements, also the tests of plugins, scenarios and matrices.
+	//
+	// Instead of a test, the name of a suite can be used. The suite "default"
+	// are the tests "connect", "onewrite" and "manywrite", the suite "all" also
+	// runs "logout".
+	Tests []string
+
+	// If Warmup is true, the clients are connected before the first test. Then
+	// WarmupWrites write requests are send and the program waits WarmupWait,
+	// so the caches of the server are filled. The samples of the warm-up are
+	// not part of the results. Because the clients are connected by the
+	// warm-up, the test "connect" is skipped.
+	Warmup       bool
+	WarmupWrites int
+	WarmupWait   time.Duration
+
+	// Assertions are checked for each received message. The failed assertions
+	// are reported as errors of the test.
+	Assertions []Assertion
+
+	// If CheckPropagation is true, each write request of the test "manywrite"
+	// gets a marker and the test reports, which clients did not receive it.
+	CheckPropagation bool
+
+	// If CheckConsistency is true, the elements, that the admin clients
+	// receive, are compared with the REST API after the last test. The
+	// elements are fetched with the user ProvisionUsername.
+	CheckConsistency bool
+
+	// If LeakCheck is true, the runner checks after each test, that the
+	// goroutines of the test have ended. It waits up to LeakCheckWait for
+	// them. The leaks are reported as errors of the test.
+	LeakCheck     bool
+	LeakCheckWait time.Duration
+
+	// If CheckData is true, the tests "connect" and "onewrite" check, that all
+	// clients with the same role (admin, user or anonymous) receive the same
+	// data. Json data is compared without the order of the keys and the
+	// whitespace.
+	CheckData bool
+
+	// SchemaFile is the path of a json file, that maps message types to json
+	// schemas. If it is set, each received message is validated. The type of
+	// an element of an autoupdate is its collection. The violations are
+	// reported as errors for each type.
+	SchemaFile string
+
+	// If CheckDuplicates is true, each client reports elements, that it
+	// receives more then once in a test. An element is identified by its
+	// collection, its id and its change id. Without a change id, the hash of
+	// the element is used, so a write request, that does not change the data,
+	// is also reported.
+	CheckDuplicates bool
+
+	// If CheckOrder is true, each client reports messages, whose change id is
+	// lower then the change id of an earlier message in the same test.
+	CheckOrder bool
+
+	// If AutoSetup is true, the runner inserts a setup test before a test,
+	// whose requirements are not met. For example "connect" before "onewrite".
+	// Else the tests do not run.
+	AutoSetup bool
+
+	// Plugins are go plugins, that register additional tests. They have to be
+	// built with -buildmode=plugin against the same version of oswstest.
+	Plugins []string
+
+	// ExternalTests are additional tests, that are run by an external
+	// executable. See runner.ExternalTest for the protocol.
+	ExternalTests []ExternalTest
+
+	// Matrices run a test for all combinations of parameters. The name of a
+	// matrix can be used in Tests.
+	Matrices []Matrix
+
+	// SLOs are checked against the results after the tests. If one is not
+	// met, oswstest exits with the code 4, so automation can fail a release
+	// without reading the output.
+	SLOs []SLO
+
+	// Baseline is the run, the results are compared with. It is a json file
+	// of the json result sink or a database of the package store like
+	// "sqlite:results.db", where the run was marked as baseline. If a metric
+	// is worse then its tolerance, oswstest exits with the code 3.
+	Baseline string
+
+	// BaselineTolerances are the percent, each metric of BaselineMetrics can
+	// be higher then in the baseline. Only these metrics are checked. If it
+	// is empty, all metrics are checked with RegressionPercent.
+	BaselineTolerances map[string]float64
+
+	// Notify are the notifiers, that get a summary of each run with the SLOs,
+	// that were not met. See notify.Parse for the format.
+	Notify []string
+
+	// CommitStatus posts the verdict of each run to "github" as commit
+	// status, to "github-check" as check run or to "gitlab" as commit status.
+	// The run fails like the exit code, if a SLO is not met or a result is
+	// worse then the baseline. Empty means no commit status. See
+	// commitstatus.Parse for the environment variables.
+	CommitStatus string
+
+	// CommitRepo is the repository (owner/name) on GitHub or the project on
+	// GitLab. Empty means the one of the CI job.
+	CommitRepo string
+
+	// CommitSHA is the commit, that gets the status. Empty means the one of
+	// the CI job.
+	CommitSHA string
+
+	// CommitStatusName is the name of the commit status or check run.
+	CommitStatusName string
+
+	// Scenarios are json files, that describe a test as steps. See
+	// runner.Scenario for the format. The name of the scenario can be used in
+	// Tests.
+	Scenarios []string
+
+	// Replays are recordings of the command record. Each is a test, that
+	// replays the recorded actions at there recorded times. The name of the
+	// test is the file name without ".recording.json".
+	Replays []string
+
+	// ReplaySpeed is the factor, the replays are faster then the recording,
+	// like 2 or 10.
+	ReplaySpeed float64
+
+	// ResultSinks are the outputs, the results are written to. Possible values
+	// are "console", "json:<file>", "influx:<file>" for the InfluxDB line
+	// protocol, "prometheus:<file>" for the prometheus text format,
+	// "k6:<file>" for the end-of-test summary of k6, "locust:<file>" for
+	// the stats csv of Locust, "pushgateway:<url>" to push the results to
+	// a Prometheus Pushgateway and "elasticsearch:<url>/<index>" to index
+	// each sample into Elasticsearch or OpenSearch, "parquet:<file>" for the
+	// samples as Parquet file. The package store adds
+	// "sqlite:<file>", "postgres:<dsn>" and both with "+samples".
+	ResultSinks []string
+
+	// If StreamingStats is true, the results only keep count, min, max, mean,
+	// variance and a histogram of the measured durations instead of each
+	// duration. Use it for long soak tests. The json and influx outputs have no
+	// samples then.
+	StreamingStats bool
+
+	// The hook commands are run with "sh -c" before all tests, before and after
+	// each test and when a test fails. An empty string means no command. The
+	// name of the test is in the environment variable OSWSTEST_TEST, the error
+	// of a failed test in OSWSTEST_ERROR. If the before or after command
+	// fails, the test fails.
+	BeforeRunCommand  string
+	BeforeTestCommand string
+	AfterTestCommand  string
+	OnErrorCommand    string
+
+	// Cron is the schedule of the command "schedule" as cron expression, for
+	// example "0 3 * * *" for each night at three o'clock.
+	Cron string
+
+	// ScheduleResultsDir is the directory, where the command "schedule" writes
+	// the results of each run as json file.
+	ScheduleResultsDir string
+
+	// Iterations is the number of runs of the command "continuous". Zero means
+	// forever. Between two runs, it waits IterationPause.
+	Iterations     int
+	IterationPause time.Duration
+
+	// TrendWindow is the number of runs of the command "continuous", whose
+	// averages are the baseline of the next run.
+	TrendWindow int
+
+	// RegressionPercent is how much slower then the baseline the average of a
+	// result can be, before it is a regression.
+	RegressionPercent float64
+
+	// RegressionWebhook is a url, that gets the regressions as json post
+	// request. Empty means no webhook.
+	RegressionWebhook string
+
+	// If ExitOnRegression is true, the command "continuous" stops at the first
+	// regression with the exit code 3.
+	ExitOnRegression bool
+
+	// If ShowAllErros is true, then all errors that happen are shoun after a result
+	// Else, only the first error is shown.
+	ShowAllErros bool
+
+	// If ConsoleColor is true, the rows of the table of the console output
+	// are green, yellow or red. A result is red, if its error rate is at
+	// least ConsoleRedErrorRate or its average is at least ConsoleRedAverage.
+	// It is yellow, if it has errors or its average is at least
+	// ConsoleYellowAverage.
+	ConsoleColor         bool
+	ConsoleYellowAverage time.Duration
+	ConsoleRedAverage    time.Duration
+	ConsoleRedErrorRate  float64
+
+	// If LogStatus is true, then the program shows some output while the tests are
+	// running. Each second, the progress of the logins and the tests is logged
+	// with an ETA.
+	LogStatus bool
+
+	// If Quiet is true, nothing is logged and the console output is exactly one
+	// summary line per test, for example for CI logs. See result.SummarySink.
+	Quiet bool
+}
+
+// Default returns the default configuration.
+func Default() *Config {
+	return &Config{
+		NormalClients:    10,
+		AdminClients:     10,
+		AnonymousClients: 0,
+
+		MinAgents: 1,
+
+		RecordListen: "localhost:8001",
+		ReplaySpeed:  1,
+
+		BaseURL:       "%s://localhost:8000/%s",
+		LoginURLPath:  "users/login/",
+		LogoutURLPath: "users/logout/",
+		WSURLPath:     "ws/site/",
+
+		AuthMode:            "session",
+		OIDCTokenURL:        "http://localhost:8080/realms/openslides/protocol/openid-connect/token",
+		OIDCClientID:        "oswstest",
+		OIDCScope:           "openid",
+		TokenJSONField:      "token",
+		TokenHeader:         "Authorization",
+		TokenPrefix:         "Bearer ",
+		TokenRefreshURLPath: "system/auth/who-am-i/",
+		TokenRefreshMargin:  30 * time.Second,
+
+		SessionCacheFile:    "sessions.json",
+		SessionCheckURLPath: "users/whoami/",
+
+		LoginPassword:            "password",
+		GeneratedCredentialsFile: "credentials.csv",
+		GeneratedPasswordLength:  20,
+		ProvisionUsername:        "admin",
+		ProvisionPassword:        "admin",
+		AdminGroupIDs:            []int{2},
+		RESTURLPath:              "rest/",
+		UserURLPath:              "rest/users/user/",
+		TopicURLPath:             "rest/topics/topic/",
+		WriteItemID:              1,
+		DataVolumeTextSize:       1000,
+		WritePayload:             "fixed",
+		FakeTextLength:           500,
+		FakeVocabulary:           1000,
+		FixtureCollections:       []string{"topics/topic", "motions/motion", "agenda/item"},
+
+		MaxLoginAttemts:      5,
+		MaxConnectionAttemts: 3,
+
+		CSRFMode:           "cookie",
+		CSRFCookieName:     "OpenSlidesCsrfToken",
+		CSRFHeaderName:     "X-CSRFToken",
+		CSRFTokenURLPath:   "users/whoami/",
+		CSRFTokenJSONField: "csrf_token",
+
+		ReceiveTimeout:  60 * time.Second,
+		ClientQueueSize: 1000,
+		RequestBurst:    1,
+
+		LogoutCloseTimeout: 10 * time.Second,
+		LogoutTestRelogin:  true,
+
+		PollURLPath:     "poll/site/",
+		PollTimeout:     60 * time.Second,
+		SSEURLPath:      "sse/site/",
+		SSEMaxEventSize: 16 * 1024 * 1024,
+
+		Tests:       []string{"connect", "onewrite", "manywrite"},
+		AutoSetup:   true,
+		ResultSinks: []string{"console"},
+
+		CommitStatusName: "oswstest",
+
+		CheckData: true,
+
+		LeakCheck:     true,
+		LeakCheckWait: 5 * time.Second,
+
+		Warmup:       false,
+		WarmupWrites: 3,
+		WarmupWait:   2 * time.Second,
+
+		Cron:               "0 3 * * *",
+		ScheduleResultsDir: "results",
+
+		IterationPause:    time.Minute,
+		TrendWindow:       10,
+		RegressionPercent: 20,
+		ExitOnRegression:  true,
+
+		ShowAllErros: true,
+		LogStatus:    false,
+
+		ConsoleYellowAverage: time.Second,
+		ConsoleRedAverage:    5 * time.Second,
+		ConsoleRedErrorRate:  0.05,
+	}
+}
+
+// HTTPURL returns the http url for a path on the server.
+func (c *Config) HTTPURL(path string) string {
+	return fmt.Sprintf(c.BaseURL, "http", path)
+}
+
+// WSURL returns the websocket url for a path on the server.
+func (c *Config) WSURL(path string) string {
+	return fmt.Sprintf(c.BaseURL, "ws", path)
+}
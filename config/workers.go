@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Workers per cpu, that DeriveWorkers uses. Logins and sends wait most of the
+// time for the server, so there can be more of them. Connects are limited by
+// the workers of the server.
+const (
+	loginsPerCPU      = 4
+	connectionsPerCPU = 2
+	sendsPerCPU       = 4
+)
+
+// DeriveWorkers sets ParallelLogins, ParallelConnections and ParallelSends,
+// that are zero, to a number of workers per cpu (GOMAXPROCS). There are never
+// more workers then clients. It returns a description of the derived numbers
+// for the output or an empty string, if no number was derived.
+func (c *Config) DeriveWorkers(clients int) string {
+	cpus := runtime.GOMAXPROCS(0)
+	var derived []string
+	derive := func(field *int, perCPU int, name string) {
+		if *field > 0 {
+			return
+		}
+		*field = cpus * perCPU
+		if *field > clients {
+			*field = clients
+		}
+		if *field < 1 {
+			*field = 1
+		}
+		derived = append(derived, fmt.Sprintf("%d parallel %s (%d per cpu)", *field, name, perCPU))
+	}
+	derive(&c.ParallelLogins, loginsPerCPU, "logins")
+	derive(&c.ParallelConnections, connectionsPerCPU, "connections")
+	derive(&c.ParallelSends, sendsPerCPU, "sends")
+
+	if len(derived) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Use %s for %d cpus and %d clients", strings.Join(derived, ", "), cpus, clients)
+}
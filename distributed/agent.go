@@ -0,0 +1,338 @@
+package distributed
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ostcar/oswstest/client"
+	"github.com/ostcar/oswstest/config"
+	"github.com/ostcar/oswstest/live"
+	"github.com/ostcar/oswstest/result"
+	"github.com/ostcar/oswstest/runner"
+)
+
+// The states of an agent.
+const (
+	StateIdle    = "idle"
+	StateRunning = "running"
+	StateDone    = "done"
+)
+
+// Agent drives a share of the clients for a coordinator or runs tests for
+// orchestration scripts. It is a http.Handler with the endpoints
+//
+//	POST /prepare  creates and logs in the clients of a configuration
+//	POST /start    starts tests, optional at a given time
+//	POST /stop     stops the running tests
+//	GET  /status   returns the state and the current test
+//	GET  /results  returns the results of the finished tests
+//	GET  /clock    returns the time of the agent, to measure the clock offset
+//	GET  /live     streams per-second aggregates of the running tests
+//
+// If /start is called without /prepare, the clients of the configuration of
+// the agent are created.
+//
+// If the configuration has a JoinToken, each request needs the header
+// "Authorization: Bearer <token>". Without a JoinToken, the agent may only
+// listen on a loopback address, see CheckListen.
+//
+// The shell commands of the hooks are only taken from the configuration of
+// the agent, never from the configuration of /prepare.
+//
+// The tests have to be registered on the agent. The plugins, scenarios and
+// matrices of the coordinator are not send to the agent.
+type Agent struct {
+	cfg     *config.Config
+	factory client.ClientFactory
+	mux     *http.ServeMux
+	hub     *live.Hub
+
+	mu        sync.Mutex
+	env       *runner.Env
+	preparing bool
+	state     string
+	tests     []string
+	current   string
+	started   time.Time
+	results   []testResults
+	cancel    context.CancelFunc
+}
+
+// status is the response of /status.
+type status struct {
+	State       string    `json:"state"`
+	Tests       []string  `json:"tests"`
+	CurrentTest string    `json:"current_test,omitempty"`
+	Finished    int       `json:"finished"`
+	Started     time.Time `json:"started,omitempty"`
+}
+
+// NewAgent creates an agent with its own configuration. If factory is nil,
+// the default factory is used.
+func NewAgent(cfg *config.Config, factory client.ClientFactory) *Agent {
+	a := &Agent{cfg: cfg, factory: factory, mux: http.NewServeMux(), hub: live.NewHub(), state: StateIdle}
+	a.mux.HandleFunc("/prepare", a.handlePrepare)
+	a.mux.HandleFunc("/start", a.handleStart)
+	a.mux.HandleFunc("/stop", a.handleStop)
+	a.mux.HandleFunc("/status", a.handleStatus)
+	a.mux.HandleFunc("/results", a.handleResults)
+	a.mux.HandleFunc("/clock", a.handleClock)
+	a.mux.Handle("/live", a.hub)
+	return a
+}
+
+// ServeHTTP checks the join token and calls the endpoint. The token is
+// compared in constant time, so its bytes can not be guessed from the time of
+// the answer.
+func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	got := r.Header.Get("Authorization")
+	if a.cfg.JoinToken != "" && subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+a.cfg.JoinToken)) != 1 {
+		http.Error(w, "invalid join token", http.StatusUnauthorized)
+		return
+	}
+	a.mux.ServeHTTP(w, r)
+}
+
+// CheckListen returns an error, if an agent without a JoinToken would listen on
+// an other address then loopback. Everybody, who can reach such an agent,
+// could prepare and start tests with it.
+func CheckListen(cfg *config.Config) error {
+	if cfg.JoinToken != "" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(cfg.AgentListen)
+	if err != nil {
+		return fmt.Errorf("invalid agent address %s: %s", cfg.AgentListen, err)
+	}
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return nil
+	}
+	return fmt.Errorf("an agent without a join token can only listen on a loopback address like 127.0.0.1:9000, not on %s", cfg.AgentListen)
+}
+
+// errBusy is returned by prepare, when tests are running or other clients are
+// prepared.
+var errBusy = errors.New("tests are running or clients are prepared")
+
+// prepare creates and logs in the clients of a configuration. The clients of
+// an earlier prepare are closed first. Has to be called without the lock,
+// because the login of the clients can take minutes and /status has to answer
+// in this time.
+func (a *Agent) prepare(ctx context.Context, cfg *config.Config) error {
+	a.mu.Lock()
+	if a.state == StateRunning || a.preparing {
+		a.mu.Unlock()
+		return errBusy
+	}
+	a.preparing = true
+	old := a.env
+	a.env = nil
+	a.mu.Unlock()
+
+	if old != nil {
+		runner.CloseClients(old.Clients)
+	}
+	env, err := a.newEnv(ctx, cfg)
+	if err == nil {
+		a.hub.Attach(env)
+	}
+
+	a.mu.Lock()
+	a.env = env
+	a.preparing = false
+	a.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	log.Printf("Prepared %d clients for shard %d of %d", len(env.Clients), cfg.ShardIndex, cfg.ShardCount)
+	return nil
+}
+
+// newEnv creates the environment with the hooks of the agent.
+func (a *Agent) newEnv(ctx context.Context, cfg *config.Config) (*runner.Env, error) {
+	factory := a.factory
+	if factory == nil {
+		factory = client.NewFactory(cfg)
+	}
+	env, err := runner.NewEnv(ctx, cfg, factory)
+	if err != nil {
+		return nil, err
+	}
+	env.Hooks = runner.CommandHooks(a.cfg)
+	env.Hooks.BeforeTest = append(env.Hooks.BeforeTest, func(env *runner.Env, test runner.Test) error {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.current = test.Name()
+		return nil
+	})
+	return env, nil
+}
+
+func (a *Agent) handlePrepare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req prepareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Config == nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.prepare(r.Context(), req.Config); err != nil {
+		code := http.StatusInternalServerError
+		if err == errBusy {
+			code = http.StatusConflict
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Agent) handleStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req startRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Tests) == 0 {
+		req.Tests = a.cfg.Tests
+	}
+	tests, err := runner.TestsByName(req.Tests)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a.mu.Lock()
+	prepared := a.env != nil
+	a.mu.Unlock()
+	if !prepared {
+		if err := a.prepare(r.Context(), a.cfg); err != nil && err != errBusy {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.state == StateRunning || a.preparing || a.env == nil {
+		http.Error(w, "tests are running or clients are prepared", http.StatusConflict)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.state = StateRunning
+	a.tests = req.Tests
+	a.current = ""
+	a.results = nil
+	a.started = req.StartAt
+	if a.started.IsZero() {
+		a.started = time.Now()
+	}
+	a.cancel = cancel
+	go a.run(ctx, a.env, tests, a.started)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// run waits for the start time and runs the tests.
+func (a *Agent) run(ctx context.Context, env *runner.Env, tests []runner.Test, startAt time.Time) {
+	defer func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.state = StateDone
+		a.current = ""
+		a.cancel()
+	}()
+
+	// Wait for the start time, so all agents start together.
+	select {
+	case <-time.After(time.Until(startAt)):
+	case <-ctx.Done():
+		return
+	}
+
+	sink := &recordSink{record: func(tr testResults) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.results = append(a.results, tr)
+	}}
+	runner.RunTests(ctx, env, tests, []result.Sink{sink})
+}
+
+func (a *Agent) handleStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.state != StateRunning {
+		http.Error(w, "no tests are running", http.StatusConflict)
+		return
+	}
+	a.cancel()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Agent) handleStatus(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	s := status{
+		State:       a.state,
+		Tests:       a.tests,
+		CurrentTest: a.current,
+		Finished:    len(a.results),
+		Started:     a.started,
+	}
+	a.mu.Unlock()
+	writeJSON(w, s)
+}
+
+func (a *Agent) handleResults(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	results := a.results
+	a.mu.Unlock()
+	if results == nil {
+		results = []testResults{}
+	}
+	writeJSON(w, results)
+}
+
+func (a *Agent) handleClock(w http.ResponseWriter, r *http.Request) {
+	resp := clockResponse{Received: time.Now()}
+	resp.Sent = time.Now()
+	writeJSON(w, resp)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Can not send response, %s", err)
+	}
+}
+
+// recordSink gives the published results to a function.
+type recordSink struct {
+	record func(testResults)
+}
+
+func (s *recordSink) Publish(test string, results []*result.TestResult) error {
+	s.record(testResults{Test: test, Results: toWire(results)})
+	return nil
+}
+
+func (s *recordSink) Close() error { return nil }
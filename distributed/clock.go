@@ -0,0 +1,46 @@
+package distributed
+
+import (
+	"fmt"
+	"time"
+)
+
+// ClockRounds is the number of exchanges to measure the clock offset between
+// the coordinator and an agent. The exchange with the shortest round trip is
+// used.
+var ClockRounds = 8
+
+// MaxClockOffset is the clock offset, above which a warning is logged. The
+// offset is corrected, but large offsets are a hint for a broken time sync.
+var MaxClockOffset = 100 * time.Millisecond
+
+// clockResponse is the answer to a clock request. Both times are from the
+// clock of the one, that answers.
+type clockResponse struct {
+	Received time.Time `json:"received"`
+	Sent     time.Time `json:"sent"`
+}
+
+// measureOffset measures the offset of a remote clock like NTP. exchange has
+// to ask the remote side for its time. The offset is the time, that has to be
+// added to a local time to get the remote time.
+func measureOffset(exchange func() (clockResponse, error)) (offset, rtt time.Duration, err error) {
+	rtt = -1
+	for i := 0; i < ClockRounds; i++ {
+		t0 := time.Now()
+		resp, err := exchange()
+		if err != nil {
+			return 0, 0, fmt.Errorf("can not measure clock offset: %s", err)
+		}
+		t3 := time.Now()
+
+		// Use the monotonic clock for the local times.
+		roundTrip := t3.Sub(t0) - resp.Sent.Sub(resp.Received)
+		if rtt >= 0 && roundTrip >= rtt {
+			continue
+		}
+		rtt = roundTrip
+		offset = (resp.Received.Sub(t0.Round(0)) + resp.Sent.Sub(t3.Round(0))) / 2
+	}
+	return offset, rtt, nil
+}
@@ -0,0 +1,288 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ostcar/oswstest/config"
+	"github.com/ostcar/oswstest/result"
+	"github.com/ostcar/oswstest/runner"
+)
+
+// StartDelay is the time between sending the start request to the agents and
+// the start of the tests. It has to be long enough to reach all agents.
+var StartDelay = 2 * time.Second
+
+// PollInterval is the time between two status requests to an agent.
+var PollInterval = time.Second
+
+// Coordinator distributes the clients of a configuration to agents and
+// merges there results.
+type Coordinator struct {
+	cfg    *config.Config
+	agents []string
+	client *http.Client
+}
+
+// NewCoordinator creates a coordinator for the agents. The agents are
+// addresses like "loadgen1.example.com:9000" or DNS SRV records like
+// "srv:_oswstest._tcp.example.com". The clients are split between the agents,
+// that are available, when Run is called.
+func NewCoordinator(cfg *config.Config, agents []string) *Coordinator {
+	return &Coordinator{cfg: cfg, agents: agents, client: &http.Client{}}
+}
+
+// restoreTimeout is the time to restore the state of the server after a run.
+const restoreTimeout = time.Minute
+
+// prepareServer prepares the data on the server once for all agents. The
+// returned function restores it. It is not canceled by ctx, so the server is
+// also cleaned up after an interrupt.
+func prepareServer(ctx context.Context, cfg *config.Config) (restore func(), err error) {
+	server, err := runner.PrepareServer(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("can not prepare the server: %s", err)
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), restoreTimeout)
+		defer cancel()
+		if err := server.Restore(ctx); err != nil {
+			log.Printf("Can not restore the state of the server, %s", err)
+		}
+	}, nil
+}
+
+// shardConfig returns the configuration of the agent i of n agents. The
+// coordinator prepares and restores the server once, so the agents do not
+// import the fixture, create or cleanup users, seed, inflate or restore.
+func shardConfig(cfg *config.Config, i, n int) *config.Config {
+	shard := *cfg
+	shard.ShardIndex = i
+	shard.ShardCount = n
+	shard.AgentListen = ""
+	shard.Agents = nil
+	shard.FixtureFile = ""
+	shard.CreateUsers = false
+	shard.CleanupUsers = ""
+	shard.Seed = false
+	shard.DataVolume = 0
+	shard.RestoreState = false
+	return &shard
+}
+
+// Run prepares the server and all agents, runs the tests on them and
+// publishes the merged results of each test to the sinks. The sinks are
+// closed afterwards.
+func (c *Coordinator) Run(ctx context.Context, tests []string, sinks []result.Sink) error {
+	defer func() {
+		for _, sink := range sinks {
+			if err := sink.Close(); err != nil {
+				log.Printf("Can not close result sink, %s", err)
+			}
+		}
+	}()
+
+	agents, err := c.discoverAgents(ctx)
+	if err != nil {
+		return err
+	}
+
+	restore, err := prepareServer(ctx, c.cfg)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	err = c.all(agents, func(i int, agent string) error {
+		return c.post(ctx, agent, "/prepare", prepareRequest{Config: shardConfig(c.cfg, i, len(agents))}, nil)
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Prepared %d agents.", len(agents))
+
+	// Measure the clock offsets, so all agents start at the same time, even if
+	// there clocks differ.
+	offsets := make([]time.Duration, len(agents))
+	err = c.all(agents, func(i int, agent string) error {
+		offset, rtt, err := measureOffset(func() (clockResponse, error) {
+			var resp clockResponse
+			return resp, c.get(ctx, agent, "/clock", &resp)
+		})
+		if err != nil {
+			return err
+		}
+		if offset > MaxClockOffset || offset < -MaxClockOffset {
+			log.Printf("The clock of agent %s differs by %s (round trip %s)", agent, offset, rtt)
+		}
+		offsets[i] = offset
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	startAt := time.Now().Add(StartDelay)
+	err = c.all(agents, func(i int, agent string) error {
+		start := startRequest{Tests: tests, StartAt: startAt.Add(offsets[i])}
+		return c.post(ctx, agent, "/start", start, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	agentResults := make([][]testResults, len(agents))
+	err = c.all(agents, func(i int, agent string) error {
+		if err := c.wait(ctx, agent); err != nil {
+			return err
+		}
+		return c.get(ctx, agent, "/results", &agentResults[i])
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, tr := range mergeResults(agentResults) {
+		for _, sink := range sinks {
+			if err := sink.Publish(tr.test, tr.results); err != nil {
+				log.Printf("Can not publish results of %s, %s", tr.test, err)
+			}
+		}
+	}
+	return nil
+}
+
+// all calls f for each agent in parallel and returns the first error.
+func (c *Coordinator) all(agents []string, f func(i int, agent string) error) error {
+	errs := make([]error, len(agents))
+	var wg sync.WaitGroup
+	for i, agent := range agents {
+		wg.Add(1)
+		go func(i int, agent string) {
+			defer wg.Done()
+			if err := f(i, agent); err != nil {
+				errs[i] = fmt.Errorf("agent %s: %s", agent, err)
+			}
+		}(i, agent)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wait polls the status of an agent until its tests are done. If ctx is
+// canceled, the agent is stopped.
+func (c *Coordinator) wait(ctx context.Context, agent string) error {
+	tick := time.NewTicker(PollInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			c.post(context.Background(), agent, "/stop", struct{}{}, nil)
+			return ctx.Err()
+		case <-tick.C:
+		}
+
+		var s status
+		if err := c.get(ctx, agent, "/status", &s); err != nil {
+			return err
+		}
+		if s.State == StateDone {
+			return nil
+		}
+	}
+}
+
+// post sends body as json to an agent and decodes the response into v, if v
+// is not nil.
+func (c *Coordinator) post(ctx context.Context, agent, path string, body, v interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", "http://"+agent+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(ctx, req, v)
+}
+
+// get requests a path of an agent and decodes the json response into v.
+func (c *Coordinator) get(ctx context.Context, agent, path string, v interface{}) error {
+	req, err := http.NewRequest("GET", "http://"+agent+path, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, req, v)
+}
+
+// do sends a request to an agent and decodes the json response into v, if v
+// is not nil.
+func (c *Coordinator) do(ctx context.Context, req *http.Request, v interface{}) error {
+	path := req.URL.Path
+	req = req.WithContext(ctx)
+	if c.cfg.JoinToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.JoinToken)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s returned %s: %s", path, resp.Status, bytes.TrimSpace(msg))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type mergedTest struct {
+	test    string
+	results []*result.TestResult
+}
+
+// mergeResults merges the results of the agents. The tests and the results
+// are in the order, in which they first appear.
+func mergeResults(agentResults [][]testResults) []mergedTest {
+	var merged []mergedTest
+	testIndex := make(map[string]int)
+	byDescription := make(map[string]map[string]*result.TestResult)
+
+	for _, tests := range agentResults {
+		for _, tr := range tests {
+			i, ok := testIndex[tr.Test]
+			if !ok {
+				i = len(merged)
+				testIndex[tr.Test] = i
+				merged = append(merged, mergedTest{test: tr.Test})
+				byDescription[tr.Test] = make(map[string]*result.TestResult)
+			}
+			for _, r := range fromWire(tr.Results) {
+				existing, ok := byDescription[tr.Test][r.Description()]
+				if !ok {
+					byDescription[tr.Test][r.Description()] = r
+					merged[i].results = append(merged[i].results, r)
+					continue
+				}
+				existing.Merge(r)
+			}
+		}
+	}
+	return merged
+}
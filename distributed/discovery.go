@@ -0,0 +1,74 @@
+package distributed
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// DiscoveryTimeout is the time, an agent has to answer, when the coordinator
+// checks, if it is available.
+var DiscoveryTimeout = 5 * time.Second
+
+// resolveAddresses expands the addresses of agents or coordinators. An
+// address like "srv:_oswstest._tcp.example.com" is replaced by the targets
+// of the DNS SRV record. Other addresses are used as they are.
+func resolveAddresses(ctx context.Context, addrs []string) ([]string, error) {
+	var resolved []string
+	for _, addr := range addrs {
+		if !strings.HasPrefix(addr, "srv:") {
+			resolved = append(resolved, addr)
+			continue
+		}
+
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", strings.TrimPrefix(addr, "srv:"))
+		if err != nil {
+			return nil, fmt.Errorf("can not lookup %s: %s", addr, err)
+		}
+		for _, r := range records {
+			host := strings.TrimSuffix(r.Target, ".")
+			resolved = append(resolved, net.JoinHostPort(host, fmt.Sprint(r.Port)))
+		}
+	}
+	return resolved, nil
+}
+
+// discoverAgents resolves the addresses of the agents and returns the agents,
+// that answer. The clients are only split between them.
+func (c *Coordinator) discoverAgents(ctx context.Context) ([]string, error) {
+	addrs, err := resolveAddresses(ctx, c.agents)
+	if err != nil {
+		return nil, err
+	}
+
+	available := make([]bool, len(addrs))
+	c.all(addrs, func(i int, agent string) error {
+		ctx, cancel := context.WithTimeout(ctx, DiscoveryTimeout)
+		defer cancel()
+		var s status
+		if err := c.get(ctx, agent, "/status", &s); err != nil {
+			log.Printf("Skip agent %s, %s", agent, err)
+			return nil
+		}
+		if s.State == StateRunning {
+			log.Printf("Skip agent %s, it is running tests", agent)
+			return nil
+		}
+		available[i] = true
+		return nil
+	})
+
+	var agents []string
+	for i, addr := range addrs {
+		if available[i] {
+			agents = append(agents, addr)
+		}
+	}
+	if len(agents) == 0 {
+		return nil, fmt.Errorf("no agent is available")
+	}
+	return agents, nil
+}
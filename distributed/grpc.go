@@ -0,0 +1,229 @@
+package distributed
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+
+	"github.com/ostcar/oswstest/config"
+	"github.com/ostcar/oswstest/result"
+)
+
+// The control plane between the coordinator and the agents is the grpc
+// service "oswstest.Control". It does not use protobuf. The messages are
+// encoded as json with the content subtype "json", so the content type is
+// "application/grpc+json". The fields of each message are the json tags of the
+// structs below. Times are RFC 3339 strings and durations are nanoseconds.
+//
+// The methods are:
+//
+//	Clock(empty) clockResponse
+//	    returns the time of the coordinator, to measure the clock offset
+//	Register(registerRequest) registerResponse
+//	    adds an agent, the token has to be the join token of the coordinator
+//	Commands(commandsRequest) stream command
+//	    streams the commands "prepare", "start" and "stop" to an agent, the
+//	    config of "prepare" is a config.Config as json
+//	Ready(readyRequest) empty
+//	    tells the coordinator, that the clients of the agent are prepared
+//	Samples(stream Sample) empty
+//	    streams the samples of the running tests to the coordinator
+//	Results(resultsRequest) empty
+//	    sends the results of all tests to the coordinator
+//
+// A client of an other language needs a grpc library with a custom codec.
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// jsonCodec encodes the grpc messages as json.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return "json" }
+
+type empty struct{}
+
+type registerRequest struct {
+	Name  string `json:"name"`
+	Token string `json:"token,omitempty"`
+
+	// ClockOffset is the time, that has to be added to the clock of the agent
+	// to get the clock of the coordinator.
+	ClockOffset time.Duration `json:"clock_offset_ns"`
+}
+
+type registerResponse struct {
+	AgentID int64 `json:"agent_id"`
+}
+
+type commandsRequest struct {
+	AgentID int64 `json:"agent_id"`
+}
+
+// The types of the commands.
+const (
+	commandPrepare = "prepare"
+	commandStart   = "start"
+	commandStop    = "stop"
+)
+
+type command struct {
+	Type    string         `json:"type"`
+	Config  *config.Config `json:"config,omitempty"`
+	Tests   []string       `json:"tests,omitempty"`
+	StartAt time.Time      `json:"start_at"`
+}
+
+type readyRequest struct {
+	AgentID int64  `json:"agent_id"`
+	Clients int    `json:"clients"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Sample is a sample of a running test on an agent. The coordinator corrects
+// the time of the sample to its own clock.
+type Sample struct {
+	AgentID int64         `json:"agent_id"`
+	At      time.Time     `json:"at"`
+	Test    string        `json:"test"`
+	Name    string        `json:"name"`
+	Labels  result.Labels `json:"labels,omitempty"`
+	Value   time.Duration `json:"value_ns"`
+	Error   string        `json:"error,omitempty"`
+}
+
+type resultsRequest struct {
+	AgentID int64         `json:"agent_id"`
+	Tests   []testResults `json:"tests"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// controlServer is implemented by the coordinator.
+type controlServer interface {
+	Clock(context.Context, *empty) (*clockResponse, error)
+	Register(context.Context, *registerRequest) (*registerResponse, error)
+	Commands(*commandsRequest, grpc.ServerStream) error
+	Ready(context.Context, *readyRequest) (*empty, error)
+	Samples(grpc.ServerStream) error
+	Results(context.Context, *resultsRequest) (*empty, error)
+}
+
+const controlService = "oswstest.Control"
+
+// unaryHandler creates the grpc handler for a unary method.
+func unaryHandler(method string, newReq func() interface{}, call func(srv controlServer, ctx context.Context, req interface{}) (interface{}, error)) func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := newReq()
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv.(controlServer), ctx, req)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + controlService + "/" + method}
+		return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(srv.(controlServer), ctx, req)
+		})
+	}
+}
+
+var controlServiceDesc = grpc.ServiceDesc{
+	ServiceName: controlService,
+	HandlerType: (*controlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Clock",
+			Handler: unaryHandler("Clock", func() interface{} { return new(empty) }, func(srv controlServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.Clock(ctx, req.(*empty))
+			}),
+		},
+		{
+			MethodName: "Register",
+			Handler: unaryHandler("Register", func() interface{} { return new(registerRequest) }, func(srv controlServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.Register(ctx, req.(*registerRequest))
+			}),
+		},
+		{
+			MethodName: "Ready",
+			Handler: unaryHandler("Ready", func() interface{} { return new(readyRequest) }, func(srv controlServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.Ready(ctx, req.(*readyRequest))
+			}),
+		},
+		{
+			MethodName: "Results",
+			Handler: unaryHandler("Results", func() interface{} { return new(resultsRequest) }, func(srv controlServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.Results(ctx, req.(*resultsRequest))
+			}),
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Commands",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				req := new(commandsRequest)
+				if err := stream.RecvMsg(req); err != nil {
+					return err
+				}
+				return srv.(controlServer).Commands(req, stream)
+			},
+			ServerStreams: true,
+		},
+		{
+			StreamName: "Samples",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(controlServer).Samples(stream)
+			},
+			ClientStreams: true,
+		},
+	},
+}
+
+// controlClient calls the control service of the coordinator.
+type controlClient struct {
+	cc *grpc.ClientConn
+}
+
+func (c *controlClient) invoke(ctx context.Context, method string, req, resp interface{}) error {
+	return c.cc.Invoke(ctx, "/"+controlService+"/"+method, req, resp, grpc.CallContentSubtype("json"))
+}
+
+func (c *controlClient) clock(ctx context.Context) (clockResponse, error) {
+	var resp clockResponse
+	return resp, c.invoke(ctx, "Clock", new(empty), &resp)
+}
+
+func (c *controlClient) register(ctx context.Context, req *registerRequest) (*registerResponse, error) {
+	resp := new(registerResponse)
+	return resp, c.invoke(ctx, "Register", req, resp)
+}
+
+func (c *controlClient) ready(ctx context.Context, req *readyRequest) error {
+	return c.invoke(ctx, "Ready", req, new(empty))
+}
+
+func (c *controlClient) results(ctx context.Context, req *resultsRequest) error {
+	return c.invoke(ctx, "Results", req, new(empty))
+}
+
+// commands opens the stream of commands.
+func (c *controlClient) commands(ctx context.Context, req *commandsRequest) (grpc.ClientStream, error) {
+	stream, err := c.cc.NewStream(ctx, &controlServiceDesc.Streams[0], "/"+controlService+"/Commands", grpc.CallContentSubtype("json"))
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(req); err != nil {
+		return nil, err
+	}
+	return stream, stream.CloseSend()
+}
+
+// samples opens the stream for the samples.
+func (c *controlClient) samples(ctx context.Context) (grpc.ClientStream, error) {
+	return c.cc.NewStream(ctx, &controlServiceDesc.Streams[1], "/"+controlService+"/Samples", grpc.CallContentSubtype("json"))
+}
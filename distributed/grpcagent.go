@@ -0,0 +1,184 @@
+package distributed
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/ostcar/oswstest/client"
+	"github.com/ostcar/oswstest/config"
+	"github.com/ostcar/oswstest/result"
+	"github.com/ostcar/oswstest/runner"
+)
+
+// SampleBuffer is the number of samples, an agent buffers before it sends them
+// to the coordinator. If the buffer is full, samples are dropped, so the tests
+// are not slowed down.
+var SampleBuffer = 10000
+
+// RunGRPCAgent connects to the grpc coordinator of the configuration and runs
+// its commands until the coordinator closes the connection or ctx is
+// canceled. The address of the coordinator can be a DNS SRV record like
+// "srv:_oswstest-coordinator._tcp.example.com". If factory is nil, the default
+// factory is used. The hook commands are only taken from cfg, not from the
+// configuration of the coordinator.
+func RunGRPCAgent(ctx context.Context, cfg *config.Config, factory client.ClientFactory) error {
+	addrs, err := resolveAddresses(ctx, []string{cfg.Coordinator})
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("no coordinator found for %s", cfg.Coordinator)
+	}
+
+	cc, err := grpc.Dial(addrs[0], grpc.WithInsecure())
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+	control := &controlClient{cc: cc}
+
+	offset, rtt, err := measureOffset(func() (clockResponse, error) {
+		return control.clock(ctx)
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("The clock of the coordinator differs by %s (round trip %s)", offset, rtt)
+
+	name, _ := os.Hostname()
+	reg, err := control.register(ctx, &registerRequest{Name: name, Token: cfg.JoinToken, ClockOffset: offset})
+	if err != nil {
+		return err
+	}
+	agentID := reg.AgentID
+
+	samples, err := control.samples(ctx)
+	if err != nil {
+		return err
+	}
+	sampleChan := make(chan Sample, SampleBuffer)
+	var dropped int64
+	sendDone := make(chan struct{})
+	go func() {
+		defer close(sendDone)
+		for s := range sampleChan {
+			if err := samples.SendMsg(&s); err != nil {
+				log.Printf("Can not send sample, %s", err)
+				return
+			}
+		}
+		samples.CloseSend()
+		samples.RecvMsg(new(empty))
+	}()
+	defer func() {
+		close(sampleChan)
+		<-sendDone
+		if n := atomic.LoadInt64(&dropped); n > 0 {
+			log.Printf("Dropped %d samples", n)
+		}
+	}()
+
+	commands, err := control.commands(ctx, &commandsRequest{AgentID: agentID})
+	if err != nil {
+		return err
+	}
+
+	var (
+		env     *runner.Env
+		mu      sync.Mutex
+		current string
+		cancel  = func() {}
+		running sync.WaitGroup
+	)
+	defer running.Wait()
+	defer func() { cancel() }()
+
+	for {
+		var cmd command
+		err := commands.RecvMsg(&cmd)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch cmd.Type {
+		case commandPrepare:
+			f := factory
+			if f == nil {
+				f = client.NewFactory(cmd.Config)
+			}
+			ready := readyRequest{AgentID: agentID}
+			env, err = runner.NewEnv(ctx, cmd.Config, f)
+			if err != nil {
+				ready.Error = err.Error()
+			} else {
+				ready.Clients = len(env.Clients)
+				env.Hooks = runner.CommandHooks(cfg)
+				env.Hooks.BeforeTest = append(env.Hooks.BeforeTest, func(env *runner.Env, test runner.Test) error {
+					mu.Lock()
+					defer mu.Unlock()
+					current = test.Name()
+					return nil
+				})
+				env.OnSample = func(name string, labels result.Labels, value time.Duration, err error) {
+					mu.Lock()
+					s := Sample{AgentID: agentID, At: time.Now(), Test: current, Name: name, Labels: labels, Value: value}
+					mu.Unlock()
+					if err != nil {
+						s.Error = err.Error()
+					}
+					select {
+					case sampleChan <- s:
+					default:
+						atomic.AddInt64(&dropped, 1)
+					}
+				}
+			}
+			if err := control.ready(ctx, &ready); err != nil {
+				return err
+			}
+
+		case commandStart:
+			runCtx, stop := context.WithCancel(ctx)
+			cancel = stop
+			running.Add(1)
+			go func(cmd command, env *runner.Env) {
+				defer running.Done()
+				defer stop()
+				req := resultsRequest{AgentID: agentID}
+				tests, err := runner.TestsByName(cmd.Tests)
+				if err != nil || env == nil {
+					req.Error = "agent is not prepared"
+					if err != nil {
+						req.Error = err.Error()
+					}
+				} else {
+					select {
+					// The start time is on the clock of the coordinator.
+					case <-time.After(time.Until(cmd.StartAt.Add(-offset))):
+						sink := &recordSink{record: func(tr testResults) { req.Tests = append(req.Tests, tr) }}
+						runner.RunTests(runCtx, env, tests, []result.Sink{sink})
+					case <-runCtx.Done():
+						req.Error = runCtx.Err().Error()
+					}
+				}
+				if err := control.results(ctx, &req); err != nil {
+					log.Printf("Can not send results, %s", err)
+				}
+			}(cmd, env)
+
+		case commandStop:
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package distributed
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/ostcar/oswstest/config"
+	"github.com/ostcar/oswstest/result"
+)
+
+// PrepareTimeout is the time, the agents of the grpc coordinator have to create
+// and log in there clients.
+var PrepareTimeout = 10 * time.Minute
+
+// RunTimeout is the time, the grpc coordinator waits for the results of the
+// agents after the start. Zero means, that each test may take TestTimeout.
+// Without TestTimeout, the coordinator waits until each agent has send its
+// results or has left.
+var RunTimeout time.Duration
+
+// GRPCCoordinator is a coordinator, that the agents connect to with grpc. The
+// agents register themselves, get there configuration and the start command
+// over a stream and stream there samples back while the tests run.
+type GRPCCoordinator struct {
+	cfg    *config.Config
+	server *grpc.Server
+
+	// OnSample is called for each sample, that an agent streams, if it is not
+	// nil.
+	OnSample func(Sample)
+
+	mu         sync.Mutex
+	nextID     int64
+	agents     map[int64]*grpcAgent
+	registered chan struct{}
+}
+
+// grpcAgent is an agent, that is registered at the coordinator.
+type grpcAgent struct {
+	id       int64
+	name     string
+	offset   time.Duration
+	commands chan command
+	ready    chan readyRequest
+	results  chan resultsRequest
+
+	// done is closed, when the command stream of the agent ends.
+	done chan struct{}
+}
+
+// send sends a command to the agent. It fails, if the agent has left.
+func (a *grpcAgent) send(ctx context.Context, cmd command) error {
+	select {
+	case a.commands <- cmd:
+		return nil
+	case <-a.done:
+		return fmt.Errorf("agent %s left", a.name)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitReady waits until the agent is ready. It fails, if the agent has left.
+func (a *grpcAgent) waitReady(ctx context.Context) (readyRequest, error) {
+	select {
+	case ready := <-a.ready:
+		return ready, nil
+	case <-a.done:
+		// The agent could have left right after it was ready.
+		select {
+		case ready := <-a.ready:
+			return ready, nil
+		default:
+			return readyRequest{}, fmt.Errorf("agent %s left", a.name)
+		}
+	case <-ctx.Done():
+		return readyRequest{}, ctx.Err()
+	}
+}
+
+// waitResults waits for the results of the agent. It fails, if the agent has
+// left without results.
+func (a *grpcAgent) waitResults(ctx context.Context) (resultsRequest, error) {
+	select {
+	case r := <-a.results:
+		return r, nil
+	case <-a.done:
+		// The agent could have left right after it has send its results.
+		select {
+		case r := <-a.results:
+			return r, nil
+		default:
+			return resultsRequest{}, fmt.Errorf("agent %s left without results", a.name)
+		}
+	case <-ctx.Done():
+		return resultsRequest{}, ctx.Err()
+	}
+}
+
+// NewGRPCCoordinator creates a grpc coordinator.
+func NewGRPCCoordinator(cfg *config.Config) *GRPCCoordinator {
+	c := &GRPCCoordinator{
+		cfg:        cfg,
+		agents:     make(map[int64]*grpcAgent),
+		registered: make(chan struct{}, 1),
+	}
+	c.server = grpc.NewServer()
+	c.server.RegisterService(&controlServiceDesc, c)
+	return c
+}
+
+// Serve accepts the connections of the agents on the listener. It blocks
+// until Stop is called.
+func (c *GRPCCoordinator) Serve(lis net.Listener) error {
+	return c.server.Serve(lis)
+}
+
+// Stop closes all connections.
+func (c *GRPCCoordinator) Stop() {
+	c.server.Stop()
+}
+
+// Clock returns the time of the coordinator.
+func (c *GRPCCoordinator) Clock(ctx context.Context, req *empty) (*clockResponse, error) {
+	resp := &clockResponse{Received: time.Now()}
+	resp.Sent = time.Now()
+	return resp, nil
+}
+
+// Register adds an agent. If the coordinator has a join token, the agent has
+// to send the same token. It is compared in constant time.
+func (c *GRPCCoordinator) Register(ctx context.Context, req *registerRequest) (*registerResponse, error) {
+	if c.cfg.JoinToken != "" && subtle.ConstantTimeCompare([]byte(req.Token), []byte(c.cfg.JoinToken)) != 1 {
+		log.Printf("Reject agent %s with an invalid join token", req.Name)
+		return nil, fmt.Errorf("invalid join token")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	c.agents[c.nextID] = &grpcAgent{
+		id:       c.nextID,
+		name:     req.Name,
+		offset:   req.ClockOffset,
+		commands: make(chan command, 4),
+		ready:    make(chan readyRequest, 1),
+		results:  make(chan resultsRequest, 1),
+		done:     make(chan struct{}),
+	}
+	log.Printf("Agent %s registered as %d", req.Name, c.nextID)
+	if req.ClockOffset > MaxClockOffset || req.ClockOffset < -MaxClockOffset {
+		log.Printf("The clock of agent %s differs by %s", req.Name, -req.ClockOffset)
+	}
+
+	select {
+	case c.registered <- struct{}{}:
+	default:
+	}
+	return &registerResponse{AgentID: c.nextID}, nil
+}
+
+func (c *GRPCCoordinator) agent(id int64) (*grpcAgent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	a, ok := c.agents[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown agent %d", id)
+	}
+	return a, nil
+}
+
+// Commands sends the commands to an agent. When the stream ends, the agent is
+// removed and its done channel is closed.
+func (c *GRPCCoordinator) Commands(req *commandsRequest, stream grpc.ServerStream) error {
+	a, err := c.agent(req.AgentID)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if _, ok := c.agents[a.id]; ok {
+			delete(c.agents, a.id)
+			close(a.done)
+		}
+		log.Printf("Agent %s left", a.name)
+	}()
+
+	for {
+		select {
+		case cmd := <-a.commands:
+			if err := stream.SendMsg(&cmd); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// Ready is called by an agent, when its clients are prepared.
+func (c *GRPCCoordinator) Ready(ctx context.Context, req *readyRequest) (*empty, error) {
+	a, err := c.agent(req.AgentID)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case a.ready <- *req:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return new(empty), nil
+}
+
+// Samples receives the samples of an agent. The time of the samples is
+// corrected by the clock offset of the agent.
+func (c *GRPCCoordinator) Samples(stream grpc.ServerStream) error {
+	for {
+		var s Sample
+		err := stream.RecvMsg(&s)
+		if err == io.EOF {
+			return stream.SendMsg(new(empty))
+		}
+		if err != nil {
+			return err
+		}
+		if a, err := c.agent(s.AgentID); err == nil {
+			s.At = s.At.Add(a.offset)
+		}
+		if c.OnSample != nil {
+			c.OnSample(s)
+		}
+	}
+}
+
+// Results is called by an agent, when its tests are done.
+func (c *GRPCCoordinator) Results(ctx context.Context, req *resultsRequest) (*empty, error) {
+	a, err := c.agent(req.AgentID)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case a.results <- *req:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return new(empty), nil
+}
+
+// waitForAgents blocks until at least min agents are registered and at least
+// AgentWait has passed. It returns the agents sorted by there id.
+func (c *GRPCCoordinator) waitForAgents(ctx context.Context, min int) ([]*grpcAgent, error) {
+	waitUntil := time.Now().Add(c.cfg.AgentWait)
+	for {
+		c.mu.Lock()
+		agents := make([]*grpcAgent, 0, len(c.agents))
+		for _, a := range c.agents {
+			agents = append(agents, a)
+		}
+		c.mu.Unlock()
+
+		if len(agents) >= min && len(agents) > 0 && !time.Now().Before(waitUntil) {
+			sort.Slice(agents, func(i, j int) bool { return agents[i].id < agents[j].id })
+			return agents, nil
+		}
+
+		select {
+		case <-c.registered:
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Run waits until min agents are registered, prepares the server once and
+// splits the clients between all agents, that are registered at this time.
+// When all agents are ready, it
+// starts the tests on all of them at the same time. The merged results are
+// published to the sinks. The sinks are closed afterwards.
+//
+// The agents have PrepareTimeout to get ready and RunTimeout to send there
+// results. If an agent leaves before, Run fails.
+func (c *GRPCCoordinator) Run(ctx context.Context, min int, tests []string, sinks []result.Sink) error {
+	defer func() {
+		for _, sink := range sinks {
+			if err := sink.Close(); err != nil {
+				log.Printf("Can not close result sink, %s", err)
+			}
+		}
+	}()
+
+	log.Printf("Wait for %d agents", min)
+	agents, err := c.waitForAgents(ctx, min)
+	if err != nil {
+		return err
+	}
+
+	restore, err := prepareServer(ctx, c.cfg)
+	if err != nil {
+		c.stopAll(agents)
+		return err
+	}
+	defer restore()
+
+	prepareCtx, cancelPrepare := context.WithTimeout(ctx, PrepareTimeout)
+	defer cancelPrepare()
+	for i, a := range agents {
+		if err := a.send(prepareCtx, command{Type: commandPrepare, Config: shardConfig(c.cfg, i, len(agents))}); err != nil {
+			c.stopAll(agents)
+			return err
+		}
+	}
+
+	// Barrier: wait until all agents are ready.
+	for _, a := range agents {
+		ready, err := a.waitReady(prepareCtx)
+		if err != nil {
+			c.stopAll(agents)
+			return fmt.Errorf("agent %s is not ready: %s", a.name, err)
+		}
+		if ready.Error != "" {
+			c.stopAll(agents)
+			return fmt.Errorf("agent %s: %s", a.name, ready.Error)
+		}
+		log.Printf("Agent %s is ready with %d clients", a.name, ready.Clients)
+	}
+
+	runCtx := ctx
+	timeout := RunTimeout
+	count := len(tests)
+	if count == 0 {
+		count = len(c.cfg.Tests)
+	}
+	if timeout == 0 && c.cfg.TestTimeout > 0 && count > 0 {
+		timeout = StartDelay + time.Duration(count)*c.cfg.TestTimeout
+	}
+	if timeout > 0 {
+		var cancelRun context.CancelFunc
+		runCtx, cancelRun = context.WithTimeout(ctx, timeout)
+		defer cancelRun()
+	}
+
+	start := command{Type: commandStart, Tests: tests, StartAt: time.Now().Add(StartDelay)}
+	for _, a := range agents {
+		if err := a.send(runCtx, start); err != nil {
+			c.stopAll(agents)
+			return err
+		}
+	}
+
+	agentResults := make([][]testResults, len(agents))
+	for i, a := range agents {
+		r, err := a.waitResults(runCtx)
+		if err != nil {
+			c.stopAll(agents)
+			return fmt.Errorf("no results of agent %s: %s", a.name, err)
+		}
+		if r.Error != "" {
+			return fmt.Errorf("agent %s: %s", a.name, r.Error)
+		}
+		agentResults[i] = r.Tests
+	}
+
+	for _, tr := range mergeResults(agentResults) {
+		for _, sink := range sinks {
+			if err := sink.Publish(tr.test, tr.results); err != nil {
+				log.Printf("Can not publish results of %s, %s", tr.test, err)
+			}
+		}
+	}
+	return nil
+}
+
+// stopAll sends the stop command to the agents.
+func (c *GRPCCoordinator) stopAll(agents []*grpcAgent) {
+	for _, a := range agents {
+		select {
+		case a.commands <- command{Type: commandStop}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Package distributed runs the tests on many machines. Agents each drive a
+// share of the clients. A coordinator sends them the configuration, starts
+// the tests on all agents at the same time and merges there results.
+package distributed
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ostcar/oswstest/config"
+	"github.com/ostcar/oswstest/result"
+)
+
+// prepareRequest is send by the coordinator to create and login the clients
+// of an agent.
+type prepareRequest struct {
+	Config *config.Config `json:"config"`
+}
+
+// startRequest is send to start tests. Without tests, the tests of the
+// configuration are started. Without a start time, they start at once.
+type startRequest struct {
+	Tests   []string  `json:"tests"`
+	StartAt time.Time `json:"start_at"`
+}
+
+// wireResult is a result.TestResult in json.
+type wireResult struct {
+	Description string          `json:"description"`
+	Values      []time.Duration `json:"values"`
+	Stats       *result.Stats   `json:"stats,omitempty"`
+	Errors      []string        `json:"errors"`
+}
+
+// testResults are the results of one test.
+type testResults struct {
+	Test    string       `json:"test"`
+	Results []wireResult `json:"results"`
+}
+
+func toWire(results []*result.TestResult) []wireResult {
+	wire := make([]wireResult, len(results))
+	for i, r := range results {
+		wire[i] = wireResult{Description: r.Description(), Values: r.Values()}
+		if r.Streaming() {
+			stats := r.Stats()
+			wire[i].Stats = &stats
+		}
+		for _, err := range r.Errors() {
+			wire[i].Errors = append(wire[i].Errors, err.Error())
+		}
+	}
+	return wire
+}
+
+func fromWire(wire []wireResult) []*result.TestResult {
+	results := make([]*result.TestResult, len(wire))
+	for i, w := range wire {
+		r := result.New(w.Description)
+		if w.Stats != nil {
+			r = result.NewStreaming(w.Description)
+			r.AddStats(*w.Stats)
+		}
+		for _, v := range w.Values {
+			r.Add(v)
+		}
+		for _, e := range w.Errors {
+			r.AddError(errors.New(e))
+		}
+		results[i] = r
+	}
+	return results
+}
@@ -0,0 +1,118 @@
+// Package fakedata generates random, but realistic looking data for the write
+// requests, like motion texts, names and amendments.
+//
+// The entropy of the texts is controlled by the size of the vocabulary. With a
+// small vocabulary, the texts repeat the same words and compress well, with a
+// big one they look more like real texts.
+package fakedata
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var firstNames = []string{
+	"Anna", "Ben", "Clara", "David", "Emma", "Felix", "Greta", "Hannes", "Ida", "Jonas",
+	"Katharina", "Lukas", "Marie", "Noah", "Olga", "Paul", "Rosa", "Simon", "Tina", "Ulrich",
+}
+
+var lastNames = []string{
+	"Schmidt", "Müller", "Weber", "Wagner", "Becker", "Hoffmann", "Schulz", "Koch", "Richter", "Klein",
+	"Wolf", "Neumann", "Schwarz", "Braun", "Zimmermann", "Krüger", "Hartmann", "Lange", "Werner", "Krause",
+}
+
+// baseWords are the first words of each vocabulary.
+var baseWords = []string{
+	"the", "assembly", "decides", "to", "support", "motion", "budget", "committee", "member", "vote",
+	"of", "and", "for", "a", "proposal", "council", "report", "amendment", "rules", "procedure",
+	"board", "election", "agenda", "meeting", "shall", "be", "changed", "in", "with", "annual",
+	"fee", "article", "paragraph", "delegates", "statute", "resolution", "office", "public", "new", "draft",
+}
+
+// syllables build the words of a vocabulary, that is bigger then baseWords.
+var syllables = []string{"ra", "ton", "mel", "ki", "sun", "dor", "ve", "lan", "pi", "gus", "ter", "o", "bre", "al", "nu", "ser"}
+
+// Generator generates random data. It can be used from many goroutines.
+type Generator struct {
+	mu         sync.Mutex
+	rand       *rand.Rand
+	vocabulary []string
+}
+
+// New creates a generator. The same seed generates the same data. The texts
+// use vocabulary different words. If vocabulary is smaller then one, only one
+// word is used.
+func New(seed int64, vocabulary int) *Generator {
+	if vocabulary < 1 {
+		vocabulary = 1
+	}
+	words := make([]string, vocabulary)
+	for i := range words {
+		words[i] = word(i)
+	}
+	return &Generator{rand: rand.New(rand.NewSource(seed)), vocabulary: words}
+}
+
+// word returns the i-th word of each vocabulary.
+func word(i int) string {
+	if i < len(baseWords) {
+		return baseWords[i]
+	}
+	i -= len(baseWords)
+	var b strings.Builder
+	for {
+		b.WriteString(syllables[i%len(syllables)])
+		i /= len(syllables)
+		if i == 0 {
+			return b.String()
+		}
+		i--
+	}
+}
+
+// Name returns a random name of a person.
+func (g *Generator) Name() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return firstNames[g.rand.Intn(len(firstNames))] + " " + lastNames[g.rand.Intn(len(lastNames))]
+}
+
+// Title returns a random title of a motion. Every fourth title is the title of
+// an amendment.
+func (g *Generator) Title() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	title := g.sentence(3 + g.rand.Intn(5))
+	title = strings.TrimSuffix(title, ".")
+	if g.rand.Intn(4) == 0 {
+		return "Amendment to line " + strconv.Itoa(1+g.rand.Intn(200)) + ": " + title
+	}
+	return "Motion: " + title
+}
+
+// Text returns a random text with the length in bytes. It consists of
+// sentences of the vocabulary.
+func (g *Generator) Text(length int) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var b strings.Builder
+	for b.Len() < length {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(g.sentence(5 + g.rand.Intn(15)))
+	}
+	return b.String()[:length]
+}
+
+// sentence returns a sentence with count words. g.mu has to be locked.
+func (g *Generator) sentence(count int) string {
+	words := make([]string, count)
+	for i := range words {
+		words[i] = g.vocabulary[g.rand.Intn(len(g.vocabulary))]
+	}
+	s := strings.Join(words, " ")
+	return strings.ToUpper(s[:1]) + s[1:] + "."
+}
@@ -0,0 +1,266 @@
+// Package interactive reads commands from a prompt and runs them against the
+// clients of an environment. It helps to debug a server step by step, where
+// running all tests at once is to coarse.
+package interactive
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ostcar/oswstest/client"
+	"github.com/ostcar/oswstest/result"
+	"github.com/ostcar/oswstest/runner"
+)
+
+const help = `Commands:
+  tests                 list the registered tests
+  run TEST [TEST ...]   run tests and show there results
+  connect               connect the clients, like "run connect"
+  write [N]             send N write requests with the first admin client
+  stats                 show the state of all clients
+  client NAME           show the state of one client
+  watch NAME            show the messages of a client until Ctrl-C
+  results               show the results of the last run again
+  close                 close the connections of the clients
+  help                  show this help
+  quit                  exit
+Ctrl-C aborts the running command.
+`
+
+// Shell runs commands against the clients of an environment.
+type Shell struct {
+	env     *runner.Env
+	out     io.Writer
+	console result.ConsoleOptions
+
+	// last records the results of the last run.
+	last *recorder
+}
+
+// recorder is a sink, that remembers the published results.
+type recorder struct {
+	tests   []string
+	results [][]*result.TestResult
+}
+
+func (r *recorder) Publish(test string, results []*result.TestResult) error {
+	r.tests = append(r.tests, test)
+	r.results = append(r.results, results)
+	return nil
+}
+
+func (r *recorder) Close() error { return nil }
+
+// New returns a shell, that writes its output to out. The results of the
+// tests are shown as a table with the console options.
+func New(env *runner.Env, out io.Writer, console result.ConsoleOptions) *Shell {
+	return &Shell{env: env, out: out, console: console}
+}
+
+// Run reads commands line by line from in until the input ends, the quit
+// command is read or ctx is done.
+func (s *Shell) Run(ctx context.Context, in io.Reader) error {
+	fmt.Fprint(s.out, "Type help for a list of commands.\n")
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(s.out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(s.out)
+			return scanner.Err()
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "quit" || fields[0] == "exit" {
+			return nil
+		}
+		if err := s.do(ctx, fields[0], fields[1:]); err != nil {
+			fmt.Fprintf(s.out, "Error: %s\n", err)
+		}
+	}
+}
+
+// do runs one command. A interrupt cancels the command, but not the shell.
+func (s *Shell) do(ctx context.Context, command string, args []string) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	switch command {
+	case "help":
+		fmt.Fprint(s.out, help)
+	case "tests":
+		for _, info := range runner.TestInfos() {
+			fmt.Fprintln(s.out, info)
+		}
+	case "run":
+		if len(args) == 0 {
+			return fmt.Errorf("run needs at least one test")
+		}
+		return s.run(ctx, args)
+	case "connect":
+		return s.run(ctx, []string{"connect"})
+	case "write":
+		count := 1
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of write requests: %s", args[0])
+			}
+			count = n
+		}
+		return s.write(ctx, count)
+	case "stats":
+		s.stats()
+	case "client":
+		if len(args) != 1 {
+			return fmt.Errorf("client needs the name of a client")
+		}
+		return s.client(args[0])
+	case "watch":
+		if len(args) != 1 {
+			return fmt.Errorf("watch needs the name of a client")
+		}
+		return s.watch(ctx, args[0])
+	case "results":
+		if s.last == nil {
+			return fmt.Errorf("no test was run yet")
+		}
+		sink := result.NewConsoleSinkWithOptions(s.out, s.console)
+		for i, test := range s.last.tests {
+			sink.Publish(test, s.last.results[i])
+		}
+		return sink.Close()
+	case "close":
+		runner.CloseClients(s.env.Clients)
+		fmt.Fprintln(s.out, "All connections are closed.")
+	default:
+		return fmt.Errorf("unknown command %s, type help for a list of commands", command)
+	}
+	return nil
+}
+
+// run runs tests by there names and shows the results.
+func (s *Shell) run(ctx context.Context, names []string) error {
+	tests, err := runner.TestsByName(names)
+	if err != nil {
+		return err
+	}
+	s.last = new(recorder)
+	runner.RunTests(ctx, s.env, tests, []result.Sink{result.NewConsoleSinkWithOptions(s.out, s.console), s.last})
+	return nil
+}
+
+// write sends count write requests one after the other with the first
+// admin client and shows the time of each request.
+func (s *Shell) write(ctx context.Context, count int) error {
+	var admin client.AdminClient
+	for _, c := range s.env.Clients {
+		a, ok := c.(client.AdminClient)
+		if ok && a.IsAdmin() {
+			admin = a
+			break
+		}
+	}
+	if admin == nil {
+		return fmt.Errorf("there is no admin client")
+	}
+
+	for i := 1; i <= count; i++ {
+		start := time.Now()
+		if err := admin.Send(ctx); err != nil {
+			return fmt.Errorf("write request %d of %d: %w", i, count, err)
+		}
+		fmt.Fprintf(s.out, "Write request %d of %d by %s took %dms\n", i, count, admin, time.Since(start)/time.Millisecond)
+	}
+	return nil
+}
+
+// stats shows the number of clients in each state and the received messages.
+func (s *Shell) stats() {
+	var connected, closed, expecting, received, queued int
+	for _, c := range s.env.Clients {
+		state := c.State()
+		switch {
+		case !state.Connected:
+		case state.CloseInfo != nil:
+			closed++
+		default:
+			connected++
+		}
+		if state.Expecting {
+			expecting++
+		}
+		received += state.Received
+		queued += state.Queued
+	}
+	fmt.Fprintf(s.out, "Clients:   %d\n", len(s.env.Clients))
+	fmt.Fprintf(s.out, "Connected: %d\n", connected)
+	fmt.Fprintf(s.out, "Closed:    %d\n", closed)
+	fmt.Fprintf(s.out, "Waiting:   %d\n", expecting)
+	fmt.Fprintf(s.out, "Received:  %d messages, %d queued\n", received, queued)
+}
+
+// client shows the state of the client with the name.
+func (s *Shell) client(name string) error {
+	var found bool
+	for _, c := range s.env.Clients {
+		if c.String() != name && !strings.HasPrefix(c.String(), name+" ") {
+			continue
+		}
+		fmt.Fprintf(s.out, "%s: %s\n", c, c.State())
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("there is no client %s", name)
+	}
+	return nil
+}
+
+// watchLength is the number of bytes of a message, that watch shows.
+const watchLength = 200
+
+// watch shows the messages, the client with the name receives, until ctx is
+// done. It subscribes to the client, so the messages are still read by the
+// tests.
+func (s *Shell) watch(ctx context.Context, name string) error {
+	var found client.Client
+	for _, c := range s.env.Clients {
+		if c.String() == name || strings.HasPrefix(c.String(), name+" ") {
+			found = c
+			break
+		}
+	}
+	if found == nil {
+		return fmt.Errorf("there is no client %s", name)
+	}
+
+	sub := found.Subscribe(100)
+	defer found.Unsubscribe(sub)
+	fmt.Fprintf(s.out, "Watching %s, Ctrl-C stops.\n", found)
+	for {
+		select {
+		case data := <-sub.C:
+			text := string(data)
+			if len(text) > watchLength {
+				text = text[:watchLength] + "..."
+			}
+			fmt.Fprintf(s.out, "%s %d bytes: %s\n", time.Now().Format("15:04:05.000"), len(data), text)
+		case <-ctx.Done():
+			if n := sub.Dropped(); n > 0 {
+				fmt.Fprintf(s.out, "%d messages were not shown, because they came to fast.\n", n)
+			}
+			return nil
+		}
+	}
+}
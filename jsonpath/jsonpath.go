@@ -0,0 +1,183 @@
+// Package jsonpath selects values from decoded json with a subset of JSONPath.
+//
+// Supported are the root "$", child names (".title" or "['title']"), indexes
+// ("[0]"), wildcards (".*" or "[*]") and the recursive descent ("..title").
+package jsonpath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// step is one part of a path.
+type step struct {
+	// name is the name of a child. It is "*" for all children.
+	name string
+
+	// index is the index of an array element, if isIndex is true.
+	index   int
+	isIndex bool
+
+	// recursive is true, if the step matches the children on all levels.
+	recursive bool
+}
+
+// Path is a compiled JSONPath.
+type Path struct {
+	source string
+	steps  []step
+}
+
+func (p *Path) String() string {
+	return p.source
+}
+
+// Compile parses a path like "$[*].data.title".
+func Compile(source string) (*Path, error) {
+	s := strings.TrimSpace(source)
+	if !strings.HasPrefix(s, "$") {
+		return nil, fmt.Errorf("path %q does not start with $", source)
+	}
+	s = s[1:]
+
+	p := &Path{source: source}
+	for s != "" {
+		var st step
+		switch {
+		case strings.HasPrefix(s, ".."):
+			st.recursive = true
+			s = s[2:]
+			if strings.HasPrefix(s, "[") {
+				// "..[*]" or "..[0]" is parsed by the bracket case below.
+				var err error
+				if st, s, err = parseBracket(s); err != nil {
+					return nil, fmt.Errorf("path %q: %s", source, err)
+				}
+				st.recursive = true
+				p.steps = append(p.steps, st)
+				continue
+			}
+			st.name, s = parseName(s)
+
+		case strings.HasPrefix(s, "."):
+			st.name, s = parseName(s[1:])
+
+		case strings.HasPrefix(s, "["):
+			var err error
+			if st, s, err = parseBracket(s); err != nil {
+				return nil, fmt.Errorf("path %q: %s", source, err)
+			}
+
+		default:
+			return nil, fmt.Errorf("path %q: unexpected %q", source, s)
+		}
+
+		if st.name == "" && !st.isIndex {
+			return nil, fmt.Errorf("path %q has an empty name", source)
+		}
+		p.steps = append(p.steps, st)
+	}
+	return p, nil
+}
+
+// parseName reads a name until the next "." or "[".
+func parseName(s string) (name, rest string) {
+	end := strings.IndexAny(s, ".[")
+	if end == -1 {
+		return s, ""
+	}
+	return s[:end], s[end:]
+}
+
+// parseBracket reads "[0]", "[*]" or "['name']".
+func parseBracket(s string) (step, string, error) {
+	end := strings.Index(s, "]")
+	if end == -1 {
+		return step{}, "", fmt.Errorf("missing ]")
+	}
+	inner, rest := strings.TrimSpace(s[1:end]), s[end+1:]
+
+	switch {
+	case inner == "*":
+		return step{name: "*"}, rest, nil
+	case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+		return step{name: inner[1 : len(inner)-1]}, rest, nil
+	}
+	index, err := strconv.Atoi(inner)
+	if err != nil {
+		return step{}, "", fmt.Errorf("invalid index %q", inner)
+	}
+	return step{index: index, isIndex: true}, rest, nil
+}
+
+// Select returns all values of a decoded json value, that match the path.
+func (p *Path) Select(v interface{}) []interface{} {
+	values := []interface{}{v}
+	for _, st := range p.steps {
+		var next []interface{}
+		for _, value := range values {
+			if st.recursive {
+				for _, d := range descendants(value) {
+					next = append(next, st.children(d)...)
+				}
+				continue
+			}
+			next = append(next, st.children(value)...)
+		}
+		values = next
+	}
+	return values
+}
+
+// children returns the children of a value, that match the step.
+func (st step) children(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if st.isIndex {
+			return nil
+		}
+		if st.name == "*" {
+			children := make([]interface{}, 0, len(v))
+			for _, child := range v {
+				children = append(children, child)
+			}
+			return children
+		}
+		if child, ok := v[st.name]; ok {
+			return []interface{}{child}
+		}
+
+	case []interface{}:
+		if st.name == "*" {
+			return v
+		}
+		if !st.isIndex {
+			return nil
+		}
+		i := st.index
+		if i < 0 {
+			i += len(v)
+		}
+		if i >= 0 && i < len(v) {
+			return []interface{}{v[i]}
+		}
+	}
+	return nil
+}
+
+// descendants returns a value and all values below it.
+func descendants(v interface{}) []interface{} {
+	all := []interface{}{v}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, child := range v {
+			all = append(all, descendants(child)...)
+		}
+	case []interface{}:
+		for _, child := range v {
+			all = append(all, descendants(child)...)
+		}
+	}
+	return all
+}
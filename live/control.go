@@ -0,0 +1,118 @@
+package live
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ostcar/oswstest/runner"
+)
+
+// poolSizes are the numbers of workers of the pools of an environment.
+type poolSizes struct {
+	Login   int `json:"login"`
+	Connect int `json:"connect"`
+	Send    int `json:"send"`
+}
+
+// WithToken returns a http.Handler, that only calls h, if the request has the
+// header "Authorization: Bearer <token>". A cross-site form can not set the
+// header, so a browser can not be tricked into the request. The token is
+// compared in constant time.
+func WithToken(token string, h http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			http.Error(w, "invalid control token", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// PoolsHandler returns a http.Handler, that shows and changes the number of
+// workers of the pools of the attached environment, while the tests run.
+// GET returns the numbers as json. POST changes them with the form values
+// login, connect and send, like
+//
+//	curl -H "Authorization: Bearer <token>" -d connect=50 http://localhost:8080/pools
+//
+// Missing values are not changed.
+func (h *Hub) PoolsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.mu.Lock()
+		pools := h.pools
+		h.mu.Unlock()
+		if pools == nil {
+			http.Error(w, "no tests are running", http.StatusServiceUnavailable)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var sizes [3]int
+			for i, name := range []string{"login", "connect", "send"} {
+				v := r.FormValue(name)
+				if v == "" {
+					continue
+				}
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 {
+					http.Error(w, fmt.Sprintf("invalid number of workers for %s: %s", name, v), http.StatusBadRequest)
+					return
+				}
+				sizes[i] = n
+			}
+			pools.Resize(sizes[0], sizes[1], sizes[2])
+		default:
+			http.Error(w, "only GET and POST are allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(poolSizes{
+			Login:   pools.Login.Workers(),
+			Connect: pools.Connect.Workers(),
+			Send:    pools.Send.Workers(),
+		})
+	})
+}
+
+// AttachRunner attaches the environment of a runner like Attach and lets the
+// StopHandler stop it.
+func (h *Hub) AttachRunner(r *runner.Runner) {
+	h.Attach(r.Env())
+	h.mu.Lock()
+	h.runner = r
+	h.mu.Unlock()
+}
+
+// StopHandler returns a http.Handler, that stops the attached runner on POST.
+// The running test ends with the results so far and no more tests are
+// started. The request returns, when the run has ended.
+func (h *Hub) StopHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.mu.Lock()
+		run := h.runner
+		h.mu.Unlock()
+		if run == nil {
+			http.Error(w, "no tests are running", http.StatusServiceUnavailable)
+			return
+		}
+		select {
+		case <-run.Done():
+			http.Error(w, "the run has already ended", http.StatusConflict)
+			return
+		default:
+		}
+		results := run.Stop()
+		fmt.Fprintf(w, "The run was stopped with %d results.\n", len(results))
+	})
+}
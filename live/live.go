@@ -0,0 +1,277 @@
+// Package live streams per-second aggregates of the running tests to
+// subscribers, for example a dashboard. The aggregates are send with server
+// sent events or with a websocket.
+package live
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/ostcar/oswstest/result"
+	"github.com/ostcar/oswstest/runner"
+)
+
+// Aggregate are the samples of one result in one second.
+type Aggregate struct {
+	Time   time.Time `json:"time"`
+	Test   string    `json:"test"`
+	Name   string    `json:"name"`
+	Count  int       `json:"count"`
+	Errors int       `json:"errors"`
+	MinMS  float64   `json:"min_ms"`
+	MaxMS  float64   `json:"max_ms"`
+	AveMS  float64   `json:"ave_ms"`
+
+	sum time.Duration
+	min time.Duration
+	max time.Duration
+}
+
+// SubscriberBuffer is the number of seconds, that are buffered for a slow
+// subscriber. If the buffer is full, the subscriber misses seconds.
+var SubscriberBuffer = 16
+
+// Hub aggregates the samples and sends the aggregates each second to the
+// subscribers. It is a http.Handler. Requests with a websocket upgrade get a
+// websocket, other requests get server sent events. Each message is a json
+// list of aggregates.
+type Hub struct {
+	mu          sync.Mutex
+	current     map[string]*Aggregate
+	order       []string
+	subscribers map[chan []Aggregate]bool
+	done        chan struct{}
+
+	// pools are the pools of the attached environment. See PoolsHandler.
+	pools *runner.Pools
+
+	// runner is the attached runner. See StopHandler.
+	runner *runner.Runner
+}
+
+// NewHub creates a hub and starts to send the aggregates.
+func NewHub() *Hub {
+	h := &Hub{
+		current:     make(map[string]*Aggregate),
+		subscribers: make(map[chan []Aggregate]bool),
+		done:        make(chan struct{}),
+	}
+	go h.loop()
+	return h
+}
+
+// Close stops the hub and closes the connections of all subscribers.
+func (h *Hub) Close() {
+	close(h.done)
+}
+
+// Observe adds a sample of a test.
+func (h *Hub) Observe(test, name string, labels result.Labels, value time.Duration, err error) {
+	if len(labels) > 0 {
+		name = fmt.Sprintf("%s (%s)", name, labels)
+	}
+	key := test + "\x00" + name
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	a, ok := h.current[key]
+	if !ok {
+		a = &Aggregate{Test: test, Name: name}
+		h.current[key] = a
+		h.order = append(h.order, key)
+	}
+	if err != nil {
+		a.Errors++
+		return
+	}
+	if a.Count == 0 || value < a.min {
+		a.min = value
+	}
+	if value > a.max {
+		a.max = value
+	}
+	a.Count++
+	a.sum += value
+}
+
+// Attach lets the hub observe all samples of an environment. It keeps an
+// OnSample function, that is already set. The pools of the environment can be
+// changed with the PoolsHandler.
+func (h *Hub) Attach(env *runner.Env) {
+	h.mu.Lock()
+	h.pools = env.Pools
+	h.mu.Unlock()
+
+	var mu sync.Mutex
+	var current string
+	if env.Hooks == nil {
+		env.Hooks = new(runner.Hooks)
+	}
+	env.Hooks.BeforeTest = append(env.Hooks.BeforeTest, func(env *runner.Env, test runner.Test) error {
+		mu.Lock()
+		defer mu.Unlock()
+		current = test.Name()
+		return nil
+	})
+
+	onSample := env.OnSample
+	env.OnSample = func(name string, labels result.Labels, value time.Duration, err error) {
+		if onSample != nil {
+			onSample(name, labels, value, err)
+		}
+		mu.Lock()
+		test := current
+		mu.Unlock()
+		h.Observe(test, name, labels, value, err)
+	}
+}
+
+// loop sends the aggregates each second.
+func (h *Hub) loop() {
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for {
+		select {
+		case now := <-tick.C:
+			h.publish(now)
+		case <-h.done:
+			h.mu.Lock()
+			for s := range h.subscribers {
+				close(s)
+				delete(h.subscribers, s)
+			}
+			h.mu.Unlock()
+			return
+		}
+	}
+}
+
+// publish sends the aggregates of the last second to all subscribers and
+// starts a new second.
+func (h *Hub) publish(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	aggregates := make([]Aggregate, 0, len(h.order))
+	for _, key := range h.order {
+		a := h.current[key]
+		a.Time = now
+		if a.Count > 0 {
+			a.MinMS = ms(a.min)
+			a.MaxMS = ms(a.max)
+			a.AveMS = ms(a.sum / time.Duration(a.Count))
+		}
+		aggregates = append(aggregates, *a)
+	}
+	h.current = make(map[string]*Aggregate)
+	h.order = nil
+
+	for s := range h.subscribers {
+		select {
+		case s <- aggregates:
+		default:
+		}
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (h *Hub) subscribe() chan []Aggregate {
+	s := make(chan []Aggregate, SubscriberBuffer)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribers[s] = true
+	return s
+}
+
+func (h *Hub) unsubscribe(s chan []Aggregate) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, s)
+}
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// ServeHTTP sends the aggregates to a subscriber until it disconnects.
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		h.serveWebsocket(w, r)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+
+	s := h.subscribe()
+	defer h.unsubscribe(s)
+	for {
+		select {
+		case aggregates, ok := <-s:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(aggregates)
+			if err != nil {
+				log.Printf("Can not encode aggregates, %s", err)
+				return
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (h *Hub) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Read until the subscriber closes the connection.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	s := h.subscribe()
+	defer h.unsubscribe(s)
+	for {
+		select {
+		case aggregates, ok := <-s:
+			if !ok {
+				return
+			}
+			if err := conn.WriteJSON(aggregates); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Matrix sends messages to a room of a Matrix homeserver.
+type Matrix struct {
+	// Homeserver is the url of the homeserver, like https://matrix.org.
+	Homeserver string
+	Room       string
+	Token      string
+}
+
+// newMatrix creates a Matrix notifier from an url with the room and the
+// access token as query parameters.
+func newMatrix(u *url.URL) (*Matrix, error) {
+	query := u.Query()
+	m := &Matrix{Room: query.Get("room"), Token: query.Get("token")}
+	if m.Room == "" || m.Token == "" {
+		return nil, fmt.Errorf("matrix notifier needs the parameters room and token")
+	}
+	u.RawQuery = ""
+	m.Homeserver = u.String()
+	return m, nil
+}
+
+// Notify sends the subject and the text as one text message.
+func (m *Matrix) Notify(subject, text string) error {
+	data, err := json.Marshal(map[string]string{
+		"msgtype": "m.text",
+		"body":    subject + "\n\n" + text,
+	})
+	if err != nil {
+		return err
+	}
+
+	// The transaction id makes the request idempotent, so it has to be new
+	// for each message.
+	txn := fmt.Sprintf("oswstest-%d", time.Now().UnixNano())
+	path := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s", m.Homeserver, url.PathEscape(m.Room), txn)
+	req, err := http.NewRequest("PUT", path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.Token)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("matrix: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("matrix homeserver returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Slack posts messages to an incoming webhook of Slack.
+type Slack struct {
+	URL string
+}
+
+// Notify posts the subject in bold and the text as code block.
+func (s *Slack) Notify(subject, text string) error {
+	data, err := json.Marshal(map[string]string{
+		"text": fmt.Sprintf("*%s*\n```\n%s```", subject, text),
+	})
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(s.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("slack: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("slack webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package pool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Group runs functions in goroutines and waits for them, like errgroup.Group
+// of golang.org/x/sync. The first error cancels the context of the group.
+// The goroutines count as running workers.
+//
+// The zero value is a group without a context, that is not canceled.
+type Group struct {
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+// WithContext returns a group and its context. The context is canceled, when
+// a function returns an error or when Wait returns.
+func WithContext(ctx context.Context) (*Group, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Group{cancel: cancel}, ctx
+}
+
+// Go calls f in a new goroutine. If f returns an error and it is the first
+// error of the group, it is kept and the context of the group is canceled.
+func (g *Group) Go(f func() error) {
+	g.wg.Add(1)
+	atomic.AddInt64(&running, 1)
+	go func() {
+		defer g.wg.Done()
+		defer atomic.AddInt64(&running, -1)
+		if err := f(); err != nil {
+			g.mu.Lock()
+			first := g.err == nil
+			if first {
+				g.err = err
+			}
+			g.mu.Unlock()
+			if first && g.cancel != nil {
+				g.cancel()
+			}
+		}
+	}()
+}
+
+// Wait blocks until all functions have returned. It returns the first error.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	if g.cancel != nil {
+		g.cancel()
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
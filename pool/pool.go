@@ -0,0 +1,202 @@
+// Package pool runs work in parallel with a number of workers, that can be
+// changed while the work runs.
+package pool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// running is the number of workers of all pools, that are running.
+var running int64
+
+// Running returns the number of workers of all pools, that are running. It is
+// used to find workers, that do not end.
+func Running() int {
+	return int(atomic.LoadInt64(&running))
+}
+
+// Pool runs work with Size workers in parallel. The number of workers can be
+// changed with Resize, also while Run runs.
+type Pool struct {
+	// Size is the number of workers. A value lower then one means one worker.
+	// It must not be changed while Run runs. Use Resize for that.
+	Size int
+
+	// If StopOnError is true, no more work is started after the first error.
+	// Else all work is done and the first error is returned at the end.
+	StopOnError bool
+
+	// mu protects Size and runs.
+	mu   sync.Mutex
+	runs map[*run]bool
+}
+
+// New creates a pool with size workers.
+func New(size int) *Pool {
+	return &Pool{Size: size}
+}
+
+// Resize changes the number of workers. The running calls of Run start new
+// workers at once. When there are less workers, the workers end after there
+// current work.
+func (p *Pool) Resize(size int) {
+	p.mu.Lock()
+	p.Size = size
+	runs := make([]*run, 0, len(p.runs))
+	for r := range p.runs {
+		runs = append(runs, r)
+	}
+	p.mu.Unlock()
+
+	for _, r := range runs {
+		r.resize(size)
+	}
+}
+
+// Workers returns the number of workers, like it was set with Size or Resize.
+func (p *Pool) Workers() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.Size
+}
+
+// run are the workers of one call of Run.
+type run struct {
+	mu      sync.Mutex
+	workers int
+	target  int
+	max     int
+	done    bool
+	start   func()
+}
+
+// resize sets the number of workers to size, but at least one and not more
+// then the number of items. New workers are started at once.
+func (r *run) resize(size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if size < 1 {
+		size = 1
+	}
+	if size > r.max {
+		size = r.max
+	}
+	r.target = size
+	for !r.done && r.workers < r.target {
+		r.workers++
+		r.start()
+	}
+}
+
+// stop returns true, if the calling worker has to end, because there are more
+// workers then the target.
+func (r *run) stop() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.workers > r.target {
+		r.workers--
+		return true
+	}
+	return false
+}
+
+// finish prevents, that more workers are started.
+func (r *run) finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done = true
+}
+
+// Run calls work for each number from 0 to n-1. The number is the index of
+// the item, the work is done for. Blocks until all work is done.
+//
+// The context given to work is canceled, when ctx is canceled or, with
+// StopOnError, when a work returned an error. Then no more work is started.
+// Run returns the first error of a work. If ctx was canceled before all work
+// was started, its error is returned.
+func (p *Pool) Run(ctx context.Context, n int, work func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		once     sync.Once
+		firstErr error
+	)
+	setErr := func(err error) {
+		once.Do(func() { firstErr = err })
+		if p.StopOnError {
+			cancel()
+		}
+	}
+
+	var wg sync.WaitGroup
+	toWorker := make(chan int)
+	r := &run{max: n}
+	r.start = func() {
+		wg.Add(1)
+		atomic.AddInt64(&running, 1)
+		go func() {
+			defer wg.Done()
+			defer atomic.AddInt64(&running, -1)
+			for !r.stop() {
+				i, ok := <-toWorker
+				if !ok {
+					return
+				}
+				if err := work(ctx, i); err != nil {
+					setErr(err)
+				}
+			}
+		}()
+	}
+
+	p.mu.Lock()
+	if p.runs == nil {
+		p.runs = make(map[*run]bool)
+	}
+	p.runs[r] = true
+	size := p.Size
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.runs, r)
+		p.mu.Unlock()
+	}()
+	if n > 0 {
+		r.resize(size)
+	}
+
+	// Send the work to the workers. First close the channel (to signal the
+	// workers to finish) and then wait for all workers to finish. No workers
+	// are started afterwards.
+	func() {
+		defer close(toWorker)
+		for i := 0; i < n; i++ {
+			select {
+			case toWorker <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	r.finish()
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// Start is like Run, but does not block. The returned channel gets the return
+// value of Run and is closed afterwards.
+func (p *Pool) Start(ctx context.Context, n int, work func(ctx context.Context, i int) error) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		defer close(done)
+		done <- p.Run(ctx, n, work)
+	}()
+	return done
+}
@@ -0,0 +1,195 @@
+package record
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/ostcar/oswstest/config"
+)
+
+// Proxy forwards the requests and websocket connections of a browser to the
+// server of the configuration and records them.
+//
+// Only the requests, that change data, and the requests to RESTURLPath are
+// recorded, not the static files. The login and the logout are not recorded,
+// because each client of the replay does them itself.
+type Proxy struct {
+	cfg     *config.Config
+	target  *url.URL
+	forward *httputil.ReverseProxy
+
+	mu          sync.Mutex
+	recording   Recording
+	connections int
+}
+
+// NewProxy creates a proxy for the server of the configuration. The recording
+// starts at once.
+func NewProxy(cfg *config.Config) (*Proxy, error) {
+	target, err := url.Parse(cfg.HTTPURL(""))
+	if err != nil {
+		return nil, err
+	}
+	forward := httputil.NewSingleHostReverseProxy(target)
+	director := forward.Director
+	forward.Director = func(r *http.Request) {
+		director(r)
+		// OpenSlides checks the host.
+		r.Host = target.Host
+	}
+	return &Proxy{
+		cfg:       cfg,
+		target:    target,
+		forward:   forward,
+		recording: Recording{Target: target.String(), Started: time.Now()},
+	}, nil
+}
+
+// Recording returns a copy of the recording so far.
+func (p *Proxy) Recording() *Recording {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r := p.recording
+	r.Events = append([]Event(nil), p.recording.Events...)
+	return &r
+}
+
+// add adds an event at the current time.
+func (p *Proxy) add(e Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e.At = time.Since(p.recording.Started)
+	p.recording.Events = append(p.recording.Events, e)
+}
+
+// ServeHTTP forwards a request or a websocket connection.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		p.serveWebsocket(w, r)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.RequestURI(), "/")
+	if !p.recorded(r.Method, path) {
+		p.forward.ServeHTTP(w, r)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	e := Event{Type: EventRequest, Method: r.Method, Path: path, Body: string(body)}
+	start := time.Now()
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	p.forward.ServeHTTP(sw, r)
+	e.Status = sw.status
+	e.Duration = time.Since(start)
+
+	// The event is added at the time of the request.
+	p.mu.Lock()
+	e.At = start.Sub(p.recording.Started)
+	p.recording.Events = append(p.recording.Events, e)
+	p.mu.Unlock()
+}
+
+// recorded returns true, if a request is recorded.
+func (p *Proxy) recorded(method, path string) bool {
+	if strings.HasPrefix(path, p.cfg.LoginURLPath) || strings.HasPrefix(path, p.cfg.LogoutURLPath) {
+		return false
+	}
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		return strings.HasPrefix(path, p.cfg.RESTURLPath)
+	}
+	return true
+}
+
+// upgrader accepts the websocket connections of the browser.
+var upgrader = websocket.Upgrader{
+	// The browser loads the page from the proxy, so the origin is the proxy.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// serveWebsocket connects to the server and forwards the messages in both
+// directions, until one side closes the connection.
+func (p *Proxy) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	header := make(http.Header)
+	for _, name := range []string{"Cookie", "Authorization"} {
+		if v := r.Header.Get(name); v != "" {
+			header.Set(name, v)
+		}
+	}
+	header.Set("Origin", p.target.Scheme+"://"+p.target.Host)
+
+	path := strings.TrimPrefix(r.URL.RequestURI(), "/")
+	server, resp, err := websocket.DefaultDialer.DialContext(r.Context(), p.cfg.WSURL(path), header)
+	if err != nil {
+		status := http.StatusBadGateway
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		log.Printf("Can not connect the websocket to the server, %s", err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+	defer server.Close()
+
+	browser, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Can not upgrade the websocket of the browser, %s", err)
+		return
+	}
+	defer browser.Close()
+
+	p.mu.Lock()
+	p.connections++
+	id := p.connections
+	p.mu.Unlock()
+	p.add(Event{Type: EventConnect, Connection: id, Path: path})
+
+	done := make(chan struct{}, 2)
+	pump := func(from, to *websocket.Conn, record func(data []byte)) {
+		defer func() { done <- struct{}{} }()
+		for {
+			kind, data, err := from.ReadMessage()
+			if err != nil {
+				return
+			}
+			record(data)
+			if err := to.WriteMessage(kind, data); err != nil {
+				return
+			}
+		}
+	}
+	go pump(browser, server, func(data []byte) {
+		p.add(Event{Type: EventSend, Connection: id, Message: string(data)})
+	})
+	go pump(server, browser, func(data []byte) {
+		p.add(Event{Type: EventReceive, Connection: id, Size: len(data)})
+	})
+	// When one side ends, the deferred closes end the other pump.
+	<-done
+}
+
+// statusWriter remembers the status of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
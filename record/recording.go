@@ -0,0 +1,83 @@
+// Package record records the http requests and websocket messages of a
+// browser session with a proxy in front of OpenSlides, so the session can be
+// replayed by many clients.
+package record
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// The types of the events.
+const (
+	// EventRequest is a http request of the browser.
+	EventRequest = "request"
+
+	// EventConnect is a new websocket connection of the browser.
+	EventConnect = "connect"
+
+	// EventSend is a websocket message from the browser to the server.
+	EventSend = "send"
+
+	// EventReceive is a websocket message from the server to the browser.
+	EventReceive = "receive"
+)
+
+// Event is one action in a recording.
+type Event struct {
+	// At is the time since the start of the recording.
+	At time.Duration `json:"at"`
+
+	Type string `json:"type"`
+
+	// Connection is the number of the websocket connection of a connect, send
+	// or receive event, starting with 1.
+	Connection int `json:"connection,omitempty"`
+
+	// Method, Path and Body are the request. The path has no leading slash.
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Body   string `json:"body,omitempty"`
+
+	// Status and Duration are the response status of a request and the time
+	// until the response was written.
+	Status   int           `json:"status,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+
+	// Message is a websocket message from the browser. Of the messages from
+	// the server, only the Size is recorded.
+	Message string `json:"message,omitempty"`
+	Size    int    `json:"size,omitempty"`
+}
+
+// Recording is the timeline of a recorded browser session.
+type Recording struct {
+	// Target is the url of the server, that was recorded.
+	Target  string    `json:"target"`
+	Started time.Time `json:"started"`
+	Events  []Event   `json:"events"`
+}
+
+// Load reads a recording from a json file.
+func Load(path string) (*Recording, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Recording
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("can not decode recording %s: %s", path, err)
+	}
+	return &r, nil
+}
+
+// Write writes the recording to a json file.
+func (r *Recording) Write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,257 @@
+package result
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Labels are additional key value pairs of a sample. Samples with the same
+// name but different labels are collected in different results.
+type Labels map[string]string
+
+// String returns the labels sorted by key like "key1=value1, key2=value2".
+func (l Labels) String() string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%s", k, l[k])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// collectorShards is the number of shards of a Collector.
+const collectorShards = 16
+
+// Collector collects the samples of a test into TestResults. It can be used
+// from many goroutines at the same time.
+//
+// The description of a result is the name of the samples and, if there are
+// labels, the labels in brackets. The results are returned in the order, they
+// were first declared or observed.
+//
+// The samples are spread over some shards with an own lock each, so thousands
+// of clients do not wait for one lock. Results merges the shards, so the
+// samples and errors of a result are not in the order, they were observed.
+type Collector struct {
+	// OnSample is called for each observed sample, if it is not nil. It is
+	// called from the goroutine, that observes the sample.
+	OnSample func(name string, labels Labels, value time.Duration, err error)
+
+	// Streaming creates streaming results, that only keep the statistics of
+	// the durations.
+	Streaming bool
+
+	shards [collectorShards]collectorShard
+	next   uint32
+
+	mu       sync.Mutex
+	known    map[string]bool
+	order    []string
+	expected map[string]expectation
+}
+
+// expectation is the number of samples, that a result expects, and the time
+// since it expects them.
+type expectation struct {
+	total int
+	since time.Time
+}
+
+// collectorShard holds a part of the samples of a Collector.
+type collectorShard struct {
+	mu      sync.Mutex
+	results map[string]*TestResult
+}
+
+// NewCollector creates an empty collector.
+func NewCollector() *Collector {
+	c := &Collector{known: make(map[string]bool), expected: make(map[string]expectation)}
+	for i := range c.shards {
+		c.shards[i].results = make(map[string]*TestResult)
+	}
+	return c
+}
+
+// describe returns the description of a result for a name and labels.
+func describe(name string, labels Labels) string {
+	if len(labels) > 0 {
+		return fmt.Sprintf("%s (%s)", name, labels)
+	}
+	return name
+}
+
+// newResult creates an empty result with the mode of the collector.
+func (c *Collector) newResult(description string) *TestResult {
+	if c.Streaming {
+		return NewStreaming(description)
+	}
+	return New(description)
+}
+
+// declare remembers the order of a description.
+func (c *Collector) declare(description string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.known[description] {
+		c.known[description] = true
+		c.order = append(c.order, description)
+	}
+}
+
+// Declare creates an empty result, so it is returned by Results even when it
+// gets no samples. It also fixes the order of the results.
+func (c *Collector) Declare(name string, labels Labels) {
+	c.declare(describe(name, labels))
+}
+
+// Expect is like Observer, but the result expects total samples from now on.
+// Status shows the progress of the result with an ETA.
+func (c *Collector) Expect(name string, total int) func(value time.Duration, err error) {
+	c.mu.Lock()
+	c.expected[name] = expectation{total: total, since: time.Now()}
+	c.mu.Unlock()
+	return c.Observer(name)
+}
+
+// Observe adds a sample. If err is not nil, it is added as error, else the
+// value is added.
+func (c *Collector) Observe(name string, labels Labels, value time.Duration, err error) {
+	if c.OnSample != nil {
+		c.OnSample(name, labels, value, err)
+	}
+
+	description := describe(name, labels)
+	shard := &c.shards[atomic.AddUint32(&c.next, 1)%collectorShards]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	r, ok := shard.results[description]
+	if !ok {
+		c.declare(description)
+		r = c.newResult(description)
+		shard.results[description] = r
+	}
+	if err != nil {
+		r.AddError(err)
+		return
+	}
+	r.Add(value)
+}
+
+// Observer returns a function, that observes samples for a name without
+// labels.
+func (c *Collector) Observer(name string) func(value time.Duration, err error) {
+	c.Declare(name, nil)
+	return func(value time.Duration, err error) {
+		c.Observe(name, nil, value, err)
+	}
+}
+
+// Results returns the collected results. Each call merges the shards into new
+// results.
+func (c *Collector) Results() []*TestResult {
+	c.mu.Lock()
+	order := make([]string, len(c.order))
+	copy(order, c.order)
+	c.mu.Unlock()
+
+	results := make([]*TestResult, len(order))
+	for i, description := range order {
+		results[i] = c.newResult(description)
+	}
+	for i := range c.shards {
+		shard := &c.shards[i]
+		shard.mu.Lock()
+		for _, r := range results {
+			if part, ok := shard.results[r.Description()]; ok {
+				r.Merge(part)
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return results
+}
+
+// counts returns the descriptions of the results in order, there
+// expectations and the number of samples and errors of each result.
+func (c *Collector) counts() (order []string, expected map[string]expectation, samples, errs []int) {
+	c.mu.Lock()
+	order = make([]string, len(c.order))
+	copy(order, c.order)
+	expected = make(map[string]expectation, len(c.expected))
+	for description, e := range c.expected {
+		expected[description] = e
+	}
+	c.mu.Unlock()
+
+	samples = make([]int, len(order))
+	errs = make([]int, len(order))
+	for i := range c.shards {
+		shard := &c.shards[i]
+		shard.mu.Lock()
+		for j, description := range order {
+			if r, ok := shard.results[description]; ok {
+				samples[j] += r.Count()
+				errs[j] += r.ErrCount()
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return order, expected, samples, errs
+}
+
+// Status returns the number of samples of each result, separated by "|". For
+// results with an expected number of samples, the progress and the ETA are
+// shown.
+func (c *Collector) Status() string {
+	order, expected, samples, errs := c.counts()
+
+	parts := make([]string, len(order))
+	for i, description := range order {
+		count := samples[i] + errs[i]
+		e, ok := expected[description]
+		if !ok {
+			parts[i] = fmt.Sprintf("%s: %d", description, count)
+			continue
+		}
+		parts[i] = Progress{
+			Description: description,
+			Count:       count,
+			Total:       e.total,
+			Elapsed:     time.Since(e.since),
+		}.String()
+	}
+	return strings.Join(parts, " | ")
+}
+
+// CheckErrorBudget returns an error, if a result with an expected number of
+// samples has more errors then the part budget of them, like 0.2 for 20%.
+// Then the test can not succeed anymore. A budget of zero or less is not
+// checked.
+func (c *Collector) CheckErrorBudget(budget float64) error {
+	if budget <= 0 {
+		return nil
+	}
+	order, expected, _, errs := c.counts()
+	for i, description := range order {
+		e, ok := expected[description]
+		if !ok || e.total <= 0 {
+			continue
+		}
+		if rate := float64(errs[i]) / float64(e.total); rate > budget {
+			return fmt.Errorf(
+				"%d of %d samples of %q are errors, that is more then the error budget of %.0f%%",
+				errs[i], e.total, description, budget*100,
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package result
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ANSI codes of the colors of the console table.
+const (
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorRed    = "\x1b[31m"
+	colorReset  = "\x1b[0m"
+)
+
+// Thresholds decide the color of a result in the console table. A result is
+// red, if its error rate is at least RedErrorRate or its average is at least
+// RedAverage. It is yellow, if it has errors or its average is at least
+// YellowAverage. Else it is green. A zero duration is not checked.
+type Thresholds struct {
+	YellowAverage time.Duration
+	RedAverage    time.Duration
+	RedErrorRate  float64
+}
+
+// color returns the ANSI code for a result.
+func (t Thresholds) color(r *TestResult) string {
+	var errorRate float64
+	if total := r.CountBoth(); total > 0 {
+		errorRate = float64(r.ErrCount()) / float64(total)
+	}
+	switch {
+	case r.ErrCount() > 0 && errorRate >= t.RedErrorRate:
+		return colorRed
+	case t.RedAverage > 0 && r.Ave() >= t.RedAverage:
+		return colorRed
+	case r.ErrCount() > 0:
+		return colorYellow
+	case t.YellowAverage > 0 && r.Ave() >= t.YellowAverage:
+		return colorYellow
+	}
+	return colorGreen
+}
+
+// ConsoleOptions are the options of a ConsoleSink.
+type ConsoleOptions struct {
+	// If ShowAllErrors is false, only the first error of each result is shown.
+	ShowAllErrors bool
+
+	// If Color is true, the rows of the table are colored with the
+	// Thresholds.
+	Color      bool
+	Thresholds Thresholds
+
+	// If Summary is true, OpenSinks creates a SummarySink with one line per
+	// test instead of the table.
+	Summary bool
+}
+
+// ConsoleSink writes the results of all tests as one aligned table, when it is
+// closed. The errors are listed below the table.
+type ConsoleSink struct {
+	w       io.Writer
+	options ConsoleOptions
+	rows    []consoleRow
+}
+
+// consoleRow is one result of a test in the table.
+type consoleRow struct {
+	test   string
+	result *TestResult
+}
+
+// NewConsoleSink creates a ConsoleSink, that writes to w.
+func NewConsoleSink(w io.Writer, showAllErrors bool) *ConsoleSink {
+	return NewConsoleSinkWithOptions(w, ConsoleOptions{ShowAllErrors: showAllErrors})
+}
+
+// NewConsoleSinkWithOptions creates a ConsoleSink, that writes to w with some
+// options.
+func NewConsoleSinkWithOptions(w io.Writer, options ConsoleOptions) *ConsoleSink {
+	return &ConsoleSink{w: w, options: options}
+}
+
+// Publish remembers the results for the table.
+func (s *ConsoleSink) Publish(test string, results []*TestResult) error {
+	for _, r := range results {
+		s.rows = append(s.rows, consoleRow{test: test, result: r})
+	}
+	return nil
+}
+
+// Close writes the table and the errors.
+func (s *ConsoleSink) Close() error {
+	if len(s.rows) == 0 {
+		return nil
+	}
+
+	header := []string{"TEST", "RESULT", "COUNT", "ERRORS", "MIN", "AVE", "MAX"}
+	cells := make([][]string, len(s.rows))
+	for i, row := range s.rows {
+		r := row.result
+		cells[i] = []string{
+			row.test,
+			r.Description(),
+			fmt.Sprint(r.Count()),
+			fmt.Sprint(r.ErrCount()),
+			fmt.Sprintf("%dms", r.Min()/time.Millisecond),
+			fmt.Sprintf("%dms", r.Ave()/time.Millisecond),
+			fmt.Sprintf("%dms", r.Max()/time.Millisecond),
+		}
+	}
+
+	widths := make([]int, len(header))
+	for _, line := range append([][]string{header}, cells...) {
+		for i, cell := range line {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(alignRow(header, widths) + "\n")
+	for i, line := range cells {
+		text := alignRow(line, widths)
+		if s.options.Color {
+			text = s.options.Thresholds.color(s.rows[i].result) + text + colorReset
+		}
+		b.WriteString(text + "\n")
+	}
+
+	for _, row := range s.rows {
+		errs := row.result.Errors()
+		if len(errs) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s: %s\n", row.test, row.result.Description())
+		if !s.options.ShowAllErrors {
+			fmt.Fprintf(&b, "first of %d errors: %s\n", len(errs), errs[0])
+			continue
+		}
+		for i, err := range errs {
+			fmt.Fprintf(&b, "%3d error: %s\n", i+1, err)
+		}
+	}
+
+	_, err := io.WriteString(s.w, b.String())
+	return err
+}
+
+// alignRow pads the cells to the widths. The text columns are aligned left,
+// the numbers right.
+func alignRow(cells []string, widths []int) string {
+	parts := make([]string, len(cells))
+	for i, cell := range cells {
+		if i < 2 {
+			parts[i] = fmt.Sprintf("%-*s", widths[i], cell)
+			continue
+		}
+		parts[i] = fmt.Sprintf("%*s", widths[i], cell)
+	}
+	return strings.TrimRight(strings.Join(parts, "  "), " ")
+}
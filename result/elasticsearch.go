@@ -0,0 +1,193 @@
+package result
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// elasticBatchSize is the number of documents of one bulk request.
+const elasticBatchSize = 5000
+
+// ElasticsearchSink indexes every sample and every error of the results into
+// Elasticsearch or OpenSearch with the bulk api, when the results of a test
+// are published. So large runs can be explored with Kibana.
+//
+// Each document has the run metadata: the run (the start time), the host and
+// the start time as "run_started". Samples have the type "sample" and the
+// field duration_ms. Errors have the type "error" and the field error. For
+// each result, there is also a document with the type "result" and the
+// aggregated values, because streaming results have no samples.
+type ElasticsearchSink struct {
+	url    string
+	index  string
+	run    string
+	host   string
+	start  time.Time
+	client *http.Client
+}
+
+// elasticDoc is one indexed document.
+type elasticDoc struct {
+	Timestamp  time.Time `json:"@timestamp"`
+	Run        string    `json:"run"`
+	RunStarted time.Time `json:"run_started"`
+	Host       string    `json:"host"`
+	Test       string    `json:"test"`
+	Result     string    `json:"result"`
+	Type       string    `json:"type"`
+
+	DurationMS *float64 `json:"duration_ms,omitempty"`
+	Error      string   `json:"error,omitempty"`
+
+	Count  *int     `json:"count,omitempty"`
+	Errors *int     `json:"errors,omitempty"`
+	MinMS  *float64 `json:"min_ms,omitempty"`
+	MaxMS  *float64 `json:"max_ms,omitempty"`
+	AveMS  *float64 `json:"ave_ms,omitempty"`
+}
+
+// NewElasticsearchSink creates an ElasticsearchSink. The last element of the
+// path of the url is the index, like http://localhost:9200/oswstest. Without
+// a path, the index is oswstest. Credentials can be part of the url.
+func NewElasticsearchSink(rawURL string) (*ElasticsearchSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid elasticsearch url: %s", err)
+	}
+	index := "oswstest"
+	path := strings.Trim(u.Path, "/")
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		index = path[i+1:]
+		u.Path = "/" + path[:i]
+	} else if path != "" {
+		index = path
+		u.Path = ""
+	}
+
+	host, _ := os.Hostname()
+	now := time.Now()
+	return &ElasticsearchSink{
+		url:    strings.TrimSuffix(u.String(), "/"),
+		index:  index,
+		run:    now.Format("20060102-150405"),
+		host:   host,
+		start:  now,
+		client: &http.Client{Timeout: time.Minute},
+	}, nil
+}
+
+// Publish indexes the samples, errors and aggregated values of one test.
+func (s *ElasticsearchSink) Publish(test string, results []*TestResult) error {
+	now := time.Now()
+	doc := func(r *TestResult, kind string) elasticDoc {
+		return elasticDoc{
+			Timestamp:  now,
+			Run:        s.run,
+			RunStarted: s.start,
+			Host:       s.host,
+			Test:       test,
+			Result:     r.Description(),
+			Type:       kind,
+		}
+	}
+
+	var docs []elasticDoc
+	for _, r := range results {
+		for _, v := range r.Values() {
+			d := doc(r, "sample")
+			value := ms(v)
+			d.DurationMS = &value
+			docs = append(docs, d)
+		}
+		for _, err := range r.Errors() {
+			d := doc(r, "error")
+			d.Error = err.Error()
+			docs = append(docs, d)
+		}
+
+		d := doc(r, "result")
+		count, errors := r.Count(), r.ErrCount()
+		min, max, ave := ms(r.Min()), ms(r.Max()), ms(r.Ave())
+		d.Count, d.Errors, d.MinMS, d.MaxMS, d.AveMS = &count, &errors, &min, &max, &ave
+		docs = append(docs, d)
+	}
+
+	for len(docs) > 0 {
+		n := len(docs)
+		if n > elasticBatchSize {
+			n = elasticBatchSize
+		}
+		if err := s.bulk(docs[:n]); err != nil {
+			return fmt.Errorf("can not index the results of %s: %s", test, err)
+		}
+		docs = docs[n:]
+	}
+	return nil
+}
+
+// Close does nothing. The documents are indexed by Publish.
+func (s *ElasticsearchSink) Close() error {
+	return nil
+}
+
+// bulk indexes documents with one bulk request.
+func (s *ElasticsearchSink) bulk(docs []elasticDoc) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	action := map[string]map[string]string{"index": {"_index": s.index}}
+	for _, d := range docs {
+		if err := encoder.Encode(action); err != nil {
+			return err
+		}
+		if err := encoder.Encode(d); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest("POST", s.url+"/_bulk", &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("bulk request returned %s", resp.Status)
+	}
+
+	// The bulk api returns 200, even if single documents failed.
+	var response struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Error json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("can not read the bulk response: %s", err)
+	}
+	if !response.Errors {
+		return nil
+	}
+	var failed int
+	var first json.RawMessage
+	for _, item := range response.Items {
+		for _, result := range item {
+			if len(result.Error) > 0 {
+				failed++
+				if first == nil {
+					first = result.Error
+				}
+			}
+		}
+	}
+	return fmt.Errorf("%d of %d documents failed, first error: %s", failed, len(docs), first)
+}
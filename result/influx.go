@@ -0,0 +1,65 @@
+package result
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// InfluxSink writes the results in the InfluxDB line protocol. Each raw sample
+// is one line in the measurement oswstest_sample, the aggregated values are
+// written to the measurement oswstest_result.
+type InfluxSink struct {
+	path string
+	f    *os.File
+	w    *bufio.Writer
+}
+
+// NewInfluxSink creates an InfluxSink, that writes to the file at path.
+func NewInfluxSink(path string) *InfluxSink {
+	return &InfluxSink{path: path}
+}
+
+// influxEscaper escapes tag values in the line protocol.
+var influxEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// Publish writes the results of one test.
+func (s *InfluxSink) Publish(test string, results []*TestResult) error {
+	if s.f == nil {
+		f, err := os.Create(s.path)
+		if err != nil {
+			return err
+		}
+		s.f = f
+		s.w = bufio.NewWriter(f)
+	}
+
+	now := time.Now().UnixNano()
+	for _, r := range results {
+		tags := fmt.Sprintf("test=%s,result=%s", influxEscaper.Replace(test), influxEscaper.Replace(r.Description()))
+		fmt.Fprintf(
+			s.w,
+			"oswstest_result,%s count=%di,errors=%di,min_ms=%f,max_ms=%f,ave_ms=%f %d\n",
+			tags, r.Count(), r.ErrCount(), ms(r.Min()), ms(r.Max()), ms(r.Ave()), now,
+		)
+		for i, v := range r.Values() {
+			// Each sample needs its own timestamp, else InfluxDB overwrites it.
+			fmt.Fprintf(s.w, "oswstest_sample,%s value_ms=%f %d\n", tags, ms(v), now+int64(i))
+		}
+	}
+	return s.w.Flush()
+}
+
+// Close closes the file.
+func (s *InfluxSink) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	if err := s.w.Flush(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
@@ -0,0 +1,108 @@
+package result
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// JSONSink writes all results with there raw samples to a json file, when it
+// is closed. Streaming results have a histogram instead of the samples. The file also has the time, when the sink was created and
+// closed.
+type JSONSink struct {
+	path    string
+	started time.Time
+	tests   []jsonTest
+}
+
+type jsonTest struct {
+	Name    string       `json:"name"`
+	Results []jsonResult `json:"results"`
+}
+
+type jsonResult struct {
+	Description string    `json:"description"`
+	Count       int       `json:"count"`
+	MinMS       float64   `json:"min_ms"`
+	MaxMS       float64   `json:"max_ms"`
+	AveMS       float64   `json:"ave_ms"`
+	Errors      []string  `json:"errors"`
+	SamplesMS   []float64 `json:"samples_ms"`
+
+	// StdDevMS and Histogram are only set for streaming results, that have
+	// no samples.
+	StdDevMS  float64      `json:"stddev_ms,omitempty"`
+	Histogram []jsonBucket `json:"histogram,omitempty"`
+}
+
+// jsonBucket is a not empty bucket of the histogram. The last bucket has no
+// upper bound.
+type jsonBucket struct {
+	LeMS  *float64 `json:"le_ms,omitempty"`
+	Count int      `json:"count"`
+}
+
+// NewJSONSink creates a JSONSink, that writes to the file at path.
+func NewJSONSink(path string) *JSONSink {
+	return &JSONSink{path: path, started: time.Now()}
+}
+
+// Publish saves the results of one test.
+func (s *JSONSink) Publish(test string, results []*TestResult) error {
+	t := jsonTest{Name: test}
+	for _, r := range results {
+		jr := jsonResult{
+			Description: r.Description(),
+			Count:       r.Count(),
+			MinMS:       ms(r.Min()),
+			MaxMS:       ms(r.Max()),
+			AveMS:       ms(r.Ave()),
+			Errors:      []string{},
+			SamplesMS:   make([]float64, 0, r.Count()),
+		}
+		for _, err := range r.Errors() {
+			jr.Errors = append(jr.Errors, err.Error())
+		}
+		for _, v := range r.Values() {
+			jr.SamplesMS = append(jr.SamplesMS, ms(v))
+		}
+		if r.Streaming() {
+			jr.StdDevMS = ms(r.StdDev())
+			for i, n := range r.Stats().Buckets {
+				if n == 0 {
+					continue
+				}
+				b := jsonBucket{Count: n}
+				if i < len(HistogramBounds) {
+					le := ms(HistogramBounds[i])
+					b.LeMS = &le
+				}
+				jr.Histogram = append(jr.Histogram, b)
+			}
+		}
+		t.Results = append(t.Results, jr)
+	}
+	s.tests = append(s.tests, t)
+	return nil
+}
+
+// Close writes the file.
+func (s *JSONSink) Close() error {
+	f, err := os.Create(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Started  time.Time  `json:"started"`
+		Finished time.Time  `json:"finished"`
+		Tests    []jsonTest `json:"tests"`
+	}{s.started, time.Now(), s.tests})
+}
+
+// ms returns a duration in milliseconds.
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,143 @@
+package result
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+)
+
+// k6TrendStats are the statistics of each trend metric, like the default
+// summaryTrendStats of k6.
+var k6TrendStats = []string{"avg", "min", "med", "max", "p(90)", "p(95)"}
+
+// K6Sink writes the results in the format of the end-of-test summary of k6
+// (the data of handleSummary), when it is closed. So the tools for k6, like
+// dashboards and threshold checks, can read the results of oswstest.
+//
+// Each result is a trend metric "oswstest_duration{test:<test>,result:<result>}"
+// with the durations in milliseconds and a rate metric
+// "oswstest_errors{test:<test>,result:<result>}" with the part of the samples,
+// that failed. "oswstest_errors{test:<test>}" is the rate of all results of a
+// test. Each test is a group.
+type K6Sink struct {
+	path    string
+	started time.Time
+	groups  []k6Group
+	metrics map[string]k6Metric
+}
+
+type k6Group struct {
+	Name   string        `json:"name"`
+	Path   string        `json:"path"`
+	ID     string        `json:"id"`
+	Groups []k6Group     `json:"groups"`
+	Checks []interface{} `json:"checks"`
+}
+
+type k6Metric struct {
+	Type     string             `json:"type"`
+	Contains string             `json:"contains"`
+	Values   map[string]float64 `json:"values"`
+}
+
+// NewK6Sink creates a K6Sink, that writes to the file at path.
+func NewK6Sink(path string) *K6Sink {
+	return &K6Sink{path: path, started: time.Now(), metrics: make(map[string]k6Metric)}
+}
+
+// Publish saves the results of one test.
+func (s *K6Sink) Publish(test string, results []*TestResult) error {
+	s.groups = append(s.groups, newK6Group("", test))
+
+	var all, failed int
+	for _, r := range results {
+		tags := "{test:" + k6Tag(test) + ",result:" + k6Tag(r.Description()) + "}"
+		s.metrics["oswstest_duration"+tags] = k6Metric{
+			Type:     "trend",
+			Contains: "time",
+			Values: map[string]float64{
+				"avg":   ms(r.Ave()),
+				"min":   ms(r.Min()),
+				"med":   ms(r.Percentile(50)),
+				"max":   ms(r.Max()),
+				"p(90)": ms(r.Percentile(90)),
+				"p(95)": ms(r.Percentile(95)),
+			},
+		}
+		s.metrics["oswstest_errors"+tags] = k6Rate(r.ErrCount(), r.CountBoth())
+		all += r.CountBoth()
+		failed += r.ErrCount()
+	}
+	s.metrics["oswstest_errors{test:"+k6Tag(test)+"}"] = k6Rate(failed, all)
+	return nil
+}
+
+// Close writes the file.
+func (s *K6Sink) Close() error {
+	root := newK6Group("", "")
+	root.Groups = s.groups
+
+	f, err := os.Create(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(map[string]interface{}{
+		"root_group": root,
+		"options": map[string]interface{}{
+			"summaryTrendStats": k6TrendStats,
+			"summaryTimeUnit":   "",
+			"noColor":           false,
+		},
+		"state": map[string]interface{}{
+			"isStdOutTTY":       false,
+			"isStdErrTTY":       false,
+			"testRunDurationMs": ms(time.Since(s.started)),
+		},
+		"metrics": s.metrics,
+	})
+}
+
+// newK6Group returns a group of k6. The path and the id are build like k6
+// does it.
+func newK6Group(parentPath, name string) k6Group {
+	path := ""
+	if name != "" {
+		path = parentPath + "::" + name
+	}
+	sum := md5.Sum([]byte(path))
+	return k6Group{
+		Name:   name,
+		Path:   path,
+		ID:     hex.EncodeToString(sum[:]),
+		Groups: []k6Group{},
+		Checks: []interface{}{},
+	}
+}
+
+// k6Rate returns a rate metric of k6 with the part of failed in all.
+func k6Rate(failed, all int) k6Metric {
+	var rate float64
+	if all > 0 {
+		rate = float64(failed) / float64(all)
+	}
+	return k6Metric{
+		Type:     "rate",
+		Contains: "default",
+		// For k6, a sample with a true value passes. Here, an error is true.
+		Values: map[string]float64{
+			"rate":   rate,
+			"passes": float64(failed),
+			"fails":  float64(all - failed),
+		},
+	}
+}
+
+// k6Tag removes the characters from a tag value, that k6 uses in the names of
+// sub metrics.
+var k6Tag = strings.NewReplacer(",", " ", "{", "(", "}", ")").Replace
@@ -0,0 +1,137 @@
+package result
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"time"
+)
+
+// locustPercentiles are the percentiles of the stats csv of Locust.
+var locustPercentiles = []float64{50, 66, 75, 80, 90, 95, 98, 99, 99.9, 99.99, 100}
+
+// LocustSink writes the results in the layout of the stats csv of Locust
+// (<prefix>_stats.csv), when it is closed. The "Type" column is the test and
+// the "Name" column is the result. The last row is "Aggregated" over all
+// results.
+//
+// The requests per second are the samples of a result divided by the time of
+// its test. The time of a test is the time between the publishing of its
+// results and the results of the test before. oswstest does not measure the
+// size of the responses, so the average content size is always 0.
+type LocustSink struct {
+	path      string
+	published time.Time
+	rows      []locustRow
+}
+
+type locustRow struct {
+	test     string
+	result   *TestResult
+	duration time.Duration
+}
+
+// NewLocustSink creates a LocustSink, that writes to the file at path.
+func NewLocustSink(path string) *LocustSink {
+	return &LocustSink{path: path, published: time.Now()}
+}
+
+// Publish saves the results of one test.
+func (s *LocustSink) Publish(test string, results []*TestResult) error {
+	now := time.Now()
+	for _, r := range results {
+		s.rows = append(s.rows, locustRow{test: test, result: r, duration: now.Sub(s.published)})
+	}
+	s.published = now
+	return nil
+}
+
+// Close writes the file.
+func (s *LocustSink) Close() error {
+	f, err := os.Create(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	header := []string{
+		"Type",
+		"Name",
+		"Request Count",
+		"Failure Count",
+		"Median Response Time",
+		"Average Response Time",
+		"Min Response Time",
+		"Max Response Time",
+		"Average Content Size",
+		"Requests/s",
+		"Failures/s",
+	}
+	for _, p := range locustPercentiles {
+		header = append(header, fmt.Sprintf("%g%%", p))
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	// The aggregated result has to be streaming, if one of the results is,
+	// because then not all durations are known.
+	aggregated := New("Aggregated")
+	for _, row := range s.rows {
+		if row.result.Streaming() {
+			aggregated = NewStreaming("Aggregated")
+			break
+		}
+	}
+	var total time.Duration
+	for i, row := range s.rows {
+		if err := w.Write(locustRecord(row.test, row.result.Description(), row.result, row.duration)); err != nil {
+			return err
+		}
+		aggregated.Merge(row.result)
+		if i == 0 || row.test != s.rows[i-1].test {
+			total += row.duration
+		}
+	}
+	if err := w.Write(locustRecord("", "Aggregated", aggregated, total)); err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// locustRecord returns one row of the stats csv.
+func locustRecord(kind, name string, r *TestResult, duration time.Duration) []string {
+	perSecond := func(n int) string {
+		if duration <= 0 {
+			return "0"
+		}
+		return fmt.Sprintf("%.6f", float64(n)/duration.Seconds())
+	}
+	roundMS := func(d time.Duration) string {
+		return fmt.Sprint(int64(d.Round(time.Millisecond) / time.Millisecond))
+	}
+
+	record := []string{
+		kind,
+		name,
+		fmt.Sprint(r.CountBoth()),
+		fmt.Sprint(r.ErrCount()),
+		roundMS(r.Percentile(50)),
+		fmt.Sprintf("%.6f", ms(r.Ave())),
+		fmt.Sprintf("%.6f", ms(r.Min())),
+		fmt.Sprintf("%.6f", ms(r.Max())),
+		"0",
+		perSecond(r.CountBoth()),
+		perSecond(r.ErrCount()),
+	}
+	for _, p := range locustPercentiles {
+		if r.Count() == 0 {
+			record = append(record, "N/A")
+			continue
+		}
+		record = append(record, roundMS(r.Percentile(p)))
+	}
+	return record
+}
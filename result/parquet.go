@@ -0,0 +1,340 @@
+package result
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"math"
+	"os"
+)
+
+// Values of the parquet format.
+const (
+	parquetByteArray = 6
+	parquetDouble    = 5
+	parquetRequired  = 0
+	parquetUTF8      = 0
+	parquetPlain     = 0
+	parquetRLE       = 3
+	parquetGzip      = 2
+	parquetDataPage  = 0
+)
+
+// parquetPageRows is the maximum number of values of one page.
+const parquetPageRows = 64 * 1024
+
+// parquetColumn is one column of the written files.
+type parquetColumn struct {
+	name string
+	kind int32
+	utf8 bool
+}
+
+var parquetColumns = []parquetColumn{
+	{"test", parquetByteArray, true},
+	{"result", parquetByteArray, true},
+	{"duration_ms", parquetDouble, false},
+}
+
+// parquetChunk is the metadata of one written column of a row group.
+type parquetChunk struct {
+	offset       int64
+	uncompressed int64
+	compressed   int64
+}
+
+type parquetRowGroup struct {
+	rows   int64
+	chunks []parquetChunk
+}
+
+// parquetSample is one row of the file.
+type parquetSample struct {
+	test   string
+	result string
+	ms     float64
+}
+
+// ParquetSink writes each sample to a Parquet file with the columns test,
+// result and duration_ms. For very large runs, that are too big for the json
+// output, like for Spark or pandas. The columns are gzip compressed.
+//
+// The samples of each test are written as one row group, when they are
+// published, so they do not have to be kept until the end of the run. The
+// file is only complete after Close. Streaming results have no samples.
+type ParquetSink struct {
+	path      string
+	f         *os.File
+	offset    int64
+	rows      int64
+	rowGroups []parquetRowGroup
+}
+
+// NewParquetSink creates a ParquetSink, that writes to the file at path.
+func NewParquetSink(path string) *ParquetSink {
+	return &ParquetSink{path: path}
+}
+
+// Publish writes the samples of one test as a row group.
+func (s *ParquetSink) Publish(test string, results []*TestResult) error {
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	var samples []parquetSample
+	for _, r := range results {
+		for _, v := range r.Values() {
+			samples = append(samples, parquetSample{test: test, result: r.Description(), ms: ms(v)})
+		}
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+
+	group := parquetRowGroup{rows: int64(len(samples))}
+	for i := range parquetColumns {
+		chunk, err := s.writeChunk(i, samples)
+		if err != nil {
+			return err
+		}
+		group.chunks = append(group.chunks, chunk)
+	}
+	s.rowGroups = append(s.rowGroups, group)
+	s.rows += group.rows
+	return nil
+}
+
+// Close writes the metadata of the file and closes it.
+func (s *ParquetSink) Close() error {
+	if err := s.open(); err != nil {
+		return err
+	}
+	footer := s.metadata()
+	binary.Write(&footer, binary.LittleEndian, uint32(footer.Len()))
+	footer.WriteString("PAR1")
+	if _, err := s.f.Write(footer.Bytes()); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+// open creates the file, if it is not open yet.
+func (s *ParquetSink) open() error {
+	if s.f != nil {
+		return nil
+	}
+	f, err := os.Create(s.path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte("PAR1")); err != nil {
+		f.Close()
+		return err
+	}
+	s.f = f
+	s.offset = 4
+	return nil
+}
+
+// writeChunk writes one column of the samples as pages of at most
+// parquetPageRows values.
+func (s *ParquetSink) writeChunk(column int, samples []parquetSample) (parquetChunk, error) {
+	chunk := parquetChunk{offset: s.offset}
+	for start := 0; start < len(samples); start += parquetPageRows {
+		end := start + parquetPageRows
+		if end > len(samples) {
+			end = len(samples)
+		}
+
+		var values bytes.Buffer
+		for _, sample := range samples[start:end] {
+			switch column {
+			case 0, 1:
+				v := sample.test
+				if column == 1 {
+					v = sample.result
+				}
+				binary.Write(&values, binary.LittleEndian, uint32(len(v)))
+				values.WriteString(v)
+			case 2:
+				binary.Write(&values, binary.LittleEndian, math.Float64bits(sample.ms))
+			}
+		}
+
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		if _, err := zw.Write(values.Bytes()); err != nil {
+			return chunk, err
+		}
+		if err := zw.Close(); err != nil {
+			return chunk, err
+		}
+
+		var header thriftWriter
+		header.begin()
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(values.Len()))
+		header.i32(3, int32(compressed.Len()))
+		header.structField(5)
+		header.i32(1, int32(end-start))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.end()
+		header.end()
+
+		if _, err := s.f.Write(header.buf.Bytes()); err != nil {
+			return chunk, err
+		}
+		if _, err := s.f.Write(compressed.Bytes()); err != nil {
+			return chunk, err
+		}
+		chunk.uncompressed += int64(header.buf.Len() + values.Len())
+		chunk.compressed += int64(header.buf.Len() + compressed.Len())
+		s.offset += int64(header.buf.Len() + compressed.Len())
+	}
+	return chunk, nil
+}
+
+// metadata returns the FileMetaData of the file.
+func (s *ParquetSink) metadata() bytes.Buffer {
+	var w thriftWriter
+	w.begin()
+	w.i32(1, 1)
+
+	w.list(2, thriftStruct, len(parquetColumns)+1)
+	w.begin()
+	w.binary(4, "schema")
+	w.i32(5, int32(len(parquetColumns)))
+	w.end()
+	for _, c := range parquetColumns {
+		w.begin()
+		w.i32(1, c.kind)
+		w.i32(3, parquetRequired)
+		w.binary(4, c.name)
+		if c.utf8 {
+			w.i32(6, parquetUTF8)
+		}
+		w.end()
+	}
+
+	w.i64(3, s.rows)
+
+	w.list(4, thriftStruct, len(s.rowGroups))
+	for _, g := range s.rowGroups {
+		var size int64
+		w.begin()
+		w.list(1, thriftStruct, len(g.chunks))
+		for i, chunk := range g.chunks {
+			c := parquetColumns[i]
+			size += chunk.uncompressed
+			w.begin()
+			w.i64(2, chunk.offset)
+			w.structField(3)
+			w.i32(1, c.kind)
+			w.list(2, thriftI32, 2)
+			w.varint(zigzag(parquetPlain))
+			w.varint(zigzag(parquetRLE))
+			w.list(3, thriftBinary, 1)
+			w.varint(uint64(len(c.name)))
+			w.buf.WriteString(c.name)
+			w.i32(4, parquetGzip)
+			w.i64(5, g.rows)
+			w.i64(6, chunk.uncompressed)
+			w.i64(7, chunk.compressed)
+			w.i64(9, chunk.offset)
+			w.end()
+			w.end()
+		}
+		w.i64(2, size)
+		w.i64(3, g.rows)
+		w.end()
+	}
+
+	w.binary(6, "oswstest")
+	w.end()
+	return w.buf
+}
+
+// Types of the thrift compact protocol, that is used for the metadata of
+// parquet.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter writes structs with the thrift compact protocol. Each struct
+// starts with begin and ends with end.
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last int16
+	ids  []int16
+}
+
+func (w *thriftWriter) begin() {
+	w.ids = append(w.ids, w.last)
+	w.last = 0
+}
+
+func (w *thriftWriter) end() {
+	w.buf.WriteByte(0)
+	w.last = w.ids[len(w.ids)-1]
+	w.ids = w.ids[:len(w.ids)-1]
+}
+
+func (w *thriftWriter) field(id int16, kind byte) {
+	if delta := id - w.last; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | kind)
+	} else {
+		w.buf.WriteByte(kind)
+		w.varint(zigzag(int64(id)))
+	}
+	w.last = id
+}
+
+func (w *thriftWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.varint(zigzag(int64(v)))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.varint(zigzag(v))
+}
+
+func (w *thriftWriter) binary(id int16, v string) {
+	w.field(id, thriftBinary)
+	w.varint(uint64(len(v)))
+	w.buf.WriteString(v)
+}
+
+// structField starts a struct as field. It has to be ended with end.
+func (w *thriftWriter) structField(id int16) {
+	w.field(id, thriftStruct)
+	w.begin()
+}
+
+// list starts a list field with n elements of kind. The elements are written
+// without field header.
+func (w *thriftWriter) list(id int16, kind byte, n int) {
+	w.field(id, thriftList)
+	if n < 15 {
+		w.buf.WriteByte(byte(n)<<4 | kind)
+		return
+	}
+	w.buf.WriteByte(0xf0 | kind)
+	w.varint(uint64(n))
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
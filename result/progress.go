@@ -0,0 +1,55 @@
+package result
+
+import (
+	"fmt"
+	"time"
+)
+
+// Progress is the state of a result with an expected number of samples.
+type Progress struct {
+	Description string
+	Count       int
+	Total       int
+
+	// Elapsed is the time since the samples were expected.
+	Elapsed time.Duration
+}
+
+// Percent returns the part of the expected samples, that were observed, from
+// 0 to 100.
+func (p Progress) Percent() float64 {
+	if p.Total <= 0 {
+		return 100
+	}
+	percent := float64(p.Count) / float64(p.Total) * 100
+	if percent > 100 {
+		return 100
+	}
+	return percent
+}
+
+// ETA returns the estimated time until all samples are observed. It is
+// calculated from the rate of the samples so far. ok is false, if there are
+// no samples yet.
+func (p Progress) ETA() (eta time.Duration, ok bool) {
+	if p.Count >= p.Total {
+		return 0, true
+	}
+	if p.Count == 0 || p.Elapsed <= 0 {
+		return 0, false
+	}
+	perSample := float64(p.Elapsed) / float64(p.Count)
+	return time.Duration(perSample * float64(p.Total-p.Count)), true
+}
+
+// String returns the progress like "name: 1200 of 2000 (60%), ETA 3s".
+func (p Progress) String() string {
+	s := fmt.Sprintf("%s: %d of %d (%.0f%%)", p.Description, p.Count, p.Total, p.Percent())
+	if p.Count >= p.Total {
+		return s
+	}
+	if eta, ok := p.ETA(); ok {
+		return fmt.Sprintf("%s, ETA %s", s, eta.Round(time.Second))
+	}
+	return s + ", ETA unknown"
+}
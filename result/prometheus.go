@@ -0,0 +1,80 @@
+package result
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// PrometheusSink writes the results in the prometheus text format, when it is
+// closed. The file can be read by the textfile collector of the node
+// exporter.
+type PrometheusSink struct {
+	path    string
+	tests   []string
+	results [][]*TestResult
+}
+
+// NewPrometheusSink creates a PrometheusSink, that writes to the file at path.
+func NewPrometheusSink(path string) *PrometheusSink {
+	return &PrometheusSink{path: path}
+}
+
+// Publish saves the results of one test.
+func (s *PrometheusSink) Publish(test string, results []*TestResult) error {
+	s.tests = append(s.tests, test)
+	s.results = append(s.results, results)
+	return nil
+}
+
+// Close writes the file.
+func (s *PrometheusSink) Close() error {
+	f, err := os.Create(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return writePrometheus(f, s.tests, s.results)
+}
+
+// prometheusEscaper escapes label values in the prometheus text format.
+var prometheusEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writePrometheus writes the results of some tests in the prometheus text
+// format.
+func writePrometheus(w io.Writer, tests []string, results [][]*TestResult) error {
+	metrics := []struct {
+		name  string
+		help  string
+		value func(r *TestResult) float64
+	}{
+		{"oswstest_count", "Number of measured values.", func(r *TestResult) float64 { return float64(r.Count()) }},
+		{"oswstest_errors", "Number of errors.", func(r *TestResult) float64 { return float64(r.ErrCount()) }},
+		{"oswstest_min_seconds", "Smallest measured duration.", func(r *TestResult) float64 { return r.Min().Seconds() }},
+		{"oswstest_max_seconds", "Biggest measured duration.", func(r *TestResult) float64 { return r.Max().Seconds() }},
+		{"oswstest_ave_seconds", "Average of the measured durations.", func(r *TestResult) float64 { return r.Ave().Seconds() }},
+	}
+
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name); err != nil {
+			return err
+		}
+		for i, test := range tests {
+			for _, r := range results[i] {
+				_, err := fmt.Fprintf(
+					w,
+					"%s{test=\"%s\",result=\"%s\"} %g\n",
+					m.name,
+					prometheusEscaper.Replace(test),
+					prometheusEscaper.Replace(r.Description()),
+					m.value(r),
+				)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package result
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// PushgatewaySink pushes the results to a Prometheus Pushgateway. For runs,
+// that end before they could be scraped.
+//
+// The results of each test are pushed, when they are published, with the
+// grouping key job="oswstest", run=<start time> and test=<test>. They are the
+// metrics of the PrometheusSink. When the sink is closed, the metrics of the
+// whole run are pushed with the grouping key job="oswstest" and run=<start
+// time>.
+type PushgatewaySink struct {
+	url     string
+	run     string
+	started time.Time
+	client  *http.Client
+
+	tests   int
+	samples int
+	errors  int
+}
+
+// NewPushgatewaySink creates a PushgatewaySink for the Pushgateway at url,
+// like http://localhost:9091.
+func NewPushgatewaySink(url string) *PushgatewaySink {
+	now := time.Now()
+	return &PushgatewaySink{
+		url:     strings.TrimSuffix(url, "/"),
+		run:     now.Format("20060102-150405"),
+		started: now,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Publish pushes the results of one test.
+func (s *PushgatewaySink) Publish(test string, results []*TestResult) error {
+	s.tests++
+	for _, r := range results {
+		s.samples += r.Count()
+		s.errors += r.ErrCount()
+	}
+
+	var buf bytes.Buffer
+	if err := writePrometheus(&buf, []string{test}, [][]*TestResult{results}); err != nil {
+		return err
+	}
+	return s.push(&buf, "test", test)
+}
+
+// Close pushes the metrics of the run.
+func (s *PushgatewaySink) Close() error {
+	metrics := []struct {
+		name  string
+		help  string
+		value float64
+	}{
+		{"oswstest_run_duration_seconds", "Time of the run.", time.Since(s.started).Seconds()},
+		{"oswstest_run_tests", "Number of tests of the run.", float64(s.tests)},
+		{"oswstest_run_count", "Number of measured values of all tests.", float64(s.samples)},
+		{"oswstest_run_errors", "Number of errors of all tests.", float64(s.errors)},
+		{"oswstest_run_finished_timestamp_seconds", "Time, when the run finished.", float64(time.Now().Unix())},
+	}
+
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", m.name, m.help, m.name, m.name, m.value)
+	}
+	return s.push(&buf)
+}
+
+// push replaces the metrics of a group on the Pushgateway. The group is
+// job="oswstest", run=<start time> and the additional labels, that are given
+// as name and value.
+func (s *PushgatewaySink) push(body *bytes.Buffer, labels ...string) error {
+	path := s.url + "/metrics/job/oswstest" + pushgatewayLabel("run", s.run)
+	for i := 0; i+1 < len(labels); i += 2 {
+		path += pushgatewayLabel(labels[i], labels[i+1])
+	}
+
+	req, err := http.NewRequest("PUT", path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("pushgateway returned %s", resp.Status)
+	}
+	return nil
+}
+
+// pushgatewayLabel returns a label of the grouping key as part of the url.
+// Values with a slash are base64 encoded and an empty value is "=", like the
+// Pushgateway expects it.
+func pushgatewayLabel(name, value string) string {
+	if value == "" {
+		return "/" + name + "@base64/="
+	}
+	if strings.Contains(value, "/") {
+		return "/" + name + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+	return "/" + name + "/" + url.PathEscape(value)
+}
@@ -0,0 +1,255 @@
+// Package result contains the results of the tests.
+package result
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TestResult collects the measured durations and the errors of one value of a
+// test.
+//
+// A streaming TestResult does not keep the durations but only there
+// statistics, so it needs the same memory for a soak test with millions of
+// samples.
+//
+// A TestResult is safe for concurrent use, so the clients of a test can add
+// there durations and errors from there own goroutines.
+type TestResult struct {
+	mu          sync.Mutex
+	values      []time.Duration
+	errors      []error
+	description string
+	streaming   bool
+	stats       Stats
+}
+
+// New creates an empty TestResult with a description.
+func New(description string) *TestResult {
+	return &TestResult{description: description}
+}
+
+// NewStreaming creates an empty TestResult, that only keeps the statistics of
+// the durations.
+func NewStreaming(description string) *TestResult {
+	return &TestResult{description: description, streaming: true}
+}
+
+// Add adds a measured duration.
+func (t *TestResult) Add(value time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stats.add(value)
+	if !t.streaming {
+		t.values = append(t.values, value)
+	}
+}
+
+// AddStats adds the statistics of durations, that were measured somewhere
+// else.
+func (t *TestResult) AddStats(stats Stats) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stats.merge(stats)
+}
+
+// AddError adds an error.
+func (t *TestResult) AddError(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.errors = append(t.errors, err)
+}
+
+// Description returns the description of the result.
+func (t *TestResult) Description() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.description
+}
+
+// Values returns a copy of all measured durations. It is empty for a
+// streaming result.
+func (t *TestResult) Values() []time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.values == nil {
+		return nil
+	}
+	values := make([]time.Duration, len(t.values))
+	copy(values, t.values)
+	return values
+}
+
+// Streaming returns true, if the result only keeps the statistics.
+func (t *TestResult) Streaming() bool {
+	return t.streaming
+}
+
+// Stats returns the statistics of the measured durations.
+func (t *TestResult) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats
+}
+
+// Errors returns a copy of all errors.
+func (t *TestResult) Errors() []error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.errors == nil {
+		return nil
+	}
+	errs := make([]error, len(t.errors))
+	copy(errs, t.errors)
+	return errs
+}
+
+// String returns the result with all errors.
+func (t *TestResult) String() string {
+	return t.Format(true)
+}
+
+// Format returns the result as text. If showAllErrors is false, only the
+// first error is shown.
+func (t *TestResult) Format(showAllErrors bool) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := fmt.Sprintf(
+		"%s\ncount: %d\nmin: %dms\nmax: %dms\nave: %dms\n",
+		t.description,
+		t.stats.Count,
+		t.stats.Min/time.Millisecond,
+		t.stats.Max/time.Millisecond,
+		time.Duration(t.stats.Mean)/time.Millisecond,
+	)
+	if t.streaming {
+		s += fmt.Sprintf("stddev: %dms\nhistogram: %s\n", t.stats.StdDev()/time.Millisecond, t.stats.Histogram())
+	}
+	if len(t.errors) > 0 {
+		s += fmt.Sprintf("error count: %d\n", len(t.errors))
+		if showAllErrors {
+			for i, err := range t.errors {
+				s += fmt.Sprintf("%3d error: %s\n", i+1, err)
+			}
+		} else {
+			s += fmt.Sprintf("first error: %s\n", t.errors[0])
+		}
+	}
+	return s
+}
+
+// Count returns the number of measured durations.
+func (t *TestResult) Count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats.Count
+}
+
+// ErrCount returns the number of errors.
+func (t *TestResult) ErrCount() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.errors)
+}
+
+// CountBoth returns the number of measured durations and errors.
+func (t *TestResult) CountBoth() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats.Count + len(t.errors)
+}
+
+// Min returns the smallest measured duration.
+func (t *TestResult) Min() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats.Min
+}
+
+// Max returns the biggest measured duration.
+func (t *TestResult) Max() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats.Max
+}
+
+// Ave returns the average of all measured durations.
+func (t *TestResult) Ave() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Duration(t.stats.Mean)
+}
+
+// StdDev returns the standard deviation of the measured durations.
+func (t *TestResult) StdDev() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats.StdDev()
+}
+
+// Percentile returns the duration, that p percent of the measured durations
+// are not bigger then, like 95 for the 95th percentile. A streaming result
+// has no durations. There, the upper bound of the histogram bucket is
+// returned, but not more then Max.
+func (t *TestResult) Percentile(p float64) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stats.Count == 0 {
+		return 0
+	}
+	// The nearest rank of the sorted durations.
+	rank := int(math.Ceil(p/100*float64(t.stats.Count))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= t.stats.Count {
+		rank = t.stats.Count - 1
+	}
+
+	if !t.streaming {
+		values := make([]time.Duration, len(t.values))
+		copy(values, t.values)
+		sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+		return values[rank]
+	}
+
+	var seen int
+	for i, n := range t.stats.Buckets {
+		seen += n
+		if seen > rank {
+			if i < len(HistogramBounds) && HistogramBounds[i] < t.stats.Max {
+				return HistogramBounds[i]
+			}
+			return t.stats.Max
+		}
+	}
+	return t.stats.Max
+}
+
+// Label adds labels to the description of the result, like the Collector does.
+func (t *TestResult) Label(labels Labels) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(labels) > 0 {
+		t.description = fmt.Sprintf("%s (%s)", t.description, labels)
+	}
+}
+
+// Merge adds the values and errors of another result. The other result is
+// copied first, so the two results are never locked at the same time.
+func (t *TestResult) Merge(other *TestResult) {
+	stats := other.Stats()
+	values := other.Values()
+	errs := other.Errors()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stats.merge(stats)
+	if !t.streaming {
+		t.values = append(t.values, values...)
+	}
+	t.errors = append(t.errors, errs...)
+}
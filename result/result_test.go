@@ -0,0 +1,75 @@
+package result
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConcurrentUse adds durations and errors from many goroutines, while
+// others read the result. Run it with -race.
+func TestConcurrentUse(t *testing.T) {
+	const goroutines = 50
+	const perGoroutine = 200
+
+	for _, streaming := range []bool{false, true} {
+		r := New("concurrent")
+		if streaming {
+			r = NewStreaming("concurrent")
+		}
+
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for i := 1; i <= perGoroutine; i++ {
+					r.Add(time.Duration(i) * time.Millisecond)
+					if i%10 == 0 {
+						r.AddError(errors.New("some error"))
+					}
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for i := 0; i < perGoroutine/10; i++ {
+					r.Stats()
+					r.Count()
+					r.CountBoth()
+					r.Ave()
+					r.StdDev()
+					r.Percentile(95)
+					r.Values()
+					r.Errors()
+					r.Format(false)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if got, want := r.Count(), goroutines*perGoroutine; got != want {
+			t.Errorf("streaming=%t: got %d durations, expected %d", streaming, got, want)
+		}
+		if got, want := r.ErrCount(), goroutines*perGoroutine/10; got != want {
+			t.Errorf("streaming=%t: got %d errors, expected %d", streaming, got, want)
+		}
+		if got, want := r.CountBoth(), goroutines*perGoroutine*11/10; got != want {
+			t.Errorf("streaming=%t: got %d samples, expected %d", streaming, got, want)
+		}
+		stats := r.Stats()
+		if stats.Min != time.Millisecond || stats.Max != perGoroutine*time.Millisecond {
+			t.Errorf("streaming=%t: got min %s and max %s, expected 1ms and %dms", streaming, stats.Min, stats.Max, perGoroutine)
+		}
+		var buckets int
+		for _, n := range stats.Buckets {
+			buckets += n
+		}
+		if buckets != goroutines*perGoroutine {
+			t.Errorf("streaming=%t: got %d durations in the histogram, expected %d", streaming, buckets, goroutines*perGoroutine)
+		}
+		if !streaming && len(r.Values()) != goroutines*perGoroutine {
+			t.Errorf("got %d values, expected %d", len(r.Values()), goroutines*perGoroutine)
+		}
+	}
+}
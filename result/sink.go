@@ -0,0 +1,121 @@
+package result
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Sink receives the results of the tests. The runner publishes the results of
+// each test to all sinks and closes them after the last test.
+type Sink interface {
+	// Publish is called with the results of one test. The raw samples of
+	// each result are available with TestResult.Values.
+	Publish(test string, results []*TestResult) error
+
+	// Close is called after the last test.
+	Close() error
+}
+
+// SinkOpener creates a sink for the path of its spec.
+type SinkOpener func(path string) (Sink, error)
+
+var (
+	openersMu sync.Mutex
+	openers   = make(map[string]SinkOpener)
+)
+
+// RegisterSink makes a sink of another package available for OpenSinks by
+// its type. It panics, if the type was already registered.
+func RegisterSink(kind string, open SinkOpener) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+	if _, ok := openers[kind]; ok {
+		panic("result: RegisterSink called twice for sink " + kind)
+	}
+	openers[kind] = open
+}
+
+// lookupSink returns the opener of a registered sink.
+func lookupSink(kind string) (SinkOpener, bool) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+	open, ok := openers[kind]
+	return open, ok
+}
+
+// OpenSinks creates the sinks for a list of specs. A spec is the type of the
+// sink, optional followed by a colon and the path of the output file:
+//
+//	console
+//	json:results.json
+//	influx:results.influx
+//	prometheus:results.prom
+//	k6:summary.json
+//	locust:results_stats.csv
+//	pushgateway:http://localhost:9091
+//	elasticsearch:http://localhost:9200/oswstest
+//	parquet:samples.parquet
+//
+// Other types can be added with RegisterSink.
+//
+// The console sink writes to stdout with the options console. With
+// console.Summary, it writes one line per test instead of the table.
+func OpenSinks(specs []string, stdout io.Writer, console ConsoleOptions) ([]Sink, error) {
+	var sinks []Sink
+	for _, spec := range specs {
+		kind, path := spec, ""
+		if i := strings.Index(spec, ":"); i >= 0 {
+			kind, path = spec[:i], spec[i+1:]
+		}
+
+		var sink Sink
+		switch kind {
+		case "console":
+			if console.Summary {
+				sink = NewSummarySink(stdout)
+				break
+			}
+			sink = NewConsoleSinkWithOptions(stdout, console)
+		case "json":
+			sink = NewJSONSink(path)
+		case "influx":
+			sink = NewInfluxSink(path)
+		case "prometheus":
+			sink = NewPrometheusSink(path)
+		case "k6":
+			sink = NewK6Sink(path)
+		case "locust":
+			sink = NewLocustSink(path)
+		case "pushgateway":
+			sink = NewPushgatewaySink(path)
+		case "parquet":
+			sink = NewParquetSink(path)
+		case "elasticsearch", "opensearch":
+			es, err := NewElasticsearchSink(path)
+			if err != nil {
+				return nil, err
+			}
+			sink = es
+		default:
+			open, ok := lookupSink(kind)
+			if !ok {
+				return nil, fmt.Errorf("unknown result sink %q", kind)
+			}
+			if path == "" {
+				break
+			}
+			s, err := open(path)
+			if err != nil {
+				return nil, fmt.Errorf("can not open result sink %s: %s", kind, err)
+			}
+			sink = s
+		}
+		if kind != "console" && path == "" {
+			return nil, fmt.Errorf("result sink %q needs a path like %s:results", kind, kind)
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
@@ -0,0 +1,126 @@
+package result
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// HistogramBounds are the upper bounds of the buckets of the histogram in
+// Stats. There is one more bucket for all durations, that are bigger then the
+// last bound.
+var HistogramBounds = [...]time.Duration{
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	20 * time.Second,
+	60 * time.Second,
+}
+
+// Stats are the statistics of measured durations. They need the same memory,
+// how many durations there ever are.
+type Stats struct {
+	Count int           `json:"count"`
+	Min   time.Duration `json:"min"`
+	Max   time.Duration `json:"max"`
+
+	// Mean is the average in nanoseconds and M2 the sum of the squared
+	// differences to the mean. They are updated with the algorithm of
+	// Welford.
+	Mean float64 `json:"mean"`
+	M2   float64 `json:"m2"`
+
+	// Buckets counts the durations for each bound in HistogramBounds. A
+	// duration is counted in the first bucket, that it fits in.
+	Buckets [len(HistogramBounds) + 1]int `json:"buckets"`
+}
+
+// add adds one duration.
+func (s *Stats) add(v time.Duration) {
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if v > s.Max {
+		s.Max = v
+	}
+	s.Count++
+	delta := float64(v) - s.Mean
+	s.Mean += delta / float64(s.Count)
+	s.M2 += delta * (float64(v) - s.Mean)
+	s.Buckets[bucket(v)]++
+}
+
+// merge adds the durations of other stats.
+func (s *Stats) merge(other Stats) {
+	if other.Count == 0 {
+		return
+	}
+	if s.Count == 0 {
+		*s = other
+		return
+	}
+	if other.Min < s.Min {
+		s.Min = other.Min
+	}
+	if other.Max > s.Max {
+		s.Max = other.Max
+	}
+	count := float64(s.Count + other.Count)
+	delta := other.Mean - s.Mean
+	s.M2 += other.M2 + delta*delta*float64(s.Count)*float64(other.Count)/count
+	s.Mean += delta * float64(other.Count) / count
+	s.Count += other.Count
+	for i, n := range other.Buckets {
+		s.Buckets[i] += n
+	}
+}
+
+// Variance returns the variance of the durations in nanoseconds squared.
+func (s Stats) Variance() float64 {
+	if s.Count < 2 {
+		return 0
+	}
+	return s.M2 / float64(s.Count-1)
+}
+
+// StdDev returns the standard deviation of the durations.
+func (s Stats) StdDev() time.Duration {
+	return time.Duration(math.Sqrt(s.Variance()))
+}
+
+// Histogram returns the not empty buckets like "<=1ms: 3, <=2ms: 10, >1m0s: 1".
+func (s Stats) Histogram() string {
+	var parts []string
+	for i, n := range s.Buckets {
+		if n == 0 {
+			continue
+		}
+		if i == len(HistogramBounds) {
+			parts = append(parts, fmt.Sprintf(">%s: %d", HistogramBounds[i-1], n))
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("<=%s: %d", HistogramBounds[i], n))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// bucket returns the index of the bucket for a duration.
+func bucket(v time.Duration) int {
+	for i, bound := range HistogramBounds {
+		if v <= bound {
+			return i
+		}
+	}
+	return len(HistogramBounds)
+}
@@ -0,0 +1,71 @@
+package result
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// SummarySink writes exactly one line for each test, like
+//
+//	onewrite ok results=1 count=100 errors=0 min=3ms ave=5ms max=9ms
+//
+// The status is "failed", if a result of the test has errors. The count,
+// errors, min and max are of all results of the test, the average is
+// weighted by the count of each result. The lines are meant for grep in CI
+// logs.
+type SummarySink struct {
+	w io.Writer
+}
+
+// NewSummarySink creates a SummarySink, that writes to w.
+func NewSummarySink(w io.Writer) *SummarySink {
+	return &SummarySink{w: w}
+}
+
+// Publish writes the line of the test.
+func (s *SummarySink) Publish(test string, results []*TestResult) error {
+	var count, errors int
+	var min, max, sum time.Duration
+	for _, r := range results {
+		if r.Count() > 0 {
+			if count == 0 || r.Min() < min {
+				min = r.Min()
+			}
+			if r.Max() > max {
+				max = r.Max()
+			}
+			sum += r.Ave() * time.Duration(r.Count())
+		}
+		count += r.Count()
+		errors += r.ErrCount()
+	}
+
+	var ave time.Duration
+	if count > 0 {
+		ave = sum / time.Duration(count)
+	}
+	status := "ok"
+	if errors > 0 {
+		status = "failed"
+	}
+
+	_, err := fmt.Fprintf(
+		s.w,
+		"%s %s results=%d count=%d errors=%d min=%dms ave=%dms max=%dms\n",
+		test,
+		status,
+		len(results),
+		count,
+		errors,
+		min/time.Millisecond,
+		ave/time.Millisecond,
+		max/time.Millisecond,
+	)
+	return err
+}
+
+// Close does nothing. The lines are written by Publish.
+func (s *SummarySink) Close() error {
+	return nil
+}
@@ -0,0 +1,123 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/OneOfOne/xxhash"
+	"github.com/ostcar/oswstest/client"
+	"github.com/ostcar/oswstest/result"
+)
+
+// divergentElements is the name of the results of the consistency check. There
+// is one result for each collection.
+const divergentElements = "Elements, that differ from the server"
+
+// updateState applies the elements of a message to the state of a client. The
+// state is the hash of the data of each element, the client knows.
+func (m *messageChecks) updateState(c client.Client, elements []messageElement) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state := m.states[c]
+	if state == nil {
+		state = make(map[client.Element]uint64)
+		m.states[c] = state
+	}
+
+	for _, e := range elements {
+		object, ok := e.value.(map[string]interface{})
+		if !ok || e.typ == "unknown" {
+			continue
+		}
+		id, ok := elementID(object["id"])
+		if !ok {
+			continue
+		}
+		key := client.Element{Collection: e.typ, ID: id}
+		if object["action"] == "deleted" {
+			delete(state, key)
+			continue
+		}
+		state[key] = hashValue(object["data"])
+	}
+}
+
+// checkConsistency fetches all elements, the admin clients know, from the
+// server and compares them with the state of each admin client. Only admin
+// clients are compared, because the elements are fetched with an admin
+// account and other clients can get less data.
+func (m *messageChecks) checkConsistency(ctx context.Context, env *Env) []*result.TestResult {
+	if m == nil || m.states == nil {
+		return nil
+	}
+	log.Println("Start consistency check")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var admins []client.Client
+	known := make(map[client.Element]bool)
+	for _, c := range env.Clients {
+		if !c.IsAdmin() || m.states[c] == nil {
+			continue
+		}
+		admins = append(admins, c)
+		for key := range m.states[c] {
+			known[key] = true
+		}
+	}
+	elements := make([]client.Element, 0, len(known))
+	for key := range known {
+		elements = append(elements, key)
+	}
+	sort.Slice(elements, func(i, j int) bool { return elements[i].String() < elements[j].String() })
+
+	collector := env.NewCollector()
+	collector.Declare(divergentElements, nil)
+	server, err := client.FetchElements(ctx, env.Config, elements)
+	if err != nil {
+		collector.Observe(divergentElements, nil, 0, err)
+		return collector.Results()
+	}
+
+	for _, c := range admins {
+		state := m.states[c]
+		for _, key := range elements {
+			labels := result.Labels{"collection": key.Collection}
+			data, onServer := server[key]
+			hash, onClient := state[key]
+			switch {
+			case onServer && !onClient:
+				collector.Observe(divergentElements, labels, 0, fmt.Errorf("%s: %s is missing", c, key))
+			case !onServer && onClient:
+				collector.Observe(divergentElements, labels, 0, fmt.Errorf("%s: %s is deleted on the server", c, key))
+			case onServer && hash != hashValue(data):
+				collector.Observe(divergentElements, labels, 0, fmt.Errorf("%s: %s has other data then the server", c, key))
+			}
+		}
+	}
+	return collector.Results()
+}
+
+// elementID returns the id of an element as string.
+func elementID(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case string:
+		return v, true
+	}
+	return "", false
+}
+
+// hashValue returns the hash of a decoded json value. encoding/json sorts the
+// keys, so the same value has the same hash.
+func hashValue(v interface{}) uint64 {
+	// A decoded json value can always be encoded again.
+	data, _ := json.Marshal(v)
+	return xxhash.Checksum64(data)
+}
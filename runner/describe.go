@@ -0,0 +1,117 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Describer is implemented by tests, that have a description. The
+// description is shown in the list of the tests.
+type Describer interface {
+	Description() string
+}
+
+// describedTest is a Test with a description.
+type describedTest struct {
+	Test
+	description string
+}
+
+func (t *describedTest) Description() string { return t.description }
+
+// Provides and Breaks return the effects of the wrapped test, so WithEffects
+// and WithDescription can be used in any order.
+func (t *describedTest) Provides() []Requirement {
+	if e, ok := t.Test.(Effects); ok {
+		return e.Provides()
+	}
+	return nil
+}
+
+func (t *describedTest) Breaks() []Requirement {
+	if e, ok := t.Test.(Effects); ok {
+		return e.Breaks()
+	}
+	return nil
+}
+
+// Description returns the description of the wrapped test.
+func (t *effectTest) Description() string { return describeTest(t.Test) }
+
+// WithDescription returns the test with a description.
+func WithDescription(t Test, description string) Test {
+	return &describedTest{Test: t, description: description}
+}
+
+// describeTest returns the description of a test or an empty string.
+func describeTest(t Test) string {
+	if d, ok := t.(Describer); ok {
+		return d.Description()
+	}
+	return ""
+}
+
+// TestInfo is the metadata of a registered test.
+type TestInfo struct {
+	Name         string
+	Description  string
+	Requirements []Requirement
+
+	// Provides and Breaks are the effects of the test on the clients.
+	Provides []Requirement
+	Breaks   []Requirement
+}
+
+// String returns the info as an indented text block.
+func (i TestInfo) String() string {
+	var b strings.Builder
+	b.WriteString(i.Name + "\n")
+	if i.Description != "" {
+		fmt.Fprintf(&b, "    %s\n", i.Description)
+	}
+	fmt.Fprintf(&b, "    requires: %s\n", joinRequirements(i.Requirements))
+	if len(i.Provides) > 0 {
+		fmt.Fprintf(&b, "    afterwards: %s\n", joinRequirements(i.Provides))
+	}
+	if len(i.Breaks) > 0 {
+		fmt.Fprintf(&b, "    afterwards not: %s\n", joinRequirements(i.Breaks))
+	}
+	return b.String()
+}
+
+// joinRequirements returns the descriptions of the requirements separated by
+// commas or "nothing".
+func joinRequirements(requirements []Requirement) string {
+	if len(requirements) == 0 {
+		return "nothing"
+	}
+	parts := make([]string, len(requirements))
+	for i, r := range requirements {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// TestInfos returns the metadata of all registered tests sorted by there
+// names.
+func TestInfos() []TestInfo {
+	names := TestNames()
+	infos := make([]TestInfo, 0, len(names))
+	for _, name := range names {
+		t, ok := LookupTest(name)
+		if !ok {
+			continue
+		}
+		info := TestInfo{
+			Name:         name,
+			Description:  describeTest(t),
+			Requirements: t.Requirements(),
+		}
+		if e, ok := t.(Effects); ok {
+			info.Provides = e.Provides()
+			info.Breaks = e.Breaks()
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
@@ -0,0 +1,53 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package runner
+
+import (
+	"fmt"
+	"log"
+	"syscall"
+
+	"github.com/ostcar/oswstest/config"
+)
+
+// checkFileLimit compares the limit of open files with the files, that the
+// clients need. If the soft limit is too low, it is raised up to the hard
+// limit. It returns an error, if the clients can not fit.
+func checkFileLimit(cfg *config.Config, clients int) error {
+	need := neededFiles(cfg, clients)
+
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		log.Printf("Can not read the limit of open files, %s", err)
+		return nil
+	}
+	if limit.Cur >= need {
+		return nil
+	}
+
+	if limit.Max >= need {
+		raised := limit
+		raised.Cur = need
+		if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &raised); err == nil {
+			log.Printf("Raised the limit of open files from %d to %d", limit.Cur, need)
+			return nil
+		}
+	}
+	return fmt.Errorf(
+		"%d clients need about %d open files, but the limit is %d (hard limit %d). Raise it with \"ulimit -n %d\" or use less clients",
+		clients, need, limit.Cur, limit.Max, need,
+	)
+}
+
+// reservedFiles are the open files of oswstest, that do not belong to a
+// client, like the idle http connections of the shared transport, listeners
+// and result files.
+const reservedFiles = 150
+
+// neededFiles estimates the open files for a number of clients. Each client
+// holds one connection. The workers of the logins, connects and sends open
+// an additional http connection each.
+func neededFiles(cfg *config.Config, clients int) uint64 {
+	return uint64(clients + cfg.ParallelLogins + cfg.ParallelConnections + cfg.ParallelSends + reservedFiles)
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package runner
+
+import "github.com/ostcar/oswstest/config"
+
+// checkFileLimit does nothing on systems without RLIMIT_NOFILE.
+func checkFileLimit(cfg *config.Config, clients int) error {
+	return nil
+}
@@ -0,0 +1,113 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/ostcar/oswstest/config"
+	"github.com/ostcar/oswstest/result"
+)
+
+// Hooks are functions, that are called by RunTests around the tests.
+//
+// An error of a BeforeRun hook stops RunTests before the first test. An error
+// of a BeforeTest or AfterTest hook lets the test fail. OnError hooks are
+// called for each failed test.
+type Hooks struct {
+	BeforeRun  []func(env *Env) error
+	BeforeTest []func(env *Env, test Test) error
+	AfterTest  []func(env *Env, test Test, results []*result.TestResult) error
+	OnError    []func(env *Env, test Test, err error)
+}
+
+// CommandHooks creates hooks for the shell commands in the configuration.
+//
+// The commands are run with "sh -c". The name of the test is in the
+// environment variable OSWSTEST_TEST and the error of a failed test in
+// OSWSTEST_ERROR.
+func CommandHooks(cfg *config.Config) *Hooks {
+	h := new(Hooks)
+	if cfg.BeforeRunCommand != "" {
+		h.BeforeRun = append(h.BeforeRun, func(env *Env) error {
+			return runHookCommand(cfg.BeforeRunCommand)
+		})
+	}
+	if cfg.BeforeTestCommand != "" {
+		h.BeforeTest = append(h.BeforeTest, func(env *Env, test Test) error {
+			return runHookCommand(cfg.BeforeTestCommand, "OSWSTEST_TEST="+test.Name())
+		})
+	}
+	if cfg.AfterTestCommand != "" {
+		h.AfterTest = append(h.AfterTest, func(env *Env, test Test, results []*result.TestResult) error {
+			return runHookCommand(cfg.AfterTestCommand, "OSWSTEST_TEST="+test.Name())
+		})
+	}
+	if cfg.OnErrorCommand != "" {
+		h.OnError = append(h.OnError, func(env *Env, test Test, err error) {
+			if err := runHookCommand(cfg.OnErrorCommand, "OSWSTEST_TEST="+test.Name(), "OSWSTEST_ERROR="+err.Error()); err != nil {
+				fmt.Fprintf(os.Stderr, "Can not run error hook, %s\n", err)
+			}
+		})
+	}
+	return h
+}
+
+// runHookCommand runs a shell command with additional environment variables.
+// The output of the command is passed through.
+func runHookCommand(command string, env ...string) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("hook %s failed: %s", strings.SplitN(command, " ", 2)[0], err)
+	}
+	return nil
+}
+
+func (h *Hooks) beforeRun(env *Env) error {
+	if h == nil {
+		return nil
+	}
+	for _, hook := range h.BeforeRun {
+		if err := hook(env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Hooks) beforeTest(env *Env, test Test) error {
+	if h == nil {
+		return nil
+	}
+	for _, hook := range h.BeforeTest {
+		if err := hook(env, test); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Hooks) afterTest(env *Env, test Test, results []*result.TestResult) error {
+	if h == nil {
+		return nil
+	}
+	for _, hook := range h.AfterTest {
+		if err := hook(env, test, results); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Hooks) onError(env *Env, test Test, err error) {
+	if h == nil {
+		return
+	}
+	for _, hook := range h.OnError {
+		hook(env, test, err)
+	}
+}
@@ -0,0 +1,68 @@
+package runner
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ostcar/oswstest/client"
+	"github.com/ostcar/oswstest/result"
+)
+
+// httpResponses is the name of the results of the http status codes. There is
+// one result for each status code.
+const httpResponses = "HTTP responses"
+
+// httpStatuses collects the status codes of the http requests of the clients
+// for the login and for each test. A nil httpStatuses collects nothing. The values of the results are the times of
+// the requests, so retried requests are also counted.
+type httpStatuses struct {
+	mu        sync.Mutex
+	collector *result.Collector
+}
+
+// attach sets the statuses as http observer of the clients.
+func (h *httpStatuses) attach(clients []client.Client) {
+	for _, c := range clients {
+		c.SetHTTPObserver(h.observe)
+	}
+}
+
+// begin starts to collect the status codes into a collector.
+func (h *httpStatuses) begin(collector *result.Collector) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.collector = collector
+}
+
+// end returns the status codes since begin.
+func (h *httpStatuses) end() []*result.TestResult {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.collector == nil {
+		return nil
+	}
+	r := h.collector.Results()
+	h.collector = nil
+	return r
+}
+
+func (h *httpStatuses) observe(status int, duration time.Duration, err error) {
+	h.mu.Lock()
+	collector := h.collector
+	h.mu.Unlock()
+	if collector == nil {
+		return
+	}
+	if err != nil {
+		collector.Observe(httpResponses, result.Labels{"status": "none"}, 0, err)
+		return
+	}
+	collector.Observe(httpResponses, result.Labels{"status": fmt.Sprint(status)}, duration, nil)
+}
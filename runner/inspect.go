@@ -0,0 +1,375 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/ostcar/oswstest/client"
+	"github.com/ostcar/oswstest/config"
+	"github.com/ostcar/oswstest/jsonpath"
+	"github.com/ostcar/oswstest/result"
+	"github.com/ostcar/oswstest/schema"
+)
+
+const (
+	// schemaViolations is the name of the results of the schema validation.
+	// There is one result for each message type.
+	schemaViolations = "Schema violations"
+
+	// duplicateMessages is the name of the results of the duplicate detection.
+	duplicateMessages = "Duplicate messages"
+
+	// reorderedMessages is the name of the results of the order check.
+	reorderedMessages = "Messages out of order"
+
+	// failedAssertions is the name of the results of the assertions. There is
+	// one result for each assertion.
+	failedAssertions = "Failed assertions"
+)
+
+// defaultAssertionTests are the tests, whose messages are checked by an
+// assertion without tests.
+var defaultAssertionTests = []string{"onewrite", "manywrite"}
+
+// assertion is a compiled config.Assertion.
+type assertion struct {
+	source string
+	path   *jsonpath.Path
+	value  interface{}
+	tests  map[string]bool
+}
+
+// newAssertion compiles an assertion.
+func newAssertion(a config.Assertion) (assertion, error) {
+	path, err := jsonpath.Compile(a.Path)
+	if err != nil {
+		return assertion{}, err
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(a.Value), &value); err != nil {
+		return assertion{}, fmt.Errorf("value %s of assertion for %s is not json: %s", a.Value, a.Path, err)
+	}
+
+	tests := a.Tests
+	if len(tests) == 0 {
+		tests = defaultAssertionTests
+	}
+	compiled := assertion{
+		source: fmt.Sprintf("%s == %s", a.Path, a.Value),
+		path:   path,
+		value:  value,
+		tests:  make(map[string]bool, len(tests)),
+	}
+	for _, test := range tests {
+		compiled.tests[test] = true
+	}
+	return compiled, nil
+}
+
+// check returns an error, if no value of the message, that the path selects,
+// is the expected value.
+func (a assertion) check(message interface{}) error {
+	values := a.path.Select(message)
+	for _, v := range values {
+		if reflect.DeepEqual(v, a.value) {
+			return nil
+		}
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("%s selects nothing", a.path)
+	}
+	return fmt.Errorf("%s is %v, expected %v", a.path, values, a.value)
+}
+
+// messageChecks checks each message, that the clients receive. The violations
+// are added as errors to the results of the running test. Messages between the
+// tests are not checked.
+type messageChecks struct {
+	schemas    map[string]*schema.Schema
+	assertions []assertion
+	duplicates bool
+	order      bool
+	propagate  bool
+
+	mu        sync.Mutex
+	collector *result.Collector
+
+	// test is the name of the running test.
+	test string
+
+	// seen are the keys of the elements, each client received in the running
+	// test.
+	seen map[client.Client]map[string]bool
+
+	// lastChange is the highest change id, each client received in the
+	// running test.
+	lastChange map[client.Client]int64
+
+	// propagation is the matrix of the tracked writes of the running test. It
+	// is nil, if the test does not track its writes.
+	propagation *propagation
+
+	// states are the elements, each client knows, for the consistency check.
+	// It is nil, if the check is not configured. Unlike the other fields, it is
+	// kept between the tests.
+	states map[client.Client]map[client.Element]uint64
+}
+
+// newMessageChecks creates the checks of a configuration. Returns nil, if no
+// check is configured.
+func newMessageChecks(cfg *config.Config) (*messageChecks, error) {
+	if cfg.SchemaFile == "" && len(cfg.Assertions) == 0 && !cfg.CheckDuplicates && !cfg.CheckOrder && !cfg.CheckConsistency && !cfg.CheckPropagation {
+		return nil, nil
+	}
+	m := &messageChecks{duplicates: cfg.CheckDuplicates, order: cfg.CheckOrder, propagate: cfg.CheckPropagation}
+	if cfg.CheckConsistency {
+		m.states = make(map[client.Client]map[client.Element]uint64)
+	}
+	if cfg.SchemaFile != "" {
+		schemas, err := schema.Load(cfg.SchemaFile)
+		if err != nil {
+			return nil, err
+		}
+		m.schemas = schemas
+	}
+	for _, a := range cfg.Assertions {
+		compiled, err := newAssertion(a)
+		if err != nil {
+			return nil, err
+		}
+		m.assertions = append(m.assertions, compiled)
+	}
+	return m, nil
+}
+
+// attach sets the checks as inspector of the clients.
+func (m *messageChecks) attach(clients []client.Client) {
+	if m == nil {
+		return
+	}
+	for _, c := range clients {
+		c := c
+		c.SetInspector(func(data []byte) { m.inspect(c, data) })
+	}
+}
+
+// begin starts to collect the violations for a test.
+func (m *messageChecks) begin(env *Env, test string) {
+	if m == nil {
+		return
+	}
+	collector := env.NewCollector()
+	for messageType := range m.schemas {
+		collector.Declare(schemaViolations, result.Labels{"type": messageType})
+	}
+	if m.duplicates {
+		collector.Declare(duplicateMessages, nil)
+	}
+	if m.order {
+		collector.Declare(reorderedMessages, nil)
+	}
+	for _, a := range m.assertions {
+		if a.tests[test] {
+			collector.Declare(failedAssertions, result.Labels{"assertion": a.source})
+		}
+	}
+	m.mu.Lock()
+	m.collector = collector
+	m.test = test
+	m.seen = make(map[client.Client]map[string]bool)
+	m.lastChange = make(map[client.Client]int64)
+	m.mu.Unlock()
+}
+
+// end returns the violations and the propagation matrix since begin.
+func (m *messageChecks) end(env *Env) []*result.TestResult {
+	if m == nil {
+		return nil
+	}
+	propagation := m.propagationResults(env)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.collector == nil {
+		return nil
+	}
+	r := append(m.collector.Results(), propagation...)
+	m.collector = nil
+	m.test = ""
+	m.seen = nil
+	m.lastChange = nil
+	return r
+}
+
+// violation adds a violation of a client to the running test.
+func (m *messageChecks) violation(name string, labels result.Labels, c client.Client, err error) {
+	m.mu.Lock()
+	collector := m.collector
+	m.mu.Unlock()
+	if collector != nil {
+		collector.Observe(name, labels, 0, fmt.Errorf("%s: %s", c, err))
+	}
+}
+
+// inspect checks one message of a client.
+func (m *messageChecks) inspect(c client.Client, data []byte) {
+	if m.propagate {
+		m.findWrites(c, data)
+	}
+
+	var message interface{}
+	if err := json.Unmarshal(data, &message); err != nil {
+		m.violation(schemaViolations, result.Labels{"type": "invalid"}, c, fmt.Errorf("message is not json: %s", err))
+		return
+	}
+
+	m.mu.Lock()
+	test := m.test
+	m.mu.Unlock()
+	for _, a := range m.assertions {
+		if !a.tests[test] {
+			continue
+		}
+		if err := a.check(message); err != nil {
+			m.violation(failedAssertions, result.Labels{"assertion": a.source}, c, err)
+		}
+	}
+
+	elements := messageElements(message)
+	if m.order {
+		m.checkOrder(c, elements)
+	}
+	if m.states != nil {
+		m.updateState(c, elements)
+	}
+
+	for _, element := range elements {
+		if s, ok := m.schemas[element.typ]; ok {
+			for _, err := range s.Validate(element.value) {
+				m.violation(schemaViolations, result.Labels{"type": element.typ}, c, err)
+			}
+		}
+
+		if m.duplicates && m.isDuplicate(c, element) {
+			m.violation(duplicateMessages, nil, c, fmt.Errorf("received %s twice", element.key()))
+		}
+	}
+}
+
+// checkOrder checks, that the change ids of the elements of a message are not
+// lower then the change ids of the earlier messages of the client. The
+// elements of one message can have the same change id.
+func (m *messageChecks) checkOrder(c client.Client, elements []messageElement) {
+	m.mu.Lock()
+	if m.lastChange == nil {
+		// No test is running.
+		m.mu.Unlock()
+		return
+	}
+	last, hasLast := m.lastChange[c]
+	highest := last
+	var reordered []int64
+	for _, element := range elements {
+		object, _ := element.value.(map[string]interface{})
+		changeID, ok := elementChangeID(object)
+		if !ok {
+			continue
+		}
+		if hasLast && changeID < last {
+			reordered = append(reordered, changeID)
+		}
+		if !hasLast || changeID > highest {
+			highest = changeID
+			hasLast = true
+		}
+	}
+	if hasLast {
+		m.lastChange[c] = highest
+	}
+	m.mu.Unlock()
+
+	for _, changeID := range reordered {
+		m.violation(reorderedMessages, nil, c, fmt.Errorf("received change %d after change %d", changeID, last))
+	}
+}
+
+// isDuplicate returns true, if the client received the element before in the
+// running test. Else the element is remembered.
+func (m *messageChecks) isDuplicate(c client.Client, element messageElement) bool {
+	key := element.key()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.seen == nil {
+		// No test is running.
+		return false
+	}
+	if m.seen[c] == nil {
+		m.seen[c] = make(map[string]bool)
+	}
+	if m.seen[c][key] {
+		return true
+	}
+	m.seen[c][key] = true
+	return false
+}
+
+// messageElement is one element of a message with its type.
+type messageElement struct {
+	typ   string
+	value interface{}
+}
+
+// key identifies an element. It is the type, the id and the change id of the
+// element. Without a change id, the hash of the element is used instead.
+func (e messageElement) key() string {
+	object, _ := e.value.(map[string]interface{})
+	id := fmt.Sprint(object["id"])
+	if changeID, ok := elementChangeID(object); ok {
+		return fmt.Sprintf("%s:%s change %d", e.typ, id, changeID)
+	}
+	return fmt.Sprintf("%s:%s hash %d", e.typ, id, hashValue(e.value))
+}
+
+// elementChangeID returns the change id of an element. It is the field
+// "change_id" or "to_change_id" of the element or of its field "content".
+func elementChangeID(object map[string]interface{}) (int64, bool) {
+	for _, o := range []interface{}{object, object["content"]} {
+		o, ok := o.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, field := range []string{"change_id", "to_change_id"} {
+			if v, ok := o[field].(float64); ok {
+				return int64(v), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// messageElements splits a message into its elements. An autoupdate is a list
+// of elements, a different message is one element. The type of an element is
+// its field "collection" or else its field "type".
+func messageElements(message interface{}) []messageElement {
+	values, ok := message.([]interface{})
+	if !ok {
+		values = []interface{}{message}
+	}
+
+	elements := make([]messageElement, len(values))
+	for i, v := range values {
+		elements[i] = messageElement{typ: "unknown", value: v}
+		object, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if typ, ok := object["collection"].(string); ok {
+			elements[i].typ = typ
+		} else if typ, ok := object["type"].(string); ok {
+			elements[i].typ = typ
+		}
+	}
+	return elements
+}
@@ -0,0 +1,74 @@
+package runner
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ostcar/oswstest/client"
+	"github.com/ostcar/oswstest/pool"
+	"github.com/ostcar/oswstest/result"
+)
+
+// leakedGoroutines is the name of the result of the leak check.
+const leakedGoroutines = "Leaked goroutines"
+
+// goroutineCount is the number of running goroutines of the clients and the
+// pools and the number of open connections.
+type goroutineCount struct {
+	readLoops   int
+	expects     int
+	workers     int
+	connections int
+}
+
+// countGoroutines counts the goroutines and the open connections of the
+// clients.
+func countGoroutines(clients []client.Client) goroutineCount {
+	var g goroutineCount
+	g.readLoops, g.expects = client.Running()
+	g.workers = pool.Running()
+	for _, c := range clients {
+		if c.IsConnected() && c.CloseInfo() == nil {
+			g.connections++
+		}
+	}
+	return g
+}
+
+// leaks compares the count after a test with the count before. There should be
+// one more read loop for each new connection and no more calls of ExpectData
+// and workers.
+func (g goroutineCount) leaks(before goroutineCount) []error {
+	var errs []error
+	if n := (g.readLoops - before.readLoops) - (g.connections - before.connections); n > 0 {
+		errs = append(errs, fmt.Errorf("%d read loops are running without an open connection", n))
+	}
+	if n := g.expects - before.expects; n > 0 {
+		errs = append(errs, fmt.Errorf("%d calls of ExpectData or ExpectClose are still running", n))
+	}
+	if n := g.workers - before.workers; n > 0 {
+		errs = append(errs, fmt.Errorf("%d pool workers are still running", n))
+	}
+	return errs
+}
+
+// checkLeaks waits up to LeakCheckWait for the goroutines of a test to end.
+// Returns a result with an error for each kind of goroutine, that is still
+// running, or nil, if there are no leaks.
+func checkLeaks(env *Env, before goroutineCount) []*result.TestResult {
+	deadline := time.Now().Add(env.Config.LeakCheckWait)
+	for {
+		errs := countGoroutines(env.Clients).leaks(before)
+		if len(errs) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			r := result.New(leakedGoroutines)
+			for _, err := range errs {
+				r.AddError(err)
+			}
+			return []*result.TestResult{r}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,173 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ostcar/oswstest/config"
+	"github.com/ostcar/oswstest/result"
+)
+
+// MatrixTest runs a test for each combination of the parameters of a matrix.
+// The results of each run are labeled with its parameters.
+type MatrixTest struct {
+	matrix config.Matrix
+}
+
+// NewMatrixTest creates a MatrixTest.
+func NewMatrixTest(m config.Matrix) *MatrixTest {
+	return &MatrixTest{matrix: m}
+}
+
+// matrixParams are the parameters of one run. A zero value means, that the
+// parameter is not changed.
+type matrixParams struct {
+	clients     int
+	writeRate   float64
+	payloadSize int
+}
+
+// combinations returns all combinations of the parameters.
+func (t *MatrixTest) combinations() []matrixParams {
+	clients := t.matrix.Clients
+	if len(clients) == 0 {
+		clients = []int{0}
+	}
+	rates := t.matrix.WriteRates
+	if len(rates) == 0 {
+		rates = []float64{0}
+	}
+	sizes := t.matrix.PayloadSizes
+	if len(sizes) == 0 {
+		sizes = []int{0}
+	}
+
+	var params []matrixParams
+	for _, c := range clients {
+		for _, r := range rates {
+			for _, s := range sizes {
+				params = append(params, matrixParams{clients: c, writeRate: r, payloadSize: s})
+			}
+		}
+	}
+	return params
+}
+
+// labels returns the labels for the parameters, that are part of the matrix.
+func (t *MatrixTest) labels(p matrixParams) result.Labels {
+	labels := make(result.Labels)
+	if len(t.matrix.Clients) > 0 {
+		labels["clients"] = fmt.Sprint(p.clients)
+	}
+	if len(t.matrix.WriteRates) > 0 {
+		labels["write_rate"] = fmt.Sprint(p.writeRate)
+	}
+	if len(t.matrix.PayloadSizes) > 0 {
+		labels["payload_size"] = fmt.Sprint(p.payloadSize)
+	}
+	return labels
+}
+
+// Name returns the name of the matrix.
+func (t *MatrixTest) Name() string { return t.matrix.Name }
+
+// Description returns the test and the parameters of the matrix.
+func (t *MatrixTest) Description() string {
+	var params []string
+	if len(t.matrix.Clients) > 0 {
+		params = append(params, fmt.Sprintf("clients=%v", t.matrix.Clients))
+	}
+	if len(t.matrix.WriteRates) > 0 {
+		params = append(params, fmt.Sprintf("write_rate=%v", t.matrix.WriteRates))
+	}
+	if len(t.matrix.PayloadSizes) > 0 {
+		params = append(params, fmt.Sprintf("payload_size=%v", t.matrix.PayloadSizes))
+	}
+	return fmt.Sprintf("Runs the test %s for each combination of %s.", t.matrix.Test, strings.Join(params, " "))
+}
+
+// Requirements returns no requirements. The requirements of the test are
+// checked for each run.
+func (t *MatrixTest) Requirements() []Requirement { return nil }
+
+// Setup checks, that the test exists.
+func (t *MatrixTest) Setup(env *Env) error {
+	if _, ok := LookupTest(t.matrix.Test); !ok {
+		return fmt.Errorf("unknown test %s", t.matrix.Test)
+	}
+	return nil
+}
+
+// Provides returns the requirements, that the test of the matrix provides.
+func (t *MatrixTest) Provides() []Requirement {
+	if e, ok := t.effects(); ok {
+		return e.Provides()
+	}
+	return nil
+}
+
+// Breaks returns the requirements, that the test of the matrix breaks.
+func (t *MatrixTest) Breaks() []Requirement {
+	if e, ok := t.effects(); ok {
+		return e.Breaks()
+	}
+	return nil
+}
+
+func (t *MatrixTest) effects() (Effects, bool) {
+	test, ok := LookupTest(t.matrix.Test)
+	if !ok {
+		return nil, false
+	}
+	e, ok := test.(Effects)
+	return e, ok
+}
+
+// Teardown does nothing.
+func (t *MatrixTest) Teardown(env *Env) error { return nil }
+
+// Run runs the test for each combination. A failed run is added as a result
+// and the next combination is run.
+//
+// The clients share the configuration of the environment. Therefore the
+// parameters are set on it for each run and restored afterwards.
+func (t *MatrixTest) Run(ctx context.Context, env *Env) ([]*result.TestResult, error) {
+	test, _ := LookupTest(t.matrix.Test)
+	cfg := env.Config
+	oldRate, oldSize := cfg.WriteRate, cfg.WritePayloadSize
+	defer func() { cfg.WriteRate, cfg.WritePayloadSize = oldRate, oldSize }()
+
+	var results []*result.TestResult
+	for _, p := range t.combinations() {
+		labels := t.labels(p)
+		runEnv := *env
+		if p.clients > 0 {
+			if p.clients > len(env.Clients) {
+				failure := result.New(fmt.Sprintf("Test %s failed", test.Name()))
+				failure.AddError(fmt.Errorf("only %d clients, need %d", len(env.Clients), p.clients))
+				failure.Label(labels)
+				results = append(results, failure)
+				continue
+			}
+			runEnv.Clients = env.Clients[:p.clients]
+		}
+		cfg.WriteRate, cfg.WritePayloadSize = oldRate, oldSize
+		if len(t.matrix.WriteRates) > 0 {
+			cfg.WriteRate = p.writeRate
+		}
+		if len(t.matrix.PayloadSizes) > 0 {
+			cfg.WritePayloadSize = p.payloadSize
+		}
+
+		r := runTest(ctx, &runEnv, test)
+		for _, res := range r {
+			res.Label(labels)
+		}
+		results = append(results, r...)
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
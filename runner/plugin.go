@@ -0,0 +1,173 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"plugin"
+	"strings"
+	"time"
+
+	"github.com/ostcar/oswstest/config"
+	"github.com/ostcar/oswstest/result"
+)
+
+// LoadPlugins loads the go plugins and registers the external tests, the
+// scenarios and the matrices of a configuration.
+//
+// A go plugin is a package main built with -buildmode=plugin, that registers
+// its tests with RegisterTest in an init function. It has to be built against
+// the same version of oswstest.
+//
+// An external test is an executable, that speaks the json protocol described
+// at ExternalTest.
+//
+// A scenario is a json file, that is described at Scenario. A replay is a
+// recording of the command record, see ReplayTest.
+func LoadPlugins(cfg *config.Config) error {
+	for _, path := range cfg.Plugins {
+		if _, err := plugin.Open(path); err != nil {
+			return fmt.Errorf("can not load plugin %s: %s", path, err)
+		}
+	}
+	for _, e := range cfg.ExternalTests {
+		RegisterTest(NewExternalTest(e.Name, e.Command, e.Args...))
+	}
+	for _, path := range cfg.Scenarios {
+		s, err := LoadScenario(path)
+		if err != nil {
+			return err
+		}
+		RegisterTest(s)
+	}
+	for _, path := range cfg.Replays {
+		r, err := LoadReplay(path)
+		if err != nil {
+			return err
+		}
+		RegisterTest(r)
+	}
+	for _, m := range cfg.Matrices {
+		RegisterTest(NewMatrixTest(m))
+	}
+	return nil
+}
+
+// ExternalTest is a test, that runs an external executable.
+//
+// The executable gets one json object on stdin:
+//
+//	{
+//	  "test": "name of the test",
+//	  "base_url": "%s://localhost:8000/%s",
+//	  "clients": [{"name": "admin0", "auth": true, "admin": true, "connected": true}, ...]
+//	}
+//
+// It writes one json object per line to stdout. Each line is a measured value
+// or an error of a result:
+//
+//	{"result": "Time until something happened", "value_ms": 12.5}
+//	{"result": "Time until something happened", "error": "something failed"}
+//
+// The results are shown in the order of there first line. If the executable
+// exits with an error, the test fails. Stderr of the executable is passed
+// through.
+type ExternalTest struct {
+	name    string
+	command string
+	args    []string
+}
+
+// NewExternalTest creates an ExternalTest.
+func NewExternalTest(name, command string, args ...string) *ExternalTest {
+	return &ExternalTest{name: name, command: command, args: args}
+}
+
+type externalRequest struct {
+	Test    string           `json:"test"`
+	BaseURL string           `json:"base_url"`
+	Clients []externalClient `json:"clients"`
+}
+
+type externalClient struct {
+	Name      string `json:"name"`
+	Auth      bool   `json:"auth"`
+	Admin     bool   `json:"admin"`
+	Connected bool   `json:"connected"`
+}
+
+type externalLine struct {
+	Result  string  `json:"result"`
+	ValueMS float64 `json:"value_ms"`
+	Error   string  `json:"error"`
+}
+
+// Name returns the name of the test.
+func (t *ExternalTest) Name() string { return t.name }
+
+// Description returns the command of the test.
+func (t *ExternalTest) Description() string {
+	return fmt.Sprintf("Runs the external command %s.", strings.TrimSpace(t.command+" "+strings.Join(t.args, " ")))
+}
+
+// Requirements returns no requirements. The executable has to check them.
+func (t *ExternalTest) Requirements() []Requirement { return nil }
+
+// Setup does nothing.
+func (t *ExternalTest) Setup(env *Env) error { return nil }
+
+// Teardown does nothing.
+func (t *ExternalTest) Teardown(env *Env) error { return nil }
+
+// Run runs the executable and reads its results.
+func (t *ExternalTest) Run(ctx context.Context, env *Env) ([]*result.TestResult, error) {
+	request := externalRequest{Test: t.name, BaseURL: env.Config.BaseURL}
+	for _, c := range env.Clients {
+		request.Clients = append(request.Clients, externalClient{
+			Name:      c.String(),
+			Auth:      c.IsAuth(),
+			Admin:     c.IsAdmin(),
+			Connected: c.IsConnected(),
+		})
+	}
+	input, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, t.command, t.args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("can not start %s: %s", t.command, err)
+	}
+
+	collector := env.NewCollector()
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		var line externalLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return collector.Results(), fmt.Errorf("invalid line from %s: %s", t.command, err)
+		}
+		if line.Error != "" {
+			collector.Observe(line.Result, nil, 0, fmt.Errorf("%s", line.Error))
+			continue
+		}
+		collector.Observe(line.Result, nil, time.Duration(line.ValueMS*float64(time.Millisecond)), nil)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return collector.Results(), fmt.Errorf("%s failed: %s", t.command, err)
+	}
+	return collector.Results(), scanner.Err()
+}
@@ -0,0 +1,486 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ostcar/oswstest/client"
+	"github.com/ostcar/oswstest/config"
+	"github.com/ostcar/oswstest/pool"
+	"github.com/ostcar/oswstest/result"
+)
+
+// Pools are the worker pools of the logins and logouts, the connects and the
+// write requests. They are shared by all tests of an environment, so they can
+// be resized while a test runs, like by the control api of the live server.
+type Pools struct {
+	Login   *pool.Pool
+	Connect *pool.Pool
+	Send    *pool.Pool
+}
+
+// NewPools creates the pools with the sizes of the configuration.
+func NewPools(cfg *config.Config) *Pools {
+	return &Pools{
+		Login:   pool.New(cfg.ParallelLogins),
+		Connect: pool.New(cfg.ParallelConnections),
+		Send:    pool.New(cfg.ParallelSends),
+	}
+}
+
+// Resize changes the number of workers of the pools. Values lower then one
+// are ignored.
+func (p *Pools) Resize(login, connect, send int) {
+	if p == nil {
+		return
+	}
+	for _, r := range []struct {
+		pool *pool.Pool
+		size int
+	}{{p.Login, login}, {p.Connect, connect}, {p.Send, send}} {
+		if r.size > 0 {
+			r.pool.Resize(r.size)
+		}
+	}
+}
+
+// get returns the pools. If p is nil, it returns new pools with the sizes of
+// the configuration, so an Env without Pools works.
+func (p *Pools) get(cfg *config.Config) *Pools {
+	if p == nil {
+		return NewPools(cfg)
+	}
+	return p
+}
+
+// LoginClients logs in a slice of clients. Uses X workers to work X clients in parallel.
+// Anonymous clients are skipped.
+// Blocks until all clients are logged in or ctx is done. With LogStatus, the
+// progress is logged each second. The first failed login stops the other
+// logins and is returned.
+func LoginClients(ctx context.Context, cfg *config.Config, clients []client.Client) error {
+	return loginClients(ctx, cfg, pool.New(cfg.ParallelLogins), clients)
+}
+
+// loginClients is LoginClients with a pool.
+func loginClients(ctx context.Context, cfg *config.Config, p *pool.Pool, clients []client.Client) error {
+	var authClients []client.AuthClient
+	for _, c := range clients {
+		if c.IsAuth() {
+			authClients = append(authClients, c.(client.AuthClient))
+		}
+	}
+
+	progress := result.NewCollector()
+	loggedIn := progress.Expect("Logged in clients", len(authClients))
+	if cfg.LogStatus {
+		defer logStatus(progress)()
+	}
+
+	// The pool is shared with the logouts, that do not stop at the first
+	// error, so the logins are stopped by canceling there context.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	err := p.Run(ctx, len(authClients), func(ctx context.Context, i int) error {
+		if err := authClients[i].Login(ctx); err != nil {
+			cancel()
+			return fmt.Errorf("can not login client %s: %w", authClients[i], err)
+		}
+		loggedIn(0, nil)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("can not login clients: %w", err)
+	}
+	return nil
+}
+
+// CloseClients closes the connections of all clients at the same time. Blocks
+// until all connections are closed.
+func CloseClients(clients []client.Client) {
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c client.Client) {
+			defer wg.Done()
+			if err := c.Close(); err != nil {
+				log.Printf("Can not close the connection of client %s, %s", c, err)
+			}
+		}(c)
+	}
+	wg.Wait()
+}
+
+// stopClosedClients waits for the read loops of the clients, whose connection
+// was closed since start, and drops there unread messages, so the next test
+// does not get them. The open connections are not changed.
+func stopClosedClients(clients []client.Client, start time.Time) {
+	var closed []client.Client
+	for _, c := range clients {
+		if info := c.CloseInfo(); info != nil && !info.At.Before(start) {
+			closed = append(closed, c)
+		}
+	}
+	CloseClients(closed)
+}
+
+// observeFunc gets the measured duration or the error of one operation.
+type observeFunc func(value time.Duration, err error)
+
+// work is a part of a test, like connecting the clients or listening to
+// them. It blocks until it is done. The errors of single operations are
+// observed. The returned error ends the test, like the error of the context.
+// See runAll.
+type work func(ctx context.Context) error
+
+// unlessDone returns an observeFunc, that drops the errors, that happen after
+// ctx is done. They come from the cancellation and not from the server.
+func unlessDone(ctx context.Context, observe observeFunc) observeFunc {
+	return func(value time.Duration, err error) {
+		if err != nil && ctx.Err() != nil {
+			return
+		}
+		observe(value, err)
+	}
+}
+
+// pacer spaces out the starts of operations, that are done by many workers.
+// It can be used from many goroutines. A nil pacer does not wait.
+type pacer struct {
+	interval time.Duration
+	jitter   time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// newPacer creates a pacer for rate operations per second. Each operation is
+// delayed by an additional random time up to jitter. Returns nil, if there is
+// neither a rate nor a jitter.
+func newPacer(rate float64, jitter time.Duration) *pacer {
+	if rate <= 0 && jitter <= 0 {
+		return nil
+	}
+	p := &pacer{jitter: jitter}
+	if rate > 0 {
+		p.interval = time.Duration(float64(time.Second) / rate)
+	}
+	return p
+}
+
+// wait blocks until the next operation can start. It returns the error of
+// ctx, if ctx is done before.
+func (p *pacer) wait(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	start := p.next
+	p.next = p.next.Add(p.interval)
+	p.mu.Unlock()
+
+	if p.jitter > 0 {
+		start = start.Add(time.Duration(rand.Int63n(int64(p.jitter))))
+	}
+
+	timer := time.NewTimer(time.Until(start))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Connects a slice of clients. Uses X workers to work X clients in parallel.
+// With a ConnectRate or ConnectJitter, the dials are spaced out independent of
+// the number of workers.
+// The time of each connect or its error is observed.
+// The work is done, when all clients are connected.
+func connectClients(cfg *config.Config, p *pool.Pool, clients []client.Client, observe observeFunc) work {
+	return func(ctx context.Context) error {
+		observe := unlessDone(ctx, observe)
+		pace := newPacer(cfg.ConnectRate, cfg.ConnectJitter)
+		return p.Run(ctx, len(clients), func(ctx context.Context, i int) error {
+			if err := pace.wait(ctx); err != nil {
+				return err
+			}
+			start := time.Now()
+			err := clients[i].Connect(ctx)
+			observe(time.Since(start), err)
+			return nil
+		})
+	}
+}
+
+// Send the write request for a slice of AdminClients.
+// The time of each request or its error is observed.
+// The work is done, when all messages where send.
+func sendClients(p *pool.Pool, clients []client.AdminClient, observe observeFunc) work {
+	return func(ctx context.Context) error {
+		observe := unlessDone(ctx, observe)
+		return p.Run(ctx, len(clients), func(ctx context.Context, i int) error {
+			start := time.Now()
+			err := clients[i].Send(ctx)
+			observe(time.Since(start), err)
+			return nil
+		})
+	}
+}
+
+// logoutObservers get the results of logoutClients.
+type logoutObservers struct {
+	loggedOut observeFunc
+	closed    observeFunc
+	loggedIn  observeFunc
+}
+
+// Logout a slice of AuthClients and wait until there connections are closed.
+// Observes the time of each logout request and the time until the connection
+// was closed. If relogin is true, the clients login again after the connection
+// was closed.
+// The work is done, when all clients are done.
+func logoutClients(cfg *config.Config, p *pool.Pool, clients []client.AuthClient, observers logoutObservers, relogin bool) work {
+	return func(ctx context.Context) error {
+		observers := logoutObservers{
+			loggedOut: unlessDone(ctx, observers.loggedOut),
+			closed:    unlessDone(ctx, observers.closed),
+			loggedIn:  unlessDone(ctx, observers.loggedIn),
+		}
+		return p.Run(ctx, len(clients), func(ctx context.Context, i int) error {
+			logoutClient(ctx, cfg, clients[i], observers, relogin)
+			return nil
+		})
+	}
+}
+
+func logoutClient(ctx context.Context, cfg *config.Config, c client.AuthClient, observers logoutObservers, relogin bool) {
+	// Listen to the connection before the logout, so the close is not missed.
+	ready := make(chan bool)
+	closeErr := make(chan error, 1)
+	closeTime := make(chan time.Duration, 1)
+	go func() {
+		d, err := c.ExpectClose(ctx, cfg.LogoutCloseTimeout, ready)
+		if err != nil {
+			closeErr <- err
+			return
+		}
+		closeTime <- d
+	}()
+	<-ready
+
+	start := time.Now()
+	if err := c.Logout(ctx); err != nil {
+		observers.loggedOut(0, err)
+		return
+	}
+	observers.loggedOut(time.Since(start), nil)
+
+	select {
+	case d := <-closeTime:
+		observers.closed(d, nil)
+	case err := <-closeErr:
+		observers.closed(0, err)
+	}
+
+	if relogin {
+		start = time.Now()
+		err := c.Login(ctx)
+		observers.loggedIn(time.Since(start), err)
+	}
+}
+
+// Listens to a list of clients. Observes for each client the duration since
+// connected or the error.
+// The work is done, when each client got count messages or one errors.
+func listenToClients(clients []client.Client, observe observeFunc, count int, since *time.Time, sinceSet chan bool) work {
+	return func(ctx context.Context) error {
+		observe := unlessDone(ctx, observe)
+		var g pool.Group
+		for _, c := range clients {
+			c := c
+			g.Go(func() error {
+				// ExpectData sends at most one value or one error and then the
+				// finish signal. With the buffers it does not block.
+				data := make(chan time.Duration, 1)
+				errChan := make(chan error, 1)
+				finish := make(chan bool, 1)
+				// TODO: Expected data
+				c.ExpectData(ctx, data, errChan, count, finish, 0, since, sinceSet)
+				select {
+				case value := <-data:
+					observe(value, nil)
+				case err := <-errChan:
+					observe(0, err)
+				default:
+				}
+				return nil
+			})
+		}
+		g.Wait()
+		return ctx.Err()
+	}
+}
+
+// Send count write requests with a slice of AdminClients. The clients are used
+// one after another. If rate is greater then zero, only rate requests are
+// started per second. No more requests are started, when ctx is done.
+// The work is done, when all messages where send.
+func pacedSendClients(clients []client.AdminClient, count int, rate float64, observe observeFunc) work {
+	return func(ctx context.Context) error {
+		observe := unlessDone(ctx, observe)
+		var g pool.Group
+		defer g.Wait()
+
+		var pace <-chan time.Time
+		if rate > 0 {
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+			defer ticker.Stop()
+			pace = ticker.C
+		}
+
+		for i := 0; i < count; i++ {
+			if pace != nil && i > 0 {
+				select {
+				case <-pace:
+				case <-ctx.Done():
+				}
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			c := clients[i%len(clients)]
+			g.Go(func() error {
+				start := time.Now()
+				err := c.Send(ctx)
+				observe(time.Since(start), err)
+				return nil
+			})
+		}
+		return nil
+	}
+}
+
+// differentData is the name of the result of checkData.
+const differentData = "Clients with other data then the clients with the same role"
+
+// checkData compares the data, that the clients received last. Clients with
+// the same role (admin, user or anonymous) have to receive the same data. The
+// data, that most clients of a role received, is expected. For each client
+// with other data, an error is added to the collector.
+func checkData(clients []client.Client, collector *result.Collector) {
+	collector.Declare(differentData, nil)
+	observe := collector.Observer(differentData)
+
+	hashes := make(map[string]map[uint64]int)
+	for _, c := range clients {
+		if c.DataHash() == 0 {
+			continue
+		}
+		role := clientRole(c)
+		if hashes[role] == nil {
+			hashes[role] = make(map[uint64]int)
+		}
+		hashes[role][c.DataHash()]++
+	}
+
+	expected := make(map[string]uint64)
+	for role, counts := range hashes {
+		var max int
+		for hash, count := range counts {
+			if count > max {
+				max = count
+				expected[role] = hash
+			}
+		}
+	}
+
+	for _, c := range clients {
+		role := clientRole(c)
+		if hash := c.DataHash(); hash != 0 && hash != expected[role] {
+			observe(0, fmt.Errorf("%s received other data then the other %s clients", c, role))
+		}
+	}
+}
+
+// clientRole returns "admin", "user" or "anonymous".
+func clientRole(c client.Client) string {
+	switch {
+	case c.IsAdmin():
+		return "admin"
+	case c.IsAuth():
+		return "user"
+	}
+	return "anonymous"
+}
+
+// logStatus logs the status of the collector each second, until the returned
+// function is called.
+func logStatus(collector *result.Collector) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		tick := time.NewTicker(time.Second)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				log.Println(collector.Status())
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// runAll runs the work in parallel and blocks until all work is done. The
+// first error of a work cancels the other work and is returned. If ctx is
+// done, its error is returned. With LogStatus, the status of the collector is
+// logged each second. With an ErrorBudget, the work is canceled and the error
+// is returned, as soon as a result of the collector has more errors then the
+// budget.
+func runAll(ctx context.Context, cfg *config.Config, collector *result.Collector, work ...work) error {
+	ctx, abort := context.WithCancel(ctx)
+	defer abort()
+
+	g, groupCtx := pool.WithContext(ctx)
+	for _, w := range work {
+		w := w
+		g.Go(func() error { return w(groupCtx) })
+	}
+	done := make(chan error, 1)
+	go func() { done <- g.Wait() }()
+
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for {
+		select {
+		case err := <-done:
+			if err == nil {
+				err = ctx.Err()
+			}
+			return err
+
+		case <-tick.C:
+			if cfg.LogStatus {
+				log.Println(collector.Status())
+			}
+			if err := collector.CheckErrorBudget(cfg.ErrorBudget); err != nil {
+				log.Printf("Abort the test, %s", err)
+				abort()
+				<-done
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package runner
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+
+	"github.com/ostcar/oswstest/config"
+)
+
+// profileName replaces the characters of a test name, that are not allowed in
+// a file name.
+var profileName = strings.NewReplacer("/", "_", "\\", "_", ":", "_", " ", "_")
+
+// startProfiles starts a cpu profile of the test, if there is a ProfileDir in
+// the configuration. The returned function stops the cpu profile and writes a
+// heap profile. Errors are only logged, so a profile does not let the test
+// fail.
+func startProfiles(cfg *config.Config, test string) (stop func()) {
+	if cfg.ProfileDir == "" {
+		return func() {}
+	}
+	if err := os.MkdirAll(cfg.ProfileDir, 0755); err != nil {
+		log.Printf("Can not create the profile directory, %s", err)
+		return func() {}
+	}
+	base := filepath.Join(cfg.ProfileDir, profileName.Replace(test))
+
+	cpu, err := os.Create(base + "-cpu.pprof")
+	if err != nil {
+		log.Printf("Can not create cpu profile, %s", err)
+	} else if err := pprof.StartCPUProfile(cpu); err != nil {
+		log.Printf("Can not start cpu profile, %s", err)
+		cpu.Close()
+		cpu = nil
+	}
+
+	return func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				log.Printf("Can not write cpu profile, %s", err)
+			}
+		}
+		if err := writeHeapProfile(base + "-heap.pprof"); err != nil {
+			log.Printf("Can not write heap profile, %s", err)
+		}
+	}
+}
+
+// writeHeapProfile writes a heap profile to a file.
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	// Get up-to-date statistics of the allocations.
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("can not write profile: %s", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,178 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ostcar/oswstest/client"
+	"github.com/ostcar/oswstest/result"
+)
+
+const (
+	// markerPrefix starts the marker of each tracked write request.
+	markerPrefix = "oswstest-write-"
+
+	// writeDelivery is the name of the result with the time from each tracked
+	// write request until a client received it.
+	writeDelivery = "Time until a write is delivered to a client"
+
+	// incompleteWrites is the name of the result with the writes, that did
+	// not reach all clients.
+	incompleteWrites = "Writes, that did not reach all clients"
+
+	// maxStragglers is the number of missing clients, that are named for each
+	// incomplete write.
+	maxStragglers = 5
+)
+
+// writeCounter makes the markers unique over all tests.
+var writeCounter int64
+
+// propagation is the matrix of the tracked writes of a test and the clients,
+// that received them.
+type propagation struct {
+	clients []client.Client
+
+	// writes are the markers in the order they were send.
+	writes []string
+	sent   map[string]time.Time
+
+	// received is the time, each client received each write.
+	received map[string]map[client.Client]time.Duration
+}
+
+// markedClient sends each write request with a new marker and adds the marker
+// to the propagation.
+type markedClient struct {
+	client.AdminClient
+	checks *messageChecks
+}
+
+func (c markedClient) Send(ctx context.Context) error {
+	marker := fmt.Sprintf("%s%d", markerPrefix, atomic.AddInt64(&writeCounter, 1))
+	c.checks.addWrite(marker)
+	return c.AdminClient.SendMarked(ctx, marker)
+}
+
+// trackWrites starts a propagation matrix for the clients and returns the
+// admins, so that there write requests are tracked. If CheckPropagation is
+// false, the admins are returned unchanged.
+func (m *messageChecks) trackWrites(clients []client.Client, admins []client.AdminClient) []client.AdminClient {
+	if m == nil || !m.propagate {
+		return admins
+	}
+	m.mu.Lock()
+	m.propagation = &propagation{
+		clients:  clients,
+		sent:     make(map[string]time.Time),
+		received: make(map[string]map[client.Client]time.Duration),
+	}
+	m.mu.Unlock()
+
+	marked := make([]client.AdminClient, len(admins))
+	for i, admin := range admins {
+		marked[i] = markedClient{AdminClient: admin, checks: m}
+	}
+	return marked
+}
+
+// addWrite adds a write request to the propagation matrix.
+func (m *messageChecks) addWrite(marker string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.propagation == nil {
+		return
+	}
+	m.propagation.writes = append(m.propagation.writes, marker)
+	m.propagation.sent[marker] = time.Now()
+	m.propagation.received[marker] = make(map[client.Client]time.Duration)
+}
+
+// findWrites adds the markers in a message to the propagation matrix.
+func (m *messageChecks) findWrites(c client.Client, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := m.propagation
+	if p == nil {
+		return
+	}
+	for _, marker := range findMarkers(data) {
+		sent, ok := p.sent[marker]
+		if !ok {
+			continue
+		}
+		if _, ok := p.received[marker][c]; !ok {
+			p.received[marker][c] = time.Since(sent)
+		}
+	}
+}
+
+// propagationResults returns the results of the propagation matrix and ends
+// it. There is one sample for each delivered write and one error for each
+// write, that did not reach all clients.
+func (m *messageChecks) propagationResults(env *Env) []*result.TestResult {
+	m.mu.Lock()
+	p := m.propagation
+	m.propagation = nil
+	m.mu.Unlock()
+	if p == nil {
+		return nil
+	}
+
+	collector := env.NewCollector()
+	collector.Declare(writeDelivery, nil)
+	collector.Declare(incompleteWrites, nil)
+	for i, marker := range p.writes {
+		var stragglers []string
+		for _, c := range p.clients {
+			d, ok := p.received[marker][c]
+			if !ok {
+				stragglers = append(stragglers, c.String())
+				continue
+			}
+			collector.Observe(writeDelivery, nil, d, nil)
+		}
+		if len(stragglers) == 0 {
+			continue
+		}
+
+		sort.Strings(stragglers)
+		percent := 100 * float64(len(p.clients)-len(stragglers)) / float64(len(p.clients))
+		named := stragglers
+		if len(named) > maxStragglers {
+			named = named[:maxStragglers]
+		}
+		more := ""
+		if len(stragglers) > len(named) {
+			more = fmt.Sprintf(" and %d more", len(stragglers)-len(named))
+		}
+		collector.Observe(incompleteWrites, nil, 0, fmt.Errorf(
+			"write %d reached %.1f%% of the clients, missing: %s%s",
+			i+1, percent, strings.Join(named, ", "), more,
+		))
+	}
+	return collector.Results()
+}
+
+// findMarkers returns the markers of the write requests in a message.
+func findMarkers(data []byte) []string {
+	var markers []string
+	prefix := []byte(markerPrefix)
+	for {
+		i := bytes.Index(data, prefix)
+		if i == -1 {
+			return markers
+		}
+		end := i + len(prefix)
+		for end < len(data) && data[end] >= '0' && data[end] <= '9' {
+			end++
+		}
+		markers = append(markers, string(data[i:end]))
+		data = data[end:]
+	}
+}
@@ -0,0 +1,80 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]Test)
+)
+
+func init() {
+	RegisterTest(ConnectTest)
+	RegisterTest(OneWriteTest)
+	RegisterTest(ManyWriteTest)
+	RegisterTest(LogoutTest)
+}
+
+// RegisterTest makes a test available by its name. It panics, if a test with
+// the same name was already registered or if the test is nil.
+func RegisterTest(t Test) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if t == nil {
+		panic("runner: RegisterTest with nil test")
+	}
+	name := t.Name()
+	if _, ok := registry[name]; ok {
+		panic("runner: RegisterTest called twice for test " + name)
+	}
+	if _, ok := suites[name]; ok {
+		panic("runner: RegisterTest called with the name of the suite " + name)
+	}
+	registry[name] = t
+}
+
+// LookupTest returns the test with the given name.
+func LookupTest(name string) (Test, bool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	t, ok := registry[name]
+	return t, ok
+}
+
+// TestNames returns the sorted names of all registered tests.
+func TestNames() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TestsByName returns the registered tests for a list of names in the same
+// order. The name of a suite is replaced by its tests. It returns an error, if
+// one of the names is not registered.
+func TestsByName(names []string) ([]Test, error) {
+	tests := make([]Test, 0, len(names))
+	for _, name := range names {
+		if suite, ok := lookupSuite(name); ok {
+			suiteTests, err := TestsByName(suite)
+			if err != nil {
+				return nil, fmt.Errorf("suite %s: %s", name, err)
+			}
+			tests = append(tests, suiteTests...)
+			continue
+		}
+		t, ok := LookupTest(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown test %q, registered tests are %v", name, TestNames())
+		}
+		tests = append(tests, t)
+	}
+	return tests, nil
+}
@@ -0,0 +1,171 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ostcar/oswstest/client"
+	"github.com/ostcar/oswstest/record"
+	"github.com/ostcar/oswstest/result"
+)
+
+// ReplayTest replays the requests and websocket messages of a recording, that
+// was written by the command record, with many clients. Each action starts at
+// its recorded time divided by ReplaySpeed, so the actions overlap like in the
+// browser. Each action is done by the first RecordClients clients or all
+// clients at the same time.
+//
+// It measures the time of the actions, grouped by the method and the path
+// without query, and how late the actions started, because the clients were
+// busy.
+//
+// Unlike a recorded scenario, the replay does not connect the clients. If the
+// recording has websocket messages, the clients have to be connected.
+type ReplayTest struct {
+	name      string
+	recording *record.Recording
+	actions   []record.Event
+}
+
+// NewReplayTest creates a replay of a recording.
+func NewReplayTest(name string, r *record.Recording) *ReplayTest {
+	t := &ReplayTest{name: name, recording: r}
+	for _, e := range r.Events {
+		if e.Type == record.EventRequest || e.Type == record.EventSend {
+			t.actions = append(t.actions, e)
+		}
+	}
+	return t
+}
+
+// LoadReplay reads a recording and creates a replay, that is named like the
+// file without the extensions ".recording.json".
+func LoadReplay(path string) (*ReplayTest, error) {
+	r, err := record.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(filepath.Base(path), ".json")
+	name = strings.TrimSuffix(name, ".recording")
+	return NewReplayTest(name, r), nil
+}
+
+// Name returns the name of the replay.
+func (t *ReplayTest) Name() string { return t.name }
+
+// Requirements returns RequireConnected, if the recording has websocket
+// messages.
+func (t *ReplayTest) Requirements() []Requirement {
+	for _, e := range t.actions {
+		if e.Type == record.EventSend {
+			return []Requirement{RequireConnected}
+		}
+	}
+	return nil
+}
+
+// Description returns the number of actions and the recorded server.
+func (t *ReplayTest) Description() string {
+	return fmt.Sprintf("Replays the %d actions of the session recorded against %s. Measures the time of each action and how late it started.", len(t.actions), t.recording.Target)
+}
+
+// Setup does nothing.
+func (t *ReplayTest) Setup(env *Env) error { return nil }
+
+// Teardown does nothing.
+func (t *ReplayTest) Teardown(env *Env) error { return nil }
+
+// replayName returns the name of the result of an action.
+func replayName(e record.Event) string {
+	if e.Type == record.EventSend {
+		return "Time to send a websocket message"
+	}
+	path := e.Path
+	if i := strings.Index(path, "?"); i >= 0 {
+		path = path[:i]
+	}
+	return fmt.Sprintf("Time of request %s %s", e.Method, path)
+}
+
+// Run replays the actions.
+func (t *ReplayTest) Run(ctx context.Context, env *Env) ([]*result.TestResult, error) {
+	cfg := env.Config
+	if len(t.actions) == 0 {
+		return nil, fmt.Errorf("the recording has no requests or websocket messages")
+	}
+
+	clients := env.Clients
+	if cfg.RecordClients > 0 && cfg.RecordClients < len(clients) {
+		clients = clients[:cfg.RecordClients]
+	}
+	var replay []client.ReplayClient
+	for _, c := range clients {
+		if r, ok := c.(client.ReplayClient); ok {
+			replay = append(replay, r)
+		}
+	}
+	if len(replay) == 0 {
+		return nil, fmt.Errorf("no client can replay the recording")
+	}
+	speed := cfg.ReplaySpeed
+	if speed <= 0 {
+		speed = 1
+	}
+
+	collector := env.NewCollector()
+	late := collector.Expect("Time, the actions started after there replayed time", len(t.actions)*len(replay))
+	counts := make(map[string]int)
+	for _, e := range t.actions {
+		counts[replayName(e)] += len(replay)
+	}
+	observers := make(map[string]observeFunc)
+	for _, e := range t.actions {
+		name := replayName(e)
+		if observers[name] == nil {
+			observers[name] = collector.Expect(name, counts[name])
+		}
+	}
+
+	p := env.Pools.get(cfg).Send
+	err := runAll(ctx, cfg, collector, func(ctx context.Context) error {
+		late := unlessDone(ctx, late)
+		start := time.Now()
+		first := t.actions[0].At
+
+		var wg sync.WaitGroup
+		for _, e := range t.actions {
+			at := start.Add(time.Duration(float64(e.At-first) / speed))
+			select {
+			case <-time.After(time.Until(at)):
+			case <-ctx.Done():
+				wg.Wait()
+				return ctx.Err()
+			}
+			e := e
+			observe := unlessDone(ctx, observers[replayName(e)])
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				p.Run(ctx, len(replay), func(ctx context.Context, i int) error {
+					begin := time.Now()
+					late(begin.Sub(at), nil)
+					var err error
+					if e.Type == record.EventSend {
+						err = replay[i].SendMessage(ctx, []byte(e.Message))
+					} else {
+						err = replay[i].Request(ctx, e.Method, e.Path, []byte(e.Body))
+					}
+					observe(time.Since(begin), err)
+					return nil
+				})
+			}()
+		}
+		wg.Wait()
+		return nil
+	})
+	return collector.Results(), err
+}
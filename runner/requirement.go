@@ -0,0 +1,87 @@
+package runner
+
+import (
+	"fmt"
+
+	"github.com/ostcar/oswstest/client"
+)
+
+// Requirement is a precondition of a test.
+type Requirement int
+
+const (
+	// RequireConnected requires, that all clients have open connections.
+	RequireConnected Requirement = iota + 1
+
+	// RequireAdmin requires, that at least one client is a connected admin
+	// client.
+	RequireAdmin
+
+	// RequireFirstAdmin requires, that the first client is a connected admin
+	// client.
+	RequireFirstAdmin
+
+	// RequireAuth requires, that at least one client is a connected, logged-in
+	// client.
+	RequireAuth
+)
+
+// String returns a description of the requirement.
+func (r Requirement) String() string {
+	switch r {
+	case RequireConnected:
+		return "all clients are connected"
+	case RequireAdmin:
+		return "at least one connected admin client"
+	case RequireFirstAdmin:
+		return "the first client is a connected admin client"
+	case RequireAuth:
+		return "at least one connected logged-in client"
+	}
+	return fmt.Sprintf("unknown requirement %d", int(r))
+}
+
+// Check returns an error, if the requirement is not met by the clients.
+func (r Requirement) Check(clients []client.Client) error {
+	return r.check(clients, client.Client.IsConnected)
+}
+
+// check is like Check, but uses connected to find out if a client is
+// connected. So the requirements can be checked for a state, the clients will
+// have later.
+func (r Requirement) check(clients []client.Client, connected func(client.Client) bool) error {
+	switch r {
+	case RequireConnected:
+		for _, c := range clients {
+			if !connected(c) {
+				return fmt.Errorf("requirement not met: %s, client %s is not connected", r, c)
+			}
+		}
+		return nil
+
+	case RequireAdmin:
+		for _, c := range clients {
+			if _, ok := c.(client.AdminClient); ok && c.IsAdmin() && connected(c) {
+				return nil
+			}
+		}
+
+	case RequireFirstAdmin:
+		if len(clients) > 0 {
+			if _, ok := clients[0].(client.AdminClient); ok && clients[0].IsAdmin() && connected(clients[0]) {
+				return nil
+			}
+		}
+
+	case RequireAuth:
+		for _, c := range clients {
+			if _, ok := c.(client.AuthClient); ok && c.IsAuth() && connected(c) {
+				return nil
+			}
+		}
+
+	default:
+		return fmt.Errorf("unknown requirement %d", int(r))
+	}
+	return fmt.Errorf("requirement not met: %s", r)
+}
@@ -0,0 +1,113 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/ostcar/oswstest/result"
+)
+
+// Runner runs tests in the background like RunTests. A program, that embeds
+// the tests, or the control api of the live server can stop the run and
+// still gets the results, that were collected so far. Like after an
+// interrupt, the running test ends with its results and no more tests are
+// started.
+//
+// A Runner can only be started once.
+type Runner struct {
+	env   *Env
+	tests []Test
+	sinks []result.Sink
+
+	mu      sync.Mutex
+	started bool
+	stopped bool
+	cancel  context.CancelFunc
+	results []*result.TestResult
+	done    chan struct{}
+}
+
+// NewRunner creates a runner for the tests. The results are published to the
+// sinks like by RunTests.
+func NewRunner(env *Env, tests []Test, sinks []result.Sink) *Runner {
+	return &Runner{env: env, tests: tests, sinks: sinks, done: make(chan struct{})}
+}
+
+// Env returns the environment of the runner.
+func (r *Runner) Env() *Env {
+	return r.env
+}
+
+// Start starts the tests and returns at once. The run ends, when all tests
+// are done, when ctx is done or when Stop is called.
+func (r *Runner) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.started {
+		return errors.New("the runner was already started")
+	}
+	r.started = true
+	ctx, r.cancel = context.WithCancel(ctx)
+
+	sinks := append([]result.Sink{(*runnerSink)(r)}, r.sinks...)
+	go func() {
+		defer close(r.done)
+		defer r.cancel()
+		RunTests(ctx, r.env, r.tests, sinks)
+	}()
+	return nil
+}
+
+// Stop cancels the run and waits, until it has ended. It returns the results
+// of all tests, that were published. If the runner was not started, it
+// returns nil at once.
+func (r *Runner) Stop() []*result.TestResult {
+	r.mu.Lock()
+	if !r.started {
+		r.mu.Unlock()
+		return nil
+	}
+	r.stopped = true
+	r.cancel()
+	r.mu.Unlock()
+	return r.Wait()
+}
+
+// Wait blocks, until the run has ended, and returns its results.
+func (r *Runner) Wait() []*result.TestResult {
+	<-r.done
+	return r.Results()
+}
+
+// Done returns a channel, that is closed, when the run has ended.
+func (r *Runner) Done() <-chan struct{} {
+	return r.done
+}
+
+// Stopped returns true, if Stop was called. Then the results are
+// incomplete.
+func (r *Runner) Stopped() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stopped
+}
+
+// Results returns the results of the tests, that were published so far.
+func (r *Runner) Results() []*result.TestResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*result.TestResult(nil), r.results...)
+}
+
+// runnerSink is the sink of a runner, that keeps the results.
+type runnerSink Runner
+
+func (s *runnerSink) Publish(test string, results []*result.TestResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = append(s.results, results...)
+	return nil
+}
+
+func (s *runnerSink) Close() error { return nil }
@@ -0,0 +1,415 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/ostcar/oswstest/client"
+	"github.com/ostcar/oswstest/record"
+	"github.com/ostcar/oswstest/result"
+)
+
+// Scenario is a test, that is described in a json file. It runs its steps one
+// after another.
+//
+// A scenario looks like this:
+//
+//	{
+//	  "name": "slowwrite",
+//	  "description": "Writes slowly and checks the latency.",
+//	  "steps": [
+//	    {"action": "test", "test": "connect", "clients": 100},
+//	    {"action": "wait", "duration": "2s"},
+//	    {"action": "write", "count": 20, "rate": 5},
+//	    {"action": "assert", "result": "Time until the data of 20 write requests has been received", "stat": "max", "below": "500ms"}
+//	  ]
+//	}
+//
+// The actions are:
+//
+// "test" runs a registered test. With "clients" only the first clients are
+// used, else all clients. The built-in tests are the scenarios with only one
+// test step.
+//
+// "wait" waits for "duration".
+//
+// "write" sends "count" write requests with the connected admin clients. With
+// "rate", only that many requests are send per second. Without "rate", the
+// WriteRate of the configuration is used. It measures the time of
+// the requests and until all connected clients got all data.
+//
+// "request" sends a request with "method", "path" (without leading slash) and
+// "body" with the first "clients" clients or all clients at the same time. It
+// measures the time of the requests.
+//
+// "send" sends the websocket message "message" with the first "clients"
+// clients or all clients, that are connected via websocket.
+//
+// The command "record" writes a scenario with these steps from the actions of
+// a browser.
+//
+// "assert" checks, that the "stat" ("min", "max" or "ave", default "ave") of
+// a result of an earlier step is below the duration "below", and that the
+// result has not more then "max_errors" errors. A failed assertion is added as
+// error to the result "Assertions of <name>".
+type Scenario struct {
+	ScenarioName        string         `json:"name"`
+	ScenarioDescription string         `json:"description"`
+	Steps               []ScenarioStep `json:"steps"`
+}
+
+// ScenarioStep is one step of a scenario. See Scenario for the meaning of the
+// fields.
+type ScenarioStep struct {
+	Action    string           `json:"action"`
+	Test      string           `json:"test,omitempty"`
+	Clients   int              `json:"clients,omitempty"`
+	Duration  scenarioDuration `json:"duration,omitempty"`
+	Count     int              `json:"count,omitempty"`
+	Rate      float64          `json:"rate,omitempty"`
+	Result    string           `json:"result,omitempty"`
+	Stat      string           `json:"stat,omitempty"`
+	Below     scenarioDuration `json:"below,omitempty"`
+	MaxErrors int              `json:"max_errors,omitempty"`
+	Method    string           `json:"method,omitempty"`
+	Path      string           `json:"path,omitempty"`
+	Body      string           `json:"body,omitempty"`
+	Message   string           `json:"message,omitempty"`
+}
+
+// scenarioDuration is a time.Duration, that is written as string like "1.5s"
+// in json.
+type scenarioDuration time.Duration
+
+func (d *scenarioDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration has to be a string like \"1s\": %s", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = scenarioDuration(v)
+	return nil
+}
+
+func (d scenarioDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// ScenarioFromRecording converts a recorded browser session into a scenario,
+// that replays it with the first clients or all clients, if clients is zero.
+// The first websocket connection becomes the test "connect", the requests and
+// the websocket messages of the browser become the steps "request" and "send"
+// with "wait" steps for the time between them.
+func ScenarioFromRecording(r *record.Recording, name string, clients int) *Scenario {
+	s := &Scenario{
+		ScenarioName:        name,
+		ScenarioDescription: fmt.Sprintf("Replays the session recorded at %s against %s.", r.Started.Format(time.RFC3339), r.Target),
+	}
+
+	var last time.Duration
+	var connected bool
+	for _, e := range r.Events {
+		var step ScenarioStep
+		switch e.Type {
+		case record.EventConnect:
+			if connected {
+				continue
+			}
+			connected = true
+			step = ScenarioStep{Action: "test", Test: "connect"}
+		case record.EventRequest:
+			step = ScenarioStep{Action: "request", Method: e.Method, Path: e.Path, Body: e.Body}
+		case record.EventSend:
+			step = ScenarioStep{Action: "send", Message: e.Message}
+		default:
+			continue
+		}
+		step.Clients = clients
+
+		if wait := (e.At - last).Round(time.Millisecond); wait > 0 {
+			s.Steps = append(s.Steps, ScenarioStep{Action: "wait", Duration: scenarioDuration(wait)})
+		}
+		last = e.At
+		s.Steps = append(s.Steps, step)
+	}
+	return s
+}
+
+// Write writes the scenario to a json file, so it can be loaded with
+// LoadScenario.
+func (s *Scenario) Write(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// LoadScenario reads a scenario from a json file and checks its steps.
+func LoadScenario(path string) (*Scenario, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := new(Scenario)
+	if err := json.NewDecoder(f).Decode(s); err != nil {
+		return nil, fmt.Errorf("can not decode scenario %s: %s", path, err)
+	}
+	if s.ScenarioName == "" {
+		return nil, fmt.Errorf("scenario %s has no name", path)
+	}
+	for i, step := range s.Steps {
+		switch step.Action {
+		case "test":
+			if step.Test == "" {
+				return nil, fmt.Errorf("step %d of scenario %s has no test", i+1, s.ScenarioName)
+			}
+		case "wait", "write":
+		case "request":
+			if step.Method == "" || step.Path == "" {
+				return nil, fmt.Errorf("step %d of scenario %s needs a method and a path", i+1, s.ScenarioName)
+			}
+		case "send":
+			if step.Message == "" {
+				return nil, fmt.Errorf("step %d of scenario %s has no message", i+1, s.ScenarioName)
+			}
+		case "assert":
+			switch step.Stat {
+			case "", "min", "max", "ave":
+			default:
+				return nil, fmt.Errorf("step %d of scenario %s has unknown stat %s", i+1, s.ScenarioName, step.Stat)
+			}
+		default:
+			return nil, fmt.Errorf("step %d of scenario %s has unknown action %s", i+1, s.ScenarioName, step.Action)
+		}
+	}
+	return s, nil
+}
+
+// Name returns the name of the scenario.
+func (s *Scenario) Name() string { return s.ScenarioName }
+
+// Requirements returns no requirements. The requirements of the tests in the
+// steps are checked, when the steps are run.
+func (s *Scenario) Requirements() []Requirement { return nil }
+
+// Description returns the description of the scenario file or the number of
+// its steps.
+func (s *Scenario) Description() string {
+	if s.ScenarioDescription != "" {
+		return s.ScenarioDescription
+	}
+	return fmt.Sprintf("Scenario with %d steps.", len(s.Steps))
+}
+
+// Setup does nothing.
+func (s *Scenario) Setup(env *Env) error { return nil }
+
+// Teardown does nothing.
+func (s *Scenario) Teardown(env *Env) error { return nil }
+
+// Run runs all steps of the scenario. It stops at the first step that fails.
+func (s *Scenario) Run(ctx context.Context, env *Env) ([]*result.TestResult, error) {
+	var results []*result.TestResult
+	assertions := result.New(fmt.Sprintf("Assertions of %s", s.ScenarioName))
+
+	for i, step := range s.Steps {
+		var r []*result.TestResult
+		var err error
+
+		switch step.Action {
+		case "test":
+			r, err = runScenarioTest(ctx, env, step)
+
+		case "wait":
+			select {
+			case <-time.After(time.Duration(step.Duration)):
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+
+		case "write":
+			r, err = runScenarioWrite(ctx, env, step)
+
+		case "request", "send":
+			r, err = runScenarioReplay(ctx, env, step)
+
+		case "assert":
+			if aErr := scenarioAssert(results, step); aErr != nil {
+				assertions.AddError(aErr)
+			} else {
+				assertions.Add(0)
+			}
+		}
+
+		results = append(results, r...)
+		if err != nil {
+			if assertions.CountBoth() > 0 {
+				results = append(results, assertions)
+			}
+			return results, fmt.Errorf("step %d (%s): %s", i+1, step.Action, err)
+		}
+	}
+
+	if assertions.CountBoth() > 0 {
+		results = append(results, assertions)
+	}
+	return results, nil
+}
+
+// runScenarioTest runs a registered test for the first clients.
+func runScenarioTest(ctx context.Context, env *Env, step ScenarioStep) ([]*result.TestResult, error) {
+	test, ok := LookupTest(step.Test)
+	if !ok {
+		return nil, fmt.Errorf("unknown test %s", step.Test)
+	}
+
+	stepEnv := *env
+	if step.Clients > 0 && step.Clients < len(env.Clients) {
+		stepEnv.Clients = env.Clients[:step.Clients]
+	}
+
+	for _, requirement := range test.Requirements() {
+		if err := requirement.Check(stepEnv.Clients); err != nil {
+			return nil, err
+		}
+	}
+	if err := test.Setup(&stepEnv); err != nil {
+		return nil, err
+	}
+	r, err := test.Run(ctx, &stepEnv)
+	if tErr := test.Teardown(&stepEnv); err == nil {
+		err = tErr
+	}
+	return r, err
+}
+
+// runScenarioWrite sends step.Count write requests with the connected admin
+// clients and waits until all connected clients got the data.
+func runScenarioWrite(ctx context.Context, env *Env, step ScenarioStep) ([]*result.TestResult, error) {
+	cfg := env.Config
+
+	var admins []client.AdminClient
+	var connected []client.Client
+	for _, c := range env.Clients {
+		if !c.IsConnected() {
+			continue
+		}
+		connected = append(connected, c)
+		if admin, ok := c.(client.AdminClient); ok && admin.IsAdmin() {
+			admins = append(admins, admin)
+		}
+	}
+	if len(admins) == 0 {
+		return nil, fmt.Errorf("no connected admin client")
+	}
+	if step.Count < 1 {
+		step.Count = 1
+	}
+
+	collector := env.NewCollector()
+	sended := collector.Expect(fmt.Sprintf("Time of %d write requests", step.Count), step.Count)
+	received := collector.Expect(fmt.Sprintf("Time until the data of %d write requests has been received", step.Count), len(connected))
+
+	rate := step.Rate
+	if rate == 0 {
+		rate = cfg.WriteRate
+	}
+	err := runAll(ctx, cfg, collector,
+		pacedSendClients(admins, step.Count, rate, sended),
+		listenToClients(connected, received, step.Count, nil, nil),
+	)
+	return collector.Results(), err
+}
+
+// runScenarioReplay sends the request or the websocket message of a step with
+// the first step.Clients clients.
+func runScenarioReplay(ctx context.Context, env *Env, step ScenarioStep) ([]*result.TestResult, error) {
+	clients := env.Clients
+	if step.Clients > 0 && step.Clients < len(clients) {
+		clients = clients[:step.Clients]
+	}
+	var replay []client.ReplayClient
+	for _, c := range clients {
+		if r, ok := c.(client.ReplayClient); ok && (step.Action == "request" || c.IsConnected()) {
+			replay = append(replay, r)
+		}
+	}
+	if len(replay) == 0 {
+		return nil, fmt.Errorf("no client can replay the step")
+	}
+
+	name := fmt.Sprintf("Time of request %s %s", step.Method, step.Path)
+	if step.Action == "send" {
+		name = "Time to send a websocket message"
+	}
+	collector := env.NewCollector()
+	observe := collector.Expect(name, len(replay))
+	p := env.Pools.get(env.Config).Send
+	err := runAll(ctx, env.Config, collector, func(ctx context.Context) error {
+		observe := unlessDone(ctx, observe)
+		return p.Run(ctx, len(replay), func(ctx context.Context, i int) error {
+			start := time.Now()
+			var err error
+			if step.Action == "send" {
+				err = replay[i].SendMessage(ctx, []byte(step.Message))
+			} else {
+				err = replay[i].Request(ctx, step.Method, step.Path, []byte(step.Body))
+			}
+			observe(time.Since(start), err)
+			return nil
+		})
+	})
+	return collector.Results(), err
+}
+
+// scenarioAssert checks an assert step against the results of the earlier
+// steps.
+func scenarioAssert(results []*result.TestResult, step ScenarioStep) error {
+	var r *result.TestResult
+	for _, candidate := range results {
+		if candidate.Description() == step.Result {
+			r = candidate
+		}
+	}
+	if r == nil {
+		return fmt.Errorf("no result %q", step.Result)
+	}
+
+	if r.ErrCount() > step.MaxErrors {
+		return fmt.Errorf("%q has %d errors, allowed are %d", step.Result, r.ErrCount(), step.MaxErrors)
+	}
+	if step.Below == 0 {
+		return nil
+	}
+
+	var value time.Duration
+	switch step.Stat {
+	case "min":
+		value = r.Min()
+	case "max":
+		value = r.Max()
+	default:
+		value = r.Ave()
+	}
+	if value >= time.Duration(step.Below) {
+		return fmt.Errorf("%s of %q is %s, expected below %s", statName(step.Stat), step.Result, value, time.Duration(step.Below))
+	}
+	return nil
+}
+
+func statName(stat string) string {
+	if stat == "" {
+		return "ave"
+	}
+	return stat
+}
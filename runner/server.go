@@ -0,0 +1,85 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/ostcar/oswstest/client"
+	"github.com/ostcar/oswstest/config"
+)
+
+// Server is the data on the server, that is prepared once for a distributed
+// run: the fixture, the users of all clients and the test data. The agents
+// only create and login there clients.
+type Server struct {
+	cfg   *config.Config
+	state *client.ServerState
+}
+
+// PrepareServer imports the FixtureFile, creates the users of all shards, if
+// CreateUsers is true, and prepares the test data with client.Prepare. It can
+// change WriteItemID, so the configurations of the agents have to be copied
+// afterwards. If it fails, the prepared test data is restored.
+func PrepareServer(ctx context.Context, cfg *config.Config) (*Server, error) {
+	if err := importFixture(ctx, cfg); err != nil {
+		return nil, err
+	}
+	if cfg.CreateUsers {
+		credentials, err := client.Credentials(cfg)
+		if err != nil {
+			return nil, err
+		}
+		created, err := client.CreateUsers(ctx, cfg, credentials)
+		if err != nil {
+			return nil, fmt.Errorf("can not create the users: %s", err)
+		}
+		log.Printf("Created %d of %d users.", created, len(credentials))
+	}
+	state, err := client.Prepare(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("can not prepare the test data: %s", err)
+	}
+	return &Server{cfg: cfg, state: state}, nil
+}
+
+// Restore sets the data on the server back like Env.Restore, but cleans up
+// the users of all shards.
+func (s *Server) Restore(ctx context.Context) error {
+	if err := s.state.Restore(ctx); err != nil {
+		return err
+	}
+	if s.cfg.CleanupUsers == "" {
+		return nil
+	}
+	credentials, err := client.Credentials(s.cfg)
+	if err != nil {
+		return err
+	}
+	usernames := make([]string, len(credentials))
+	for i, c := range credentials {
+		usernames[i] = c.Username
+	}
+	changed, err := client.CleanupUsers(ctx, s.cfg, usernames)
+	if err != nil {
+		return fmt.Errorf("can not cleanup users: %s", err)
+	}
+	log.Printf("Cleaned up %d users (%s).", changed, s.cfg.CleanupUsers)
+	return nil
+}
+
+// importFixture sets the server back to the FixtureFile, if it is set.
+func importFixture(ctx context.Context, cfg *config.Config) error {
+	if cfg.FixtureFile == "" {
+		return nil
+	}
+	fixture, err := client.LoadFixture(cfg.FixtureFile)
+	if err != nil {
+		return fmt.Errorf("can not load the fixture: %s", err)
+	}
+	if err := client.ImportFixture(ctx, cfg, fixture); err != nil {
+		return fmt.Errorf("can not import the fixture: %s", err)
+	}
+	log.Printf("Imported the fixture %s.", cfg.FixtureFile)
+	return nil
+}
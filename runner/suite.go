@@ -0,0 +1,162 @@
+package runner
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/ostcar/oswstest/client"
+)
+
+// Effects is implemented by tests, that change the state of the clients. It
+// is used by PlanTests to find out, which requirements are met before each
+// test.
+type Effects interface {
+	// Provides returns the requirements, that are met after the test.
+	Provides() []Requirement
+
+	// Breaks returns the requirements, that are not met after the test.
+	Breaks() []Requirement
+}
+
+// effectTest is a Test with Effects.
+type effectTest struct {
+	Test
+	provides []Requirement
+	breaks   []Requirement
+}
+
+func (t *effectTest) Provides() []Requirement { return t.provides }
+func (t *effectTest) Breaks() []Requirement   { return t.breaks }
+
+// WithEffects returns the test with effects. Only RequireConnected is
+// tracked. The other requirements follow from the clients.
+func WithEffects(t Test, provides, breaks []Requirement) Test {
+	return &effectTest{Test: t, provides: provides, breaks: breaks}
+}
+
+var (
+	// setupTests are the names of the tests, that meet a requirement.
+	setupTests = map[Requirement]string{
+		RequireConnected: "connect",
+	}
+
+	// suites are named lists of tests.
+	suites = map[string][]string{
+		"default": {"connect", "onewrite", "manywrite"},
+		"all":     {"connect", "onewrite", "manywrite", "logout"},
+	}
+)
+
+// RegisterSetupTest sets the test, that PlanTests inserts, when a requirement
+// is not met.
+func RegisterSetupTest(r Requirement, name string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	setupTests[r] = name
+}
+
+// RegisterSuite makes a list of tests available by a name. TestsByName
+// expands the name of a suite to its tests. It panics, if the suite or a test
+// with the same name was already registered.
+func RegisterSuite(name string, tests ...string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := suites[name]; ok {
+		panic("runner: RegisterSuite called twice for suite " + name)
+	}
+	if _, ok := registry[name]; ok {
+		panic("runner: RegisterSuite called with the name of the test " + name)
+	}
+	suites[name] = tests
+}
+
+// lookupSuite returns the tests of a suite.
+func lookupSuite(name string) ([]string, bool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	tests, ok := suites[name]
+	return tests, ok
+}
+
+// PlanTests checks the requirements of a list of tests before they are run.
+// It follows the connection state of the clients through the tests by there
+// Effects.
+//
+// A test, that only connects the clients, is skipped, if they are already
+// connected, for example by the warm-up.
+//
+// If a requirement is not met and autoSetup is true, the setup test of the
+// requirement is inserted before the test. Else, or if the requirement is
+// still not met, an error is returned.
+func PlanTests(clients []client.Client, tests []Test, autoSetup bool) ([]Test, error) {
+	connected := false
+	if RequireConnected.Check(clients) == nil {
+		connected = true
+	}
+	isConnected := func(c client.Client) bool { return connected }
+
+	var planned []Test
+	for _, test := range tests {
+		if connected && onlyConnects(test) {
+			log.Printf("Skip test %s, the clients are already connected", test.Name())
+			continue
+		}
+
+		for _, r := range test.Requirements() {
+			if r.check(clients, isConnected) == nil {
+				continue
+			}
+
+			registryMu.Lock()
+			setupName, ok := setupTests[r]
+			if !ok {
+				setupName, ok = setupTests[RequireConnected]
+			}
+			registryMu.Unlock()
+			setup, found := LookupTest(setupName)
+			if !autoSetup || !ok || !found {
+				return nil, fmt.Errorf("test %s requires, that %s", test.Name(), r)
+			}
+
+			log.Printf("Insert test %s before %s, so that %s", setupName, test.Name(), r)
+			planned = append(planned, setup)
+			connected = applyEffects(setup, connected)
+			if err := r.check(clients, isConnected); err != nil {
+				return nil, fmt.Errorf("test %s: %s", test.Name(), err)
+			}
+		}
+		planned = append(planned, test)
+		connected = applyEffects(test, connected)
+	}
+	return planned, nil
+}
+
+// onlyConnects returns true, if the test has no requirements and only
+// provides RequireConnected.
+func onlyConnects(test Test) bool {
+	e, ok := test.(Effects)
+	if !ok || len(test.Requirements()) > 0 || len(e.Breaks()) > 0 {
+		return false
+	}
+	provides := e.Provides()
+	return len(provides) == 1 && provides[0] == RequireConnected
+}
+
+// applyEffects returns the connection state after a test.
+func applyEffects(test Test, connected bool) bool {
+	e, ok := test.(Effects)
+	if !ok {
+		return connected
+	}
+	for _, r := range e.Provides() {
+		if r == RequireConnected {
+			connected = true
+		}
+	}
+	for _, r := range e.Breaks() {
+		if r == RequireConnected {
+			connected = false
+		}
+	}
+	return connected
+}
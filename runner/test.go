@@ -0,0 +1,579 @@
+// Package runner runs the tests against a slice of clients.
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ostcar/oswstest/client"
+	"github.com/ostcar/oswstest/config"
+	"github.com/ostcar/oswstest/result"
+	"github.com/ostcar/oswstest/tracing"
+)
+
+// Env is the environment, the tests run in.
+type Env struct {
+	Config  *config.Config
+	Clients []client.Client
+
+	// Hooks are called around the tests. They can be nil.
+	Hooks *Hooks
+
+	// OnSample is called for each sample of the tests, if it is not nil. See
+	// result.Collector.
+	OnSample func(name string, labels result.Labels, value time.Duration, err error)
+
+	// checks checks the received messages. It can be nil.
+	checks *messageChecks
+
+	// statuses collects the http status codes of the clients.
+	statuses *httpStatuses
+
+	// Pools are the worker pools of the tests. If it is nil, each test uses
+	// new pools with the sizes of the configuration.
+	Pools *Pools
+
+	// state is the state of the server before the run. See Restore.
+	state *client.ServerState
+
+	// loginResults are the http status codes of the login. They are published
+	// by the first call of RunTests.
+	loginResults []*result.TestResult
+}
+
+// Restore sets the data on the server back to the state before the run and
+// deletes the created data, if RestoreState is true. If CleanupUsers is set,
+// the users of the clients are deleted or deactivated. It should be called
+// after the last run of the environment.
+func (e *Env) Restore(ctx context.Context) error {
+	if err := e.state.Restore(ctx); err != nil {
+		return err
+	}
+	if e.Config.CleanupUsers == "" {
+		return nil
+	}
+
+	var usernames []string
+	for _, c := range e.Clients {
+		if c.IsAuth() {
+			usernames = append(usernames, c.Username())
+		}
+	}
+	changed, err := client.CleanupUsers(ctx, e.Config, usernames)
+	if err != nil {
+		return fmt.Errorf("can not cleanup users: %s", err)
+	}
+	log.Printf("Cleaned up %d users (%s).", changed, e.Config.CleanupUsers)
+	return nil
+}
+
+// NewCollector returns a collector for the samples of a test.
+func (e *Env) NewCollector() *result.Collector {
+	c := result.NewCollector()
+	c.OnSample = e.OnSample
+	c.Streaming = e.Config.StreamingStats
+	return c
+}
+
+// restoreTimeout is the time to restore the state of the server, if NewEnv
+// fails.
+const restoreTimeout = time.Minute
+
+// NewEnv creates the clients of a configuration with a factory and logs them
+// in. If ReuseSessions is true, only the clients without a valid cached
+// session have to login. If Seed is true, the agenda item of the write
+// requests is created before. With DataVolume, topics are created, until the
+// server has DataVolume topics. If RestoreState is true, its data is
+// remembered for Restore. If FixtureFile is set, the server is set back to the
+// fixture first. If factory is nil, the default factory is used.
+// If the clients can not be created or logged in, the state of the server is
+// restored before the error is returned.
+// The context cancels the creation and the login of the clients.
+func NewEnv(ctx context.Context, cfg *config.Config, factory client.ClientFactory) (env *Env, err error) {
+	if factory == nil {
+		factory = client.NewFactory(cfg)
+	}
+	if err := client.CheckPayloadTemplate(cfg); err != nil {
+		return nil, err
+	}
+	if err := importFixture(ctx, cfg); err != nil {
+		return nil, err
+	}
+	state, err := client.Prepare(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("can not prepare the test data: %s", err)
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		// Without an Env, the caller can not call Restore. The context is
+		// not ctx, because it can be canceled by an interrupt.
+		restoreCtx, cancel := context.WithTimeout(context.Background(), restoreTimeout)
+		defer cancel()
+		if rErr := state.Restore(restoreCtx); rErr != nil {
+			log.Printf("Can not restore the state of the server, %s", rErr)
+		}
+	}()
+	clients, err := client.FromFactory(ctx, cfg, factory)
+	if err != nil {
+		return nil, fmt.Errorf("can not create clients: %s", err)
+	}
+	// The workers are also needed without output, else the pools have no
+	// workers.
+	workers := cfg.DeriveWorkers(len(clients))
+	if !cfg.Quiet {
+		log.Printf("Use %d clients", len(clients))
+		if workers != "" {
+			log.Print(workers)
+		}
+	}
+	if err := checkFileLimit(cfg, len(clients)); err != nil {
+		return nil, err
+	}
+
+	checks, err := newMessageChecks(cfg)
+	if err != nil {
+		return nil, err
+	}
+	checks.attach(clients)
+	statuses := new(httpStatuses)
+	statuses.attach(clients)
+	statuses.begin(result.NewCollector())
+
+	toLogin := clients
+	if cfg.ReuseSessions {
+		toLogin = client.ReuseSessions(ctx, cfg, clients)
+		log.Printf("Reuse the sessions of %d clients.", len(clients)-len(toLogin))
+	}
+	pools := NewPools(cfg)
+	if err := loginClients(ctx, cfg, pools.Login, toLogin); err != nil {
+		return nil, err
+	}
+	log.Println("All Clients have logged in.")
+	if err := client.SaveSessions(cfg, clients); err != nil {
+		log.Printf("Can not save sessions, %s", err)
+	}
+	return &Env{Config: cfg, Clients: clients, Pools: pools, state: state, checks: checks, statuses: statuses, loginResults: statuses.end()}, nil
+}
+
+// Test is a test, that runs against the clients of an environment.
+type Test interface {
+	// Name returns the name, the test is registered with.
+	Name() string
+
+	// Requirements returns the preconditions of the test. The runner checks
+	// them before Setup is called.
+	Requirements() []Requirement
+
+	// Setup prepares the test.
+	Setup(env *Env) error
+
+	// Run runs the test and returns its results. If an error is returned, the
+	// results are kept and the test is marked as failed.
+	Run(ctx context.Context, env *Env) ([]*result.TestResult, error)
+
+	// Teardown cleans up after the test. It is called after Run, also if Run
+	// failed.
+	Teardown(env *Env) error
+}
+
+// RunFunc is the function, that runs a test.
+type RunFunc func(ctx context.Context, env *Env) ([]*result.TestResult, error)
+
+// funcTest is a Test without setup and teardown.
+type funcTest struct {
+	name         string
+	requirements []Requirement
+	run          RunFunc
+}
+
+// NewTest creates a Test from a function. The test has no setup and teardown.
+func NewTest(name string, run RunFunc, requirements ...Requirement) Test {
+	return &funcTest{name: name, requirements: requirements, run: run}
+}
+
+func (t *funcTest) Name() string                { return t.name }
+func (t *funcTest) Requirements() []Requirement { return t.requirements }
+func (t *funcTest) Setup(env *Env) error        { return nil }
+func (t *funcTest) Teardown(env *Env) error     { return nil }
+
+func (t *funcTest) Run(ctx context.Context, env *Env) ([]*result.TestResult, error) {
+	return t.run(ctx, env)
+}
+
+var (
+	// ConnectTest connects all clients. Measures the time until all clients
+	// are connected and until they all got there first data.
+	ConnectTest = WithEffects(WithDescription(
+		NewTest("connect", runConnectTest),
+		"Connects all clients. Measures the time until each client is connected and until it got its first data.",
+	), []Requirement{RequireConnected}, nil)
+
+	// OneWriteTest sends one write request with the first client and measures
+	// the time until all clients get the changed data.
+	OneWriteTest = WithDescription(
+		NewTest("onewrite", runOneWriteTest, RequireConnected, RequireFirstAdmin),
+		"Sends one write request with the first client. Measures the time until each client got the changed data.",
+	)
+
+	// ManyWriteTest sends one write request for each admin client and measures
+	// the time until all write requests are send and until all data is
+	// received.
+	ManyWriteTest = WithDescription(
+		NewTest("manywrite", runManyWriteTest, RequireConnected, RequireAdmin),
+		"Sends one write request with each admin client. Measures the time of the requests and until each client got all changes.",
+	)
+
+	// LogoutTest logs out all logged-in clients and measures the time until the
+	// server closes there connections.
+	LogoutTest = WithEffects(WithDescription(
+		NewTest("logout", runLogoutTest, RequireConnected, RequireAuth),
+		"Logs out all logged-in clients at the same time. Measures the time of the logout and until the server closed the connection. The clients are not connected afterwards.",
+	), nil, []Requirement{RequireConnected})
+)
+
+// RunTests runs some tests for the clients of an environment. It returns the
+// TestResults for each test.
+//
+// If Warmup is true, the clients are connected and warmed up before the first
+// test. Then the requirements of all tests are checked with PlanTests. If
+// AutoSetup is true, missing setup tests are inserted.
+//
+// If the requirements of a test are not met or if one of its phases fails, a
+// result with the error is added and the next test is run. The hooks of the
+// environment are called before the tests and around each test.
+//
+// The results of each test are published to all sinks. The sinks are closed
+// after the last test. If CheckConsistency is true, the data of the admin
+// clients is compared with the server after the last test.
+func RunTests(ctx context.Context, env *Env, tests []Test, sinks []result.Sink) (r []*result.TestResult) {
+	start := time.Now()
+	defer func() {
+		if !env.Config.Quiet {
+			fmt.Printf("\nAll tests took %dms\n\n", time.Since(start)/time.Millisecond)
+		}
+	}()
+	defer func() {
+		for _, sink := range sinks {
+			if err := sink.Close(); err != nil {
+				log.Printf("Can not close result sink, %s", err)
+			}
+		}
+	}()
+
+	if env.Config.Warmup {
+		if err := runWarmup(ctx, env); err != nil {
+			failure := result.New("Warm-up failed")
+			failure.AddError(err)
+			log.Printf("Warm-up failed: %s", err)
+			return []*result.TestResult{failure}
+		}
+	}
+
+	tests, err := PlanTests(env.Clients, tests, env.Config.AutoSetup)
+	if err != nil {
+		failure := result.New("Tests can not run")
+		failure.AddError(err)
+		log.Printf("Tests can not run: %s", err)
+		return []*result.TestResult{failure}
+	}
+
+	if err := env.Hooks.beforeRun(env); err != nil {
+		failure := result.New("Hook before the tests failed")
+		failure.AddError(err)
+		log.Printf("Hook before the tests failed: %s", err)
+		return []*result.TestResult{failure}
+	}
+
+	if len(env.loginResults) > 0 {
+		for _, sink := range sinks {
+			if err := sink.Publish("login", env.loginResults); err != nil {
+				log.Printf("Can not publish results of the login, %s", err)
+			}
+		}
+		r = append(r, env.loginResults...)
+		env.loginResults = nil
+	}
+
+	for _, test := range tests {
+		if ctx.Err() != nil {
+			log.Printf("Skip test %s, %s", test.Name(), ctx.Err())
+			continue
+		}
+		results := runTest(ctx, env, test)
+		for _, sink := range sinks {
+			if err := sink.Publish(test.Name(), results); err != nil {
+				log.Printf("Can not publish results of %s, %s", test.Name(), err)
+			}
+		}
+		r = append(r, results...)
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	if results := env.checks.checkConsistency(ctx, env); len(results) > 0 {
+		for _, sink := range sinks {
+			if err := sink.Publish("consistency", results); err != nil {
+				log.Printf("Can not publish results of the consistency check, %s", err)
+			}
+		}
+		r = append(r, results...)
+	}
+	return
+}
+
+// runTest runs the phases of one test.
+func runTest(ctx context.Context, env *Env, test Test) (r []*result.TestResult) {
+	// The span of the test ends with the error of the first failed phase.
+	ctx, span := tracing.Start(ctx, "test", "test", test.Name())
+	defer span.End(nil)
+
+	failed := func(phase string, err error) []*result.TestResult {
+		span.End(fmt.Errorf("%s: %s", phase, err))
+		failure := result.New(fmt.Sprintf("Test %s failed in %s", test.Name(), phase))
+		failure.AddError(err)
+		log.Printf("Test %s failed in %s: %s", test.Name(), phase, err)
+		env.Hooks.onError(env, test, err)
+		return append(r, failure)
+	}
+
+	for _, requirement := range test.Requirements() {
+		if err := requirement.Check(env.Clients); err != nil {
+			return failed("requirements", err)
+		}
+	}
+
+	defer startProfiles(env.Config, test.Name())()
+
+	// The violations of the message checks, the http status codes, the
+	// connections, that were closed during the test, the 503 responses, the
+	// dropped messages and the leaked goroutines are added to its results. The
+	// read loops of the closed connections are stopped before the leak check.
+	start := time.Now()
+	goroutines := countGoroutines(env.Clients)
+	env.checks.begin(env, test.Name())
+	env.statuses.begin(env.NewCollector())
+	defer func() {
+		r = append(r, env.checks.end(env)...)
+		r = append(r, env.statuses.end()...)
+		r = append(r, closedConnections(env, start)...)
+		stopClosedClients(env.Clients, start)
+		r = append(r, backpressureResults(env)...)
+		r = append(r, queueResults(env)...)
+		// After an interrupt, the clients are still listening until they
+		// are closed.
+		if env.Config.LeakCheck && ctx.Err() == nil {
+			r = append(r, checkLeaks(env, goroutines)...)
+		}
+	}()
+
+	if err := env.Hooks.beforeTest(env, test); err != nil {
+		return failed("before hook", err)
+	}
+
+	if err := test.Setup(env); err != nil {
+		return failed("setup", err)
+	}
+
+	r, err := runWithTimeout(ctx, env, test)
+	if err != nil {
+		r = failed("run", err)
+	}
+
+	if err := test.Teardown(env); err != nil {
+		r = failed("teardown", err)
+	}
+
+	if err := env.Hooks.afterTest(env, test, r); err != nil {
+		r = failed("after hook", err)
+	}
+	return r
+}
+
+// closedConnections returns a result for each reason, the connections of the
+// clients were closed with since start. The values are the times, the
+// connections were open.
+func closedConnections(env *Env, start time.Time) []*result.TestResult {
+	collector := env.NewCollector()
+	for _, c := range env.Clients {
+		info := c.CloseInfo()
+		if info == nil || info.At.Before(start) {
+			continue
+		}
+		collector.Observe("Closed connections", result.Labels{"reason": info.Reason}, info.Open, nil)
+	}
+	return collector.Results()
+}
+
+// queueResults returns, how far the test was behind the received messages of
+// the clients since the last call. There is a result with the longest time, a
+// message waited in the queue, for each client, that got messages, and a
+// result with an error for each client, that dropped messages, because its
+// queue was full.
+func queueResults(env *Env) []*result.TestResult {
+	collector := env.NewCollector()
+	for _, c := range env.Clients {
+		stats := c.TakeQueueStats()
+		if stats.MaxWait > 0 {
+			collector.Observe("Longest wait of a message in the queue per client", nil, stats.MaxWait, nil)
+		}
+		if stats.Dropped > 0 {
+			collector.Observe("Messages dropped, because the queue of the client was full", nil, 0, fmt.Errorf("%s dropped %d messages", c, stats.Dropped))
+		}
+	}
+	return collector.Results()
+}
+
+// backpressureResults returns the 503 responses, that the clients got since
+// the last call, and the time they waited because of them. Returns nil, if
+// there were none.
+func backpressureResults(env *Env) []*result.TestResult {
+	collector := env.NewCollector()
+	for _, c := range env.Clients {
+		rejections, backoff := c.TakeBackpressure()
+		if rejections == 0 {
+			continue
+		}
+		// One sample for each response, so the count of the result is the
+		// number of responses.
+		for i := 0; i < rejections; i++ {
+			collector.Observe("503 responses (channel full)", nil, backoff/time.Duration(rejections), nil)
+		}
+		collector.Observe("Time backed off after 503 responses per client", nil, backoff, nil)
+	}
+	return collector.Results()
+}
+
+// runConnectTest opens connections for any given client. It returns two TestResults
+// The first measures the time until the connection was open, the second measures the
+// time until the fire data was received.
+// Expects, that the wsconnection of the clients are closed.
+func runConnectTest(ctx context.Context, env *Env) ([]*result.TestResult, error) {
+	cfg := env.Config
+	clients := env.Clients
+	log.Println("Start ConnectTest")
+	startTest := time.Now()
+	defer func() { log.Printf("ConnectionTest took %dms", time.Since(startTest)/time.Millisecond) }()
+
+	collector := env.NewCollector()
+	connected := collector.Expect("Time to established connection", len(clients))
+	dataReceived := collector.Expect("Time until data has been reveiced since the connection", len(clients))
+
+	// Connect all Clients and listen to them to receive the response.
+	err := runAll(ctx, cfg, collector,
+		connectClients(cfg, env.Pools.get(cfg).Connect, clients, connected),
+		listenToClients(clients, dataReceived, 1, nil, nil),
+	)
+	if err == nil && cfg.CheckData {
+		checkData(clients, collector)
+	}
+	return collector.Results(), err
+}
+
+// runOneWriteTest tests, that all clients get a response when there is one write
+// request.
+// Expects, that the first client is a logged-in admin client and that all
+// clients have open websocket connections.
+func runOneWriteTest(ctx context.Context, env *Env) ([]*result.TestResult, error) {
+	cfg := env.Config
+	clients := env.Clients
+	log.Println("Start OneWriteTest")
+	startTest := time.Now()
+	defer func() { log.Printf("OneWriteTest took %dms\n", time.Since(startTest)/time.Millisecond) }()
+
+	// The first client is an admin client. This is checked by the requirements.
+	admin := clients[0].(client.AdminClient)
+
+	// Send the request.
+	err := admin.Send(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can not send request: %s", err)
+	}
+
+	// Listen to all clients to receive the response.
+	collector := env.NewCollector()
+	dataReceived := collector.Expect("Time until data is received after one write request", len(clients))
+	err = runAll(ctx, cfg, collector, listenToClients(clients, dataReceived, 1, nil, nil))
+	if err == nil && cfg.CheckData {
+		checkData(clients, collector)
+	}
+	return collector.Results(), err
+}
+
+// runManyWriteTest tests behave like the OneWriteTest but send many write request.
+// The first clients have to be admin clients. Sends one write request for each
+// admin client. With a WriteRate, the requests are send at that rate.
+// Expects, that at least one client is a logged-in admin client and that all
+// clients have open websocket connections.
+func runManyWriteTest(ctx context.Context, env *Env) ([]*result.TestResult, error) {
+	cfg := env.Config
+	clients := env.Clients
+	log.Println("Start ManyWriteTest")
+	startTest := time.Now()
+	defer func() { log.Printf("ManyWriteTest took %dms\n", time.Since(startTest)/time.Millisecond) }()
+
+	// Find all admins in the clients
+	var admins []client.AdminClient
+	for _, c := range clients {
+		admin, ok := c.(client.AdminClient)
+		if ok && admin.IsAdmin() && admin.IsConnected() {
+			admins = append(admins, admin)
+		}
+	}
+
+	// With CheckPropagation, each write request gets a marker and the test
+	// reports, which clients did not get it.
+	admins = env.checks.trackWrites(clients, admins)
+
+	collector := env.NewCollector()
+	sended := collector.Expect("Time until all requests have been sended", len(admins))
+	received := collector.Expect("Time until all responses have been received", len(clients))
+
+	// Send requests for all admin clients and listen for all clients to
+	// receive as many responses as there are admins.
+	send := sendClients(env.Pools.get(cfg).Send, admins, sended)
+	if cfg.WriteRate > 0 {
+		send = pacedSendClients(admins, len(admins), cfg.WriteRate, sended)
+	}
+	err := runAll(ctx, cfg, collector, send, listenToClients(clients, received, len(admins), nil, nil))
+	return collector.Results(), err
+}
+
+// runLogoutTest logs out all logged-in clients at the same time. It measures the
+// time of the logout requests and the time until the server closes the
+// connections of the clients. If LogoutTestRelogin is true, the clients login
+// again and the time of the login is measured.
+// Expects, that all clients have open websocket connections. Afterwards, the
+// clients are not connected anymore.
+func runLogoutTest(ctx context.Context, env *Env) ([]*result.TestResult, error) {
+	cfg := env.Config
+	clients := env.Clients
+	log.Println("Start LogoutTest")
+	startTest := time.Now()
+	defer func() { log.Printf("LogoutTest took %dms\n", time.Since(startTest)/time.Millisecond) }()
+
+	// Find all connected, logged-in clients
+	var authClients []client.AuthClient
+	for _, c := range clients {
+		authClient, ok := c.(client.AuthClient)
+		if ok && authClient.IsAuth() && authClient.IsConnected() {
+			authClients = append(authClients, authClient)
+		}
+	}
+
+	collector := env.NewCollector()
+	observers := logoutObservers{
+		loggedOut: collector.Expect("Time until the logout request was answered", len(authClients)),
+		closed:    collector.Expect("Time until the connection was closed after the logout", len(authClients)),
+	}
+	if cfg.LogoutTestRelogin {
+		observers.loggedIn = collector.Expect("Time to login again after the logout", len(authClients))
+	}
+	err := runAll(ctx, cfg, collector, logoutClients(cfg, env.Pools.get(cfg).Login, authClients, observers, cfg.LogoutTestRelogin))
+	return collector.Results(), err
+}
@@ -0,0 +1,89 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ostcar/oswstest/result"
+)
+
+// abortWait is the time, an aborted test has to return after its context was
+// canceled. A test, that does not return in time, is left running.
+const abortWait = 5 * time.Second
+
+// maxDumpedClients is the number of unfinished clients, that are logged
+// one by one. Of the others, only the number is logged.
+const maxDumpedClients = 20
+
+// runWithTimeout runs a test. If the test takes longer then TestTimeout, the
+// state of the unfinished clients is logged, the context of the test is
+// canceled and an error is returned.
+// The context of the test is always canceled, when the test returns. So work,
+// that a test leaves behind after an error, like after the error budget was
+// exceeded, stops.
+func runWithTimeout(ctx context.Context, env *Env, test Test) ([]*result.TestResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	timeout := env.Config.TestTimeout
+	if timeout <= 0 {
+		return test.Run(ctx, env)
+	}
+
+	type runResult struct {
+		r   []*result.TestResult
+		err error
+	}
+	done := make(chan runResult, 1)
+	go func() {
+		r, err := test.Run(ctx, env)
+		done <- runResult{r, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		return res.r, res.err
+	case <-timer.C:
+	}
+
+	// The state is logged before the cancel, because the clients stop to
+	// wait afterwards.
+	log.Printf("Test %s did not finish within %s, abort it", test.Name(), timeout)
+	dumpClients(env)
+	cancel()
+
+	err := fmt.Errorf("test did not finish within %s", timeout)
+	select {
+	case res := <-done:
+		// Keep the results, that the test has collected so far.
+		return res.r, err
+	case <-time.After(abortWait):
+		log.Printf("Test %s does not stop, go on without it", test.Name())
+		return nil, err
+	}
+}
+
+// dumpClients logs the state of the clients, that did not finish. These are
+// the clients, that are not connected or still wait for data or the close of
+// there connection.
+func dumpClients(env *Env) {
+	var unfinished int
+	for _, c := range env.Clients {
+		state := c.State()
+		if state.Connected && !state.Expecting {
+			continue
+		}
+		unfinished++
+		if unfinished <= maxDumpedClients {
+			log.Printf("  %s: %s", c, state)
+		}
+	}
+	if unfinished > maxDumpedClients {
+		log.Printf("  and %d other clients", unfinished-maxDumpedClients)
+	}
+	log.Printf("%d of %d clients did not finish", unfinished, len(env.Clients))
+}
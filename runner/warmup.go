@@ -0,0 +1,74 @@
+package runner
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ostcar/oswstest/client"
+	"github.com/ostcar/oswstest/result"
+)
+
+// runWarmup connects the clients, sends WarmupWrites write requests and waits
+// WarmupWait, so the caches of the server are filled before the first test.
+// The samples are not part of any result.
+func runWarmup(ctx context.Context, env *Env) error {
+	cfg := env.Config
+	log.Println("Start warm-up")
+	startWarmup := time.Now()
+	defer func() { log.Printf("Warm-up took %dms", time.Since(startWarmup)/time.Millisecond) }()
+
+	// The collector is not created with env.NewCollector, so the samples are
+	// not given to OnSample. It is only used for the progress.
+	collector := result.NewCollector()
+	discard := func(time.Duration, error) {}
+
+	var notConnected []client.Client
+	for _, c := range env.Clients {
+		if !c.IsConnected() {
+			notConnected = append(notConnected, c)
+		}
+	}
+	connected := collector.Expect("Warm-up connections", len(notConnected))
+	err := runAll(ctx, cfg, collector,
+		connectClients(cfg, env.Pools.get(cfg).Connect, notConnected, connected),
+		listenToClients(notConnected, discard, 1, nil, nil),
+	)
+	if err != nil {
+		return err
+	}
+
+	var admins []client.AdminClient
+	var connectedClients []client.Client
+	for _, c := range env.Clients {
+		if !c.IsConnected() {
+			continue
+		}
+		connectedClients = append(connectedClients, c)
+		if admin, ok := c.(client.AdminClient); ok && admin.IsAdmin() {
+			admins = append(admins, admin)
+		}
+	}
+	if cfg.WarmupWrites > 0 && len(admins) > 0 {
+		sended := collector.Expect("Warm-up write requests", cfg.WarmupWrites)
+		err := runAll(ctx, cfg, collector,
+			pacedSendClients(admins, cfg.WarmupWrites, cfg.WriteRate, sended),
+			listenToClients(connectedClients, discard, cfg.WarmupWrites, nil, nil),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The 503 responses of the warm-up are not part of the first test.
+	for _, c := range env.Clients {
+		c.TakeBackpressure()
+	}
+
+	select {
+	case <-time.After(cfg.WarmupWait):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// Package schema validates json values against a small subset of json schema.
+//
+// Supported are the keywords "type", "enum", "properties", "required",
+// "additionalProperties" (only as bool) and "items". This is enough to check
+// the fields of the autoupdate messages.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+)
+
+// Schema is a json schema.
+type Schema struct {
+	Type                 typeList           `json:"type"`
+	Enum                 []interface{}      `json:"enum"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+}
+
+// typeList is the value of "type". It can be a string or a list of strings.
+type typeList []string
+
+func (t *typeList) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = typeList{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("type has to be a string or a list of strings")
+	}
+	*t = many
+	return nil
+}
+
+// Load reads a json file, that maps message types to schemas, like
+// {"motions/motion": {"type": "object", "required": ["id", "title"]}}.
+func Load(path string) (map[string]*Schema, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can not read schema file: %s", err)
+	}
+	var schemas map[string]*Schema
+	if err := json.Unmarshal(data, &schemas); err != nil {
+		return nil, fmt.Errorf("can not decode schema file %s: %s", path, err)
+	}
+	return schemas, nil
+}
+
+// Validate returns all violations of a decoded json value. A violation starts
+// with the path of the value, like "data.title".
+func (s *Schema) Validate(v interface{}) []error {
+	return s.validate("", v)
+}
+
+func (s *Schema) validate(path string, v interface{}) (errs []error) {
+	if s == nil {
+		return nil
+	}
+	at := func(format string, a ...interface{}) error {
+		name := path
+		if name == "" {
+			name = "message"
+		}
+		return fmt.Errorf("%s: %s", name, fmt.Sprintf(format, a...))
+	}
+
+	if len(s.Type) > 0 && !s.Type.matches(v) {
+		return []error{at("is %s, expected %v", jsonType(v), []string(s.Type))}
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, at("%v is not one of %v", v, s.Enum))
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, ok := v[key]; !ok {
+				errs = append(errs, at("required field %q is missing", key))
+			}
+		}
+
+		// Sort the keys, so the violations have a stable order.
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			property, ok := s.Properties[key]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					errs = append(errs, at("unknown field %q", key))
+				}
+				continue
+			}
+			errs = append(errs, property.validate(join(path, key), v[key])...)
+		}
+
+	case []interface{}:
+		for i, item := range v {
+			errs = append(errs, s.Items.validate(join(path, fmt.Sprint(i)), item)...)
+		}
+	}
+	return errs
+}
+
+// matches returns true, if the value has one of the types.
+func (t typeList) matches(v interface{}) bool {
+	got := jsonType(v)
+	for _, want := range t {
+		if want == got {
+			return true
+		}
+		if want == "number" && got == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType returns the json schema type of a decoded json value.
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
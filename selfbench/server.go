@@ -0,0 +1,212 @@
+// Package selfbench runs the tests against a websocket server in the same
+// process. The server does nearly no work, so the results show the maximum
+// throughput and the latency floor of oswstest itself. Compare them with the
+// results of a real server to see, how much of the latency is oswstest.
+package selfbench
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/ostcar/oswstest/config"
+)
+
+// sessionCookie is the name of the cookie with the session of a client.
+const sessionCookie = "sessionid"
+
+// initialData is the first message of each websocket connection.
+var initialData = []byte(`[{"collection":"users/user","id":1,"action":"changed","data":{"id":1,"username":"selfbench"}}]`)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// Server is a small server with the endpoints, that the clients use. The
+// login sets a session cookie, each websocket connection gets initialData and
+// each write request is send to all connections as autoupdate. The logout
+// closes the connections of the session.
+type Server struct {
+	mu    sync.Mutex
+	conns map[*conn]bool
+}
+
+// conn is a websocket connection of the server. All messages are written by
+// one goroutine, because a websocket connection can not be written
+// concurrently.
+type conn struct {
+	ws      *websocket.Conn
+	session string
+	send    chan []byte
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewServer creates a server without connections.
+func NewServer() *Server {
+	return &Server{conns: make(map[*conn]bool)}
+}
+
+// Handler returns the endpoints of the server at the paths of the
+// configuration.
+func (s *Server) Handler(cfg *config.Config) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+cfg.LoginURLPath, s.login)
+	mux.HandleFunc("/"+cfg.LogoutURLPath, s.logout)
+	mux.HandleFunc("/"+cfg.WSURLPath, s.websocket)
+	mux.HandleFunc("/"+cfg.RESTURLPath, s.write)
+	return mux
+}
+
+// Start starts a server on a free port of localhost and changes the
+// configuration, so the clients use it. The clients login with a session
+// cookie and without csrf token. The returned function stops the server.
+func Start(cfg *config.Config) (stop func(), err error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("can not listen: %s", err)
+	}
+
+	cfg.BaseURL = "%s://" + lis.Addr().String() + "/%s"
+	cfg.AuthMode = "session"
+	cfg.CSRFMode = "none"
+	cfg.ReuseSessions = false
+
+	srv := &http.Server{Handler: NewServer().Handler(cfg)}
+	go func() {
+		if err := srv.Serve(lis); err != nil && err != http.ErrServerClosed {
+			log.Printf("Self-benchmark server failed, %s", err)
+		}
+	}()
+	return func() { srv.Close() }, nil
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: hex.EncodeToString(id), Path: "/"})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{}"))
+}
+
+func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		http.Error(w, "not logged in", http.StatusForbidden)
+		return
+	}
+
+	s.mu.Lock()
+	var closing []*conn
+	for c := range s.conns {
+		if c.session == cookie.Value {
+			closing = append(closing, c)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, c := range closing {
+		c.ws.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, "logout"),
+			time.Now().Add(time.Second),
+		)
+		c.ws.Close()
+	}
+	w.Write([]byte("{}"))
+}
+
+func (s *Server) websocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &conn{ws: ws, send: make(chan []byte, 256), done: make(chan struct{})}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		c.session = cookie.Value
+	}
+
+	s.mu.Lock()
+	s.conns[c] = true
+	s.mu.Unlock()
+	defer s.remove(c)
+
+	go c.writeLoop()
+	c.write(initialData)
+
+	// Read until the client closes the connection.
+	for {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// write sends the data of a write request to all connections as autoupdate.
+func (s *Server) write(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		w.Write([]byte("{}"))
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	message := []byte(`[{"collection":"agenda/item","id":1,"action":"changed","data":`)
+	message = append(message, body...)
+	message = append(message, "}]"...)
+
+	s.mu.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.write(message)
+	}
+	w.Write(body)
+}
+
+func (s *Server) remove(c *conn) {
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+	c.once.Do(func() { close(c.done) })
+	c.ws.Close()
+}
+
+// write gives a message to the write loop. It blocks, if the loop is behind,
+// and does nothing, if the connection is closed.
+func (c *conn) write(data []byte) {
+	select {
+	case c.send <- data:
+	case <-c.done:
+	}
+}
+
+func (c *conn) writeLoop() {
+	for {
+		select {
+		case data := <-c.send:
+			if err := c.ws.WriteMessage(websocket.TextMessage, data); err != nil {
+				c.ws.Close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
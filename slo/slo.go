@@ -0,0 +1,113 @@
+// Package slo checks the results of the tests against service level
+// objectives.
+package slo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ostcar/oswstest/config"
+	"github.com/ostcar/oswstest/result"
+)
+
+// Violation is a result, that does not meet a SLO.
+type Violation struct {
+	SLO         config.SLO
+	Description string
+
+	// Value is the statistic of the result. It is a duration or, for the
+	// statistic "errors", the error rate.
+	Value string
+}
+
+func (v Violation) String() string {
+	if v.Description == "" {
+		return fmt.Sprintf("%s: no result of the test %s", v.SLO, v.SLO.Test)
+	}
+	return fmt.Sprintf("%s: %s of %q is %s", v.SLO, v.SLO.Stat, v.Description, v.Value)
+}
+
+// Checker is a result.Sink, that checks the results of each test against the
+// SLOs. Closing it does nothing.
+type Checker struct {
+	slos       []config.SLO
+	checked    []bool
+	violations []Violation
+}
+
+// NewChecker creates a checker for some SLOs.
+func NewChecker(slos []config.SLO) *Checker {
+	return &Checker{slos: slos, checked: make([]bool, len(slos))}
+}
+
+// Publish checks the results of a test.
+func (c *Checker) Publish(test string, results []*result.TestResult) error {
+	for i, slo := range c.slos {
+		if slo.Test != test {
+			continue
+		}
+		for _, r := range results {
+			if slo.Result != "" && slo.Result != r.Description() {
+				continue
+			}
+			c.checked[i] = true
+			if v, ok := check(slo, r); !ok {
+				c.violations = append(c.violations, v)
+			}
+		}
+	}
+	return nil
+}
+
+// Close does nothing.
+func (c *Checker) Close() error {
+	return nil
+}
+
+// Violations returns the results, that did not meet a SLO. A SLO without any
+// matching result is also a violation, because it could not be checked.
+func (c *Checker) Violations() []Violation {
+	violations := append([]Violation(nil), c.violations...)
+	for i, slo := range c.slos {
+		if !c.checked[i] {
+			violations = append(violations, Violation{SLO: slo})
+		}
+	}
+	return violations
+}
+
+// check returns false and the violation, if the result does not meet the
+// SLO.
+func check(slo config.SLO, r *result.TestResult) (Violation, bool) {
+	v := Violation{SLO: slo, Description: r.Description()}
+	if slo.Stat == "errors" {
+		var rate float64
+		if total := r.CountBoth(); total > 0 {
+			rate = float64(r.ErrCount()) / float64(total)
+		}
+		v.Value = strconv.FormatFloat(rate*100, 'f', 2, 64) + "%"
+		return v, rate == 0 || rate < slo.MaxErrorRate
+	}
+
+	if r.Count() == 0 {
+		// There are no durations to check. Results with only errors fail
+		// with an errors SLO.
+		return v, true
+	}
+	var d time.Duration
+	switch slo.Stat {
+	case "min":
+		d = r.Min()
+	case "ave":
+		d = r.Ave()
+	case "max":
+		d = r.Max()
+	default:
+		p, _ := strconv.ParseFloat(strings.TrimPrefix(slo.Stat, "p"), 64)
+		d = r.Percentile(p)
+	}
+	v.Value = d.String()
+	return v, d < slo.Below
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"regexp"
+	"strings"
+)
+
+// redacted replaces the secrets in the stored command line.
+const redacted = "xxxxx"
+
+// secretFlags are the flags, whose values are always replaced. The webhook
+// urls of slack and of the regressions are secrets themselves.
+var secretFlags = map[string]bool{
+	"join-token":         true,
+	"control-token":      true,
+	"notify":             true,
+	"regression-webhook": true,
+}
+
+var (
+	// urlPassword matches the password of the userinfo of an url.
+	urlPassword = regexp.MustCompile(`(://[^:/@\s]*):[^@/\s]*@`)
+
+	// secretParam matches secret parameters of urls and of postgres dsns like
+	// "host=db password=secret".
+	secretParam = regexp.MustCompile(`(?i)\b((?:access_token|token|password|passwd|secret|api_key|apikey|key)=)[^&\s]*`)
+)
+
+// redactArgs returns the command line without secrets. The values of
+// secretFlags are replaced and the passwords and tokens in urls of all other
+// values.
+func redactArgs(args []string) string {
+	out := make([]string, len(args))
+	redactNext := false
+	for i, arg := range args {
+		if redactNext {
+			out[i] = redacted
+			redactNext = false
+			continue
+		}
+		if strings.HasPrefix(arg, "-") {
+			name := strings.TrimLeft(arg, "-")
+			if j := strings.Index(name, "="); j >= 0 {
+				if secretFlags[name[:j]] {
+					out[i] = arg[:len(arg)-len(name)+j+1] + redacted
+					continue
+				}
+			} else if secretFlags[name] {
+				redactNext = true
+			}
+		}
+		out[i] = redactURL(arg)
+	}
+	return strings.Join(out, " ")
+}
+
+// redactURL replaces the passwords and tokens in a value.
+func redactURL(s string) string {
+	s = urlPassword.ReplaceAllString(s, "${1}:"+redacted+"@")
+	return secretParam.ReplaceAllString(s, "${1}"+redacted)
+}
@@ -0,0 +1,17 @@
+package store
+
+import (
+	// The sqlite driver for database/sql.
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqlite is the dialect of SQLite. The dsn is the path of the database file.
+var sqlite = dialect{
+	driver: "sqlite3",
+	id:     "INTEGER PRIMARY KEY AUTOINCREMENT",
+	float:  "REAL",
+}
+
+func init() {
+	register("sqlite", sqlite)
+}
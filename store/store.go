@@ -0,0 +1,360 @@
+// Package store keeps the results of all runs in a sql database, so the
+// history survives across invocations and can be queried with sql.
+//
+// Each run is a row in the table runs with its metadata. The command line of
+// the run is stored without passwords and tokens. The aggregated values of
+// each result are in the table results, the errors in the table errors and,
+// optional, each sample in the table samples. The table baselines has the
+// runs, that were marked as baseline. The tables are created, if they do not
+// exist.
+//
+// Importing the package registers the result sinks "sqlite:<file>",
+// "sqlite+samples:<file>", "postgres:<dsn>" and "postgres+samples:<dsn>".
+// The sinks with "+samples" also store each sample.
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ostcar/oswstest/result"
+)
+
+// dialect are the differences of the databases.
+type dialect struct {
+	driver string
+
+	// id is the type of an auto incremented primary key.
+	id string
+
+	// float is the type of a floating point column.
+	float string
+
+	// numbered is true, if the placeholders are $1, $2, ... instead of ?.
+	numbered bool
+}
+
+// rebind replaces the placeholders ? of a query, if the database uses
+// numbered placeholders.
+func (d dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// schema returns the statements, that create the tables.
+func (d dialect) schema() []string {
+	return []string{
+		`CREATE TABLE IF NOT EXISTS runs (
+			id ` + d.id + `,
+			started TIMESTAMP NOT NULL,
+			finished TIMESTAMP,
+			host TEXT NOT NULL,
+			username TEXT NOT NULL,
+			args TEXT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS results (
+			run_id BIGINT NOT NULL REFERENCES runs(id),
+			test TEXT NOT NULL,
+			result TEXT NOT NULL,
+			count BIGINT NOT NULL,
+			errors BIGINT NOT NULL,
+			min_ms ` + d.float + ` NOT NULL,
+			ave_ms ` + d.float + ` NOT NULL,
+			max_ms ` + d.float + ` NOT NULL,
+			p50_ms ` + d.float + ` NOT NULL,
+			p95_ms ` + d.float + ` NOT NULL,
+			p99_ms ` + d.float + ` NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS errors (
+			run_id BIGINT NOT NULL REFERENCES runs(id),
+			test TEXT NOT NULL,
+			result TEXT NOT NULL,
+			error TEXT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS samples (
+			run_id BIGINT NOT NULL REFERENCES runs(id),
+			test TEXT NOT NULL,
+			result TEXT NOT NULL,
+			duration_ms ` + d.float + ` NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS results_run ON results (run_id)`,
+		`CREATE TABLE IF NOT EXISTS baselines (
+			run_id BIGINT NOT NULL REFERENCES runs(id),
+			marked TIMESTAMP NOT NULL
+		)`,
+	}
+}
+
+// Sink is a result.Sink, that writes the results of one run to a database.
+type Sink struct {
+	db      *sql.DB
+	dialect dialect
+	run     int64
+	samples bool
+}
+
+// open opens the database, creates the tables and inserts the run. If
+// samples is true, each sample is also stored.
+func open(d dialect, dsn string, samples bool) (*Sink, error) {
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range d.schema() {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("can not create the tables: %s", err)
+		}
+	}
+
+	host, _ := os.Hostname()
+	username := os.Getenv("USER")
+	// The database is shared, so the secrets of the command line are removed.
+	args := redactArgs(os.Args[1:])
+	s := &Sink{db: db, dialect: d, samples: samples}
+	err = db.QueryRow(
+		d.rebind("INSERT INTO runs (started, host, username, args) VALUES (?, ?, ?, ?) RETURNING id"),
+		time.Now().UTC(), host, username, args,
+	).Scan(&s.run)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("can not insert the run: %s", err)
+	}
+	return s, nil
+}
+
+// Run returns the id of the run in the table runs.
+func (s *Sink) Run() int64 {
+	return s.run
+}
+
+// Publish writes the results of one test in one transaction.
+func (s *Sink) Publish(test string, results []*result.TestResult) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insertResult, err := tx.Prepare(s.dialect.rebind(
+		"INSERT INTO results (run_id, test, result, count, errors, min_ms, ave_ms, max_ms, p50_ms, p95_ms, p99_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+	))
+	if err != nil {
+		return err
+	}
+	defer insertResult.Close()
+	insertError, err := tx.Prepare(s.dialect.rebind("INSERT INTO errors (run_id, test, result, error) VALUES (?, ?, ?, ?)"))
+	if err != nil {
+		return err
+	}
+	defer insertError.Close()
+	insertSample, err := tx.Prepare(s.dialect.rebind("INSERT INTO samples (run_id, test, result, duration_ms) VALUES (?, ?, ?, ?)"))
+	if err != nil {
+		return err
+	}
+	defer insertSample.Close()
+
+	for _, r := range results {
+		_, err := insertResult.Exec(
+			s.run,
+			test,
+			r.Description(),
+			r.Count(),
+			r.ErrCount(),
+			ms(r.Min()),
+			ms(r.Ave()),
+			ms(r.Max()),
+			ms(r.Percentile(50)),
+			ms(r.Percentile(95)),
+			ms(r.Percentile(99)),
+		)
+		if err != nil {
+			return fmt.Errorf("can not insert result: %s", err)
+		}
+		for _, e := range r.Errors() {
+			if _, err := insertError.Exec(s.run, test, r.Description(), e.Error()); err != nil {
+				return fmt.Errorf("can not insert error: %s", err)
+			}
+		}
+		if !s.samples {
+			continue
+		}
+		for _, v := range r.Values() {
+			if _, err := insertSample.Exec(s.run, test, r.Description(), ms(v)); err != nil {
+				return fmt.Errorf("can not insert sample: %s", err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// Close sets the end of the run and closes the database.
+func (s *Sink) Close() error {
+	_, err := s.db.Exec(s.dialect.rebind("UPDATE runs SET finished = ? WHERE id = ?"), time.Now().UTC(), s.run)
+	if cerr := s.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// dialects are the registered databases by there sink type.
+var dialects = make(map[string]dialect)
+
+// register registers the result sinks of a database with and without the
+// samples.
+func register(kind string, d dialect) {
+	dialects[kind] = d
+	result.RegisterSink(kind, func(dsn string) (result.Sink, error) {
+		return open(d, dsn, false)
+	})
+	result.RegisterSink(kind+"+samples", func(dsn string) (result.Sink, error) {
+		return open(d, dsn, true)
+	})
+}
+
+// Result is a stored result.
+type Result struct {
+	Test   string
+	Result string
+	Count  int
+	Errors int
+	Min    time.Duration
+	Ave    time.Duration
+	Max    time.Duration
+	P50    time.Duration
+	P95    time.Duration
+	P99    time.Duration
+}
+
+// LoadRun reads the results of a run from the database of a sink type, like
+// "sqlite" or "postgres". If run is 0, the last run is read. It returns the id
+// of the run.
+func LoadRun(kind, dsn string, run int64) (int64, []Result, error) {
+	d, ok := dialects[strings.TrimSuffix(kind, "+samples")]
+	if !ok {
+		return 0, nil, fmt.Errorf("unknown database %q", kind)
+	}
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer db.Close()
+
+	if run == 0 {
+		if err := db.QueryRow("SELECT MAX(id) FROM runs").Scan(&run); err != nil {
+			return 0, nil, fmt.Errorf("can not find the last run: %s", err)
+		}
+	}
+
+	rows, err := db.Query(
+		d.rebind("SELECT test, result, count, errors, min_ms, ave_ms, max_ms, p50_ms, p95_ms, p99_ms FROM results WHERE run_id = ?"),
+		run,
+	)
+	if err != nil {
+		return 0, nil, fmt.Errorf("can not read the results of run %d: %s", run, err)
+	}
+	defer rows.Close()
+
+	var results []Result
+	for rows.Next() {
+		var r Result
+		var min, ave, max, p50, p95, p99 float64
+		if err := rows.Scan(&r.Test, &r.Result, &r.Count, &r.Errors, &min, &ave, &max, &p50, &p95, &p99); err != nil {
+			return 0, nil, fmt.Errorf("can not read the results of run %d: %s", run, err)
+		}
+		r.Min, r.Ave, r.Max, r.P50, r.P95, r.P99 = fromMS(min), fromMS(ave), fromMS(max), fromMS(p50), fromMS(p95), fromMS(p99)
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+	if len(results) == 0 {
+		return 0, nil, fmt.Errorf("run %d has no results", run)
+	}
+	return run, results, nil
+}
+
+// MarkBaseline marks a run as baseline. If run is 0, the last run is marked.
+// The last marked run is the baseline. It returns the id of the run.
+func MarkBaseline(kind, dsn string, run int64) (int64, error) {
+	d, ok := dialects[strings.TrimSuffix(kind, "+samples")]
+	if !ok {
+		return 0, fmt.Errorf("unknown database %q", kind)
+	}
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	for _, stmt := range d.schema() {
+		if _, err := db.Exec(stmt); err != nil {
+			return 0, fmt.Errorf("can not create the tables: %s", err)
+		}
+	}
+
+	if run == 0 {
+		if err := db.QueryRow("SELECT MAX(id) FROM runs").Scan(&run); err != nil {
+			return 0, fmt.Errorf("can not find the last run: %s", err)
+		}
+	}
+	var exists bool
+	if err := db.QueryRow(d.rebind("SELECT COUNT(*) > 0 FROM runs WHERE id = ?"), run).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, fmt.Errorf("there is no run %d", run)
+	}
+	if _, err := db.Exec(d.rebind("INSERT INTO baselines (run_id, marked) VALUES (?, ?)"), run, time.Now().UTC()); err != nil {
+		return 0, fmt.Errorf("can not mark run %d: %s", run, err)
+	}
+	return run, nil
+}
+
+// Baseline returns the id of the run, that was marked last as baseline.
+func Baseline(kind, dsn string) (int64, error) {
+	d, ok := dialects[strings.TrimSuffix(kind, "+samples")]
+	if !ok {
+		return 0, fmt.Errorf("unknown database %q", kind)
+	}
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var run int64
+	err = db.QueryRow("SELECT run_id FROM baselines ORDER BY marked DESC LIMIT 1").Scan(&run)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("no run is marked as baseline")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("can not read the baseline: %s", err)
+	}
+	return run, nil
+}
+
+// fromMS returns the duration of milliseconds.
+func fromMS(v float64) time.Duration {
+	return time.Duration(v * float64(time.Millisecond))
+}
+
+// ms returns a duration in milliseconds.
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,310 @@
+// Package tracing exports the operations of the clients as OpenTelemetry
+// spans with OTLP over http and json. Each run is one trace with the root
+// span "run". The tests are spans below it and the login, connect, send and
+// receive-wait of each client are spans below the test or the run.
+//
+// The tracer is given to the clients with the context. Without a tracer in
+// the context, Start returns a nil span and all methods of a nil span do
+// nothing, so the clients do not have to check for it.
+//
+// With propagation, the http requests and the websocket handshakes of the
+// clients have the header traceparent of the W3C trace context, so the slow
+// requests can be found on the server.
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// exportInterval is the time between two exports of the finished spans.
+	exportInterval = 5 * time.Second
+
+	// maxQueue is the number of finished spans, that are kept until they are
+	// exported. More spans are dropped.
+	maxQueue = 100000
+
+	// batchSize is the number of spans of one request.
+	batchSize = 5000
+)
+
+// Tracer collects the finished spans of one run and exports them in the
+// background.
+type Tracer struct {
+	url       string
+	service   string
+	propagate bool
+	client    *http.Client
+	trace     [16]byte
+	run       *Span
+
+	mu      sync.Mutex
+	queue   []spanJSON
+	dropped int
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// New creates a tracer, that exports to the OTLP endpoint, like
+// http://localhost:4318. The path /v1/traces is added, if the endpoint has no
+// path. The run span is started. If endpoint is empty, New returns nil.
+func New(endpoint, service string, propagate bool) *Tracer {
+	if endpoint == "" {
+		return nil
+	}
+	u := strings.TrimSuffix(endpoint, "/")
+	if i := strings.Index(u, "://"); i < 0 || !strings.Contains(u[i+3:], "/") {
+		u += "/v1/traces"
+	}
+
+	t := &Tracer{
+		url:       u,
+		service:   service,
+		propagate: propagate,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	rand.Read(t.trace[:])
+	t.run = t.newSpan("run", [8]byte{})
+	go t.loop()
+	return t
+}
+
+// TraceID returns the id of the trace of the run as hex.
+func (t *Tracer) TraceID() string {
+	if t == nil {
+		return ""
+	}
+	return hex.EncodeToString(t.trace[:])
+}
+
+// Close ends the run span and exports all spans, that are not exported yet.
+func (t *Tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	t.run.End(nil)
+	close(t.stop)
+	<-t.stopped
+
+	err := t.export()
+	t.mu.Lock()
+	dropped := t.dropped
+	t.mu.Unlock()
+	if dropped > 0 {
+		log.Printf("Dropped %d spans, because they could not be exported fast enough", dropped)
+	}
+	return err
+}
+
+// loop exports the finished spans each exportInterval until the tracer is
+// closed.
+func (t *Tracer) loop() {
+	defer close(t.stopped)
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := t.export(); err != nil {
+				log.Printf("Can not export spans, %s", err)
+			}
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// finish queues a finished span.
+func (t *Tracer) finish(s spanJSON) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.queue) >= maxQueue {
+		t.dropped++
+		return
+	}
+	t.queue = append(t.queue, s)
+}
+
+// export sends the queued spans in batches of batchSize.
+func (t *Tracer) export() error {
+	t.mu.Lock()
+	spans := t.queue
+	t.queue = nil
+	t.mu.Unlock()
+
+	for len(spans) > 0 {
+		n := len(spans)
+		if n > batchSize {
+			n = batchSize
+		}
+		if err := t.send(spans[:n]); err != nil {
+			return err
+		}
+		spans = spans[n:]
+	}
+	return nil
+}
+
+// send sends spans with one request.
+func (t *Tracer) send(spans []spanJSON) error {
+	body := map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []attributeJSON{stringAttribute("service.name", t.service)},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": "github.com/ostcar/oswstest"},
+						"spans": spans,
+					},
+				},
+			},
+		},
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.client.Post(t.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", t.url, resp.Status)
+	}
+	return nil
+}
+
+// newSpan starts a span of the trace.
+func (t *Tracer) newSpan(name string, parent [8]byte, attributes ...string) *Span {
+	s := &Span{tracer: t, name: name, parent: parent, start: time.Now()}
+	rand.Read(s.id[:])
+	for i := 0; i+1 < len(attributes); i += 2 {
+		s.attributes = append(s.attributes, stringAttribute(attributes[i], attributes[i+1]))
+	}
+	return s
+}
+
+// Span is one operation of the trace.
+type Span struct {
+	tracer     *Tracer
+	id         [8]byte
+	parent     [8]byte
+	name       string
+	start      time.Time
+	attributes []attributeJSON
+	once       sync.Once
+}
+
+// End finishes the span. If err is not nil, the status of the span is error
+// with the error as message. Only the first call has an effect.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() {
+		j := spanJSON{
+			TraceID:    hex.EncodeToString(s.tracer.trace[:]),
+			SpanID:     hex.EncodeToString(s.id[:]),
+			Name:       s.name,
+			Kind:       spanKindInternal,
+			Start:      strconv.FormatInt(s.start.UnixNano(), 10),
+			End:        strconv.FormatInt(time.Now().UnixNano(), 10),
+			Attributes: s.attributes,
+			Status:     statusJSON{Code: statusOK},
+		}
+		if s.parent != ([8]byte{}) {
+			j.ParentSpanID = hex.EncodeToString(s.parent[:])
+		}
+		if err != nil {
+			j.Status = statusJSON{Code: statusError, Message: err.Error()}
+		}
+		s.tracer.finish(j)
+	})
+}
+
+type contextKey int
+
+const spanKey contextKey = 0
+
+// WithTracer returns a context with the run span of the tracer. If t is nil,
+// ctx is returned.
+func WithTracer(ctx context.Context, t *Tracer) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey, t.run)
+}
+
+// Start starts a span below the span of the context. The attributes are given
+// as key and value. It returns a context with the new span. If the context
+// has no span, it returns ctx and nil.
+func Start(ctx context.Context, name string, attributes ...string) (context.Context, *Span) {
+	parent, _ := ctx.Value(spanKey).(*Span)
+	if parent == nil {
+		return ctx, nil
+	}
+	s := parent.tracer.newSpan(name, parent.id, attributes...)
+	return context.WithValue(ctx, spanKey, s), s
+}
+
+// Inject sets the header traceparent to the span of the context, if the
+// tracer propagates the trace.
+func Inject(ctx context.Context, header http.Header) {
+	s, _ := ctx.Value(spanKey).(*Span)
+	if s == nil || !s.tracer.propagate {
+		return
+	}
+	header.Set("traceparent", fmt.Sprintf("00-%x-%x-01", s.tracer.trace, s.id))
+}
+
+// The values of the OTLP json encoding.
+const (
+	spanKindInternal = 1
+
+	statusOK    = 1
+	statusError = 2
+)
+
+type spanJSON struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []attributeJSON `json:"attributes,omitempty"`
+	Status       statusJSON      `json:"status"`
+}
+
+type statusJSON struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type attributeJSON struct {
+	Key   string            `json:"key"`
+	Value map[string]string `json:"value"`
+}
+
+func stringAttribute(key, value string) attributeJSON {
+	return attributeJSON{Key: key, Value: map[string]string{"stringValue": value}}
+}
@@ -0,0 +1,120 @@
+// Package trend keeps rolling statistics of repeated runs and finds
+// regressions against them.
+package trend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ostcar/oswstest/result"
+)
+
+// minHistory is the number of earlier runs, that are needed for a baseline.
+// With fewer runs, the baseline is too noisy.
+const minHistory = 3
+
+// Regression is a result, whose average is worse then its baseline.
+type Regression struct {
+	Test        string        `json:"test"`
+	Description string        `json:"description"`
+	Value       time.Duration `json:"value_ns"`
+	Baseline    time.Duration `json:"baseline_ns"`
+	Percent     float64       `json:"percent"`
+}
+
+func (r Regression) String() string {
+	return fmt.Sprintf("%s: %s is %dms, %.0f%% slower then the baseline of %dms",
+		r.Test, r.Description, r.Value/time.Millisecond, r.Percent, r.Baseline/time.Millisecond)
+}
+
+// Tracker keeps the averages of the last runs of each result. It is a
+// result.Sink, so it can get the results of each run. Closing it does
+// nothing, so it can be used for many runs.
+type Tracker struct {
+	window      int
+	percent     float64
+	history     map[string][]time.Duration
+	regressions []Regression
+}
+
+// NewTracker creates a tracker. The baseline of a result is the mean of the
+// averages of the last window runs. A result is a regression, if its average
+// is more then percent slower then the baseline.
+func NewTracker(window int, percent float64) *Tracker {
+	if window < 1 {
+		window = 1
+	}
+	return &Tracker{window: window, percent: percent, history: make(map[string][]time.Duration)}
+}
+
+// Publish compares the results with there baselines and adds them to the
+// history.
+func (t *Tracker) Publish(test string, results []*result.TestResult) error {
+	for _, r := range results {
+		if r.Count() == 0 {
+			continue
+		}
+		key := test + "\x00" + r.Description()
+		value := r.Ave()
+		history := t.history[key]
+
+		if len(history) >= minHistory || len(history) >= t.window {
+			var sum time.Duration
+			for _, v := range history {
+				sum += v
+			}
+			baseline := sum / time.Duration(len(history))
+			if baseline > 0 {
+				percent := float64(value-baseline) / float64(baseline) * 100
+				if percent > t.percent {
+					t.regressions = append(t.regressions, Regression{
+						Test:        test,
+						Description: r.Description(),
+						Value:       value,
+						Baseline:    baseline,
+						Percent:     percent,
+					})
+				}
+			}
+		}
+
+		history = append(history, value)
+		if len(history) > t.window {
+			history = history[len(history)-t.window:]
+		}
+		t.history[key] = history
+	}
+	return nil
+}
+
+// Close does nothing.
+func (t *Tracker) Close() error { return nil }
+
+// Regressions returns the regressions since the last call.
+func (t *Tracker) Regressions() []Regression {
+	r := t.regressions
+	t.regressions = nil
+	return r
+}
+
+// PostWebhook sends the regressions as json to a url.
+func PostWebhook(url string, regressions []Regression) error {
+	data, err := json.Marshal(struct {
+		Regressions []Regression `json:"regressions"`
+	}{regressions})
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}